@@ -1,53 +1,256 @@
-package app
-
-import (
-	"database/sql"
-	"os"
-
-	handler "github.com/demkowo/forum/handlers"
-	postgres "github.com/demkowo/forum/repositories/postgres"
-	service "github.com/demkowo/forum/services"
-	logger "github.com/demkowo/forum/utils/logger"
-	"github.com/gin-gonic/gin"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	log "github.com/sirupsen/logrus"
-
-	_ "github.com/lib/pq"
-)
-
-const (
-	portNumber = ":5000"
-)
-
-var (
-	dbConnection = os.Getenv("DB_CONNECTION")
-	router       = gin.Default()
-)
-
-func init() {
-	logger.Start.BasicConfig()
-}
-
-func Start() {
-	log.Trace()
-
-	db, err := sql.Open("postgres", dbConnection)
-	if err != nil {
-		log.Panic(err)
-	}
-	defer db.Close()
-
-	forumRepo := postgres.NewForum(db)
-	forumService := service.NewForum(forumRepo)
-	forumHandler := handler.NewForum(forumService)
-	addForumRoutes(forumHandler)
-
-	forumHandler.CreateTableComments()
-	forumHandler.CreateTableComplaints()
-	forumHandler.CreateTableLikes()
-	forumHandler.CreateTableDislikes()
-
-	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
-
-	router.Run(portNumber)
-}
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/demkowo/forum/config"
+	handler "github.com/demkowo/forum/handlers"
+	"github.com/demkowo/forum/metrics"
+	"github.com/demkowo/forum/middleware"
+	model "github.com/demkowo/forum/models"
+	postgres "github.com/demkowo/forum/repositories/postgres"
+	service "github.com/demkowo/forum/services"
+	"github.com/demkowo/forum/tracing"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	_ "github.com/lib/pq"
+)
+
+var (
+	router = gin.New()
+)
+
+func init() {
+	logger.Start.BasicConfig()
+}
+
+// ConfigureLogging replaces the basic logging configuration with the
+// logrus section of cfg.
+func ConfigureLogging(cfg *config.Config) {
+	log.Trace()
+
+	model.Config.Set(&model.ConfigStruct{Logrus: cfg.Logrus})
+	logger.Start.YamlConfig()
+}
+
+// Start serves the API until a shutdown signal. Once the server is down
+// the deferred calls stop the SSE and WebSocket hubs, the outbox relay and
+// the webhook worker, each finishing its work in flight, then close the
+// event listener and the database and flush the buffered spans.
+func Start(cfg *config.Config) {
+	log.Trace()
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Panicf("setting up tracing failed: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Errorf("Failed to flush spans: %v", err)
+		}
+	}()
+
+	db := openDB(cfg.Database)
+	defer db.Close()
+	metrics.RegisterDB(db, "forum")
+
+	replica, replicaErr := openReplica(cfg.Database)
+	if replicaErr != nil {
+		log.Errorf("read replica unavailable, reading from the primary: %v", replicaErr)
+	}
+	if replica != nil {
+		defer replica.Close()
+		metrics.RegisterDB(replica, "forum_replica")
+	}
+
+	addMiddlewares()
+
+	healthRepo := postgres.NewHealth(db)
+	healthService := service.NewHealth(healthRepo)
+	switch {
+	case replica != nil:
+		healthService.AddOptionalCheck("replica", postgres.NewHealth(replica).Ping)
+	case replicaErr != nil:
+		healthService.AddOptionalCheck("replica", func(ctx context.Context) error {
+			return fmt.Errorf("reading from the primary: %w", replicaErr)
+		})
+	}
+	healthHandler := handler.NewHealth(healthService)
+	addHealthRoutes(healthHandler)
+
+	spamRepo := postgres.NewSpam(db)
+	spamService := service.NewSpam(spamRepo, config.Values.Get)
+	spamHandler := handler.NewSpam(spamService)
+	addSpamRoutes(spamHandler)
+
+	notificationRepo := postgres.NewNotification(db)
+	notificationService := service.NewNotification(notificationRepo)
+	notificationHandler := handler.NewNotification(notificationService)
+	addNotificationRoutes(notificationHandler)
+
+	webhookRepo := postgres.NewWebhook(db)
+	webhookService := service.NewWebhook(webhookRepo, nil, config.Values.Get)
+	webhookHandler := handler.NewWebhook(webhookService)
+	if cfg.Features.Webhooks {
+		addWebhookRoutes(webhookHandler)
+		healthService.AddWorker("webhook", webhookService)
+	}
+
+	reputationRepo := postgres.NewReputation(db)
+	reputationService := service.NewReputation(reputationRepo, config.Values.Get)
+	reputationHandler := handler.NewReputation(reputationService)
+	addReputationRoutes(reputationHandler)
+
+	forumRepo := postgres.NewForum(db, replica, cfg.Search.Language)
+	floodService := service.NewFlood(config.Values.Get)
+	forumService := service.NewForum(forumRepo, spamService, floodService, notificationService, reputationService, config.Values.Get)
+	forumHandler := handler.NewForum(forumService)
+	addForumRoutes(forumHandler, cfg.Features)
+
+	privacyRepo := postgres.NewPrivacy(db)
+	privacyService := service.NewPrivacy(privacyRepo)
+	privacyHandler := handler.NewPrivacy(privacyService)
+	addPrivacyRoutes(privacyHandler)
+
+	// The streams of every replica learn about published events from the
+	// relay's NOTIFY.
+	outboxRepo := postgres.NewOutbox(db, cfg.Features.Stream || cfg.Features.Live)
+	publishers := service.Publishers{service.NewLogPublisher(), reputationService}
+	if cfg.Features.Webhooks {
+		publishers = append(publishers, webhookService)
+	}
+	outboxService := service.NewOutbox(outboxRepo, publishers, config.Values.Get)
+	outboxHandler := handler.NewOutbox(outboxService)
+	healthService.AddWorker("outbox", outboxService)
+
+	var eventFeed service.EventFeed
+	var streamService service.Stream
+	var liveService service.Live
+	if cfg.Features.Stream || cfg.Features.Live {
+		// Shared by the event feed and the live service, closed only here
+		// once both have stopped.
+		eventListener, err := postgres.NewEventListener(cfg.Database.Connection)
+		if err != nil {
+			log.Panic(err)
+		}
+		defer eventListener.Close()
+		eventBus := service.NewBus()
+		eventFeed = service.NewEventFeed(outboxRepo, eventBus, eventListener)
+		healthService.AddWorker("events", eventFeed)
+
+		if cfg.Features.Stream {
+			streamService = service.NewStream(outboxRepo, forumRepo, eventBus)
+			streamHandler := handler.NewStream(streamService)
+			addStreamRoutes(streamHandler)
+			healthService.AddWorker("stream", streamService)
+		}
+
+		if cfg.Features.Live {
+			presenceRepo := postgres.NewPresence(db)
+			liveService = service.NewLive(presenceRepo, eventBus, eventListener)
+			liveHandler := handler.NewLive(liveService, config.Values.Get)
+			addLiveRoutes(liveHandler)
+			healthService.AddWorker("live", liveService)
+		}
+	}
+
+	outboxHandler.CreateTableOutbox()
+
+	forumHandler.CreateTableComments()
+	forumHandler.CreateTableComplaints()
+	forumHandler.CreateTableLikes()
+	forumHandler.CreateTableDislikes()
+	forumHandler.CreateTableMentions()
+
+	reputationHandler.CreateTableReputation()
+	reputationHandler.CreateTableReputationEvents()
+
+	privacyHandler.CreateTableErasures()
+
+	notificationHandler.CreateTableNotifications()
+	notificationHandler.CreateTableNotificationPreferences()
+
+	webhookHandler.CreateTableWebhooks()
+	webhookHandler.CreateTableWebhookDeliveries()
+	webhookHandler.CreateTableWebhookDeadLetters()
+
+	spamHandler.CreateTableSpamSamples()
+	spamHandler.CreateTableSpamTokens()
+	spamHandler.CreateTableSpamStats()
+
+	if err := spamService.Load(context.Background()); err != nil {
+		log.Panicf("loading spam model failed: %v", err)
+	}
+
+	if cfg.Features.Webhooks {
+		webhookService.Start()
+		defer webhookService.Stop()
+	}
+
+	outboxService.Start()
+	defer outboxService.Stop()
+
+	if eventFeed != nil {
+		eventFeed.Start()
+		defer eventFeed.Stop()
+	}
+
+	if streamService != nil {
+		streamService.Start()
+		defer streamService.Stop()
+	}
+
+	if liveService != nil {
+		liveService.Start()
+		defer liveService.Stop()
+	}
+
+	stopSignals := watchSignals()
+	defer stopSignals()
+
+	// Closed after the API server, so metrics are scraped while it drains.
+	if metricsServer := serveMetrics(cfg.Server); metricsServer != nil {
+		defer metricsServer.Close()
+	}
+
+	server := newServer(cfg.Server, router)
+	if streamService != nil {
+		server.RegisterOnShutdown(streamService.Stop)
+	}
+	if liveService != nil {
+		server.RegisterOnShutdown(liveService.Stop)
+	}
+
+	if err := serve(server, cfg.Server, healthService); err != nil {
+		log.Error(err)
+	}
+}
+
+func addMiddlewares() {
+	log.Trace()
+
+	budgets := func() (middleware.Budget, middleware.Budget) {
+		cfg := config.Values.Get().RateLimit
+		read := middleware.Budget{Name: "read", Rate: cfg.ReadPerMinute / 60, Burst: cfg.ReadBurst}
+		write := middleware.Budget{Name: "write", Rate: cfg.WritePerMinute / 60, Burst: cfg.WriteBurst}
+		return read, write
+	}
+	writes := []string{
+		"POST /api/v1/comments/add",
+		"POST /api/v1/likes/add",
+		"POST /api/v1/complaints/add",
+	}
+
+	router.Use(gin.Recovery())
+	router.Use(middleware.Tracing())
+	router.Use(middleware.Logger())
+	router.Use(middleware.Metrics())
+	router.Use(middleware.Auth(config.Values.Get))
+	router.Use(middleware.RateLimit(middleware.NewMemoryStore(), budgets, writes))
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/demkowo/forum/config"
+	model "github.com/demkowo/forum/models"
+	postgres "github.com/demkowo/forum/repositories/postgres"
+	service "github.com/demkowo/forum/services"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// Command runs a one-off maintenance command instead of the HTTP server.
+func Command(cfg *config.Config, args []string) {
+	log.Trace()
+
+	db := openDB(cfg.Database)
+	defer db.Close()
+
+	ctx := logger.WithFields(context.Background(), log.Fields{"command": args[0]})
+
+	switch args[0] {
+	case "retrain-spam":
+		spamService := service.NewSpam(postgres.NewSpam(db), config.Values.Get)
+		spamModel, err := spamService.Retrain(ctx)
+		if err != nil {
+			log.Fatalf("retrain-spam failed: %v", err)
+		}
+		log.Infof("retrain-spam done: %d spam, %d ham, %d tokens", spamModel.SpamDocs, spamModel.HamDocs, len(spamModel.Tokens))
+	case "rebuild-reputation":
+		reputationService := service.NewReputation(postgres.NewReputation(db), config.Values.Get)
+		if err := reputationService.RebuildReputation(ctx); err != nil {
+			log.Fatalf("rebuild-reputation failed: %v", err)
+		}
+		log.Info("rebuild-reputation done")
+	case "export-user":
+		if len(args) < 3 {
+			log.Fatal("usage: export-user <nickname> <file.json|file.zip>")
+		}
+		privacyService := service.NewPrivacy(postgres.NewPrivacy(db))
+		export, err := exportUser(ctx, privacyService, args[1], args[2])
+		if err != nil {
+			log.Fatalf("export-user failed: %v", err)
+		}
+		log.Infof("export-user done: %d comments, %d likes, %d dislikes, %d complaints",
+			len(export.Comments), len(export.Likes), len(export.Dislikes), len(export.Complaints))
+	case "erase-user":
+		if len(args) < 2 {
+			log.Fatal("usage: erase-user <nickname>")
+		}
+		privacyService := service.NewPrivacy(postgres.NewPrivacy(db))
+		erasure, err := privacyService.EraseUser(ctx, args[1], uuid.Nil)
+		if err != nil {
+			log.Fatalf("erase-user failed: %v", err)
+		}
+		log.Infof("erase-user done: erasure %s", erasure.Id)
+	default:
+		log.Fatalf("unknown command %q, available commands: retrain-spam, rebuild-reputation, export-user, erase-user", args[0])
+	}
+}
+
+// exportUser writes the user's export to path, as a ZIP archive if path ends
+// in .zip and as JSON otherwise. The file is closed before returning, so a
+// failed close is reported too.
+func exportUser(ctx context.Context, privacyService service.Privacy, nickname, path string) (*model.UserExport, error) {
+	export, err := privacyService.ExportUser(ctx, nickname)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasSuffix(path, ".zip") {
+		err = privacyService.WriteArchive(file, export)
+	} else {
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(export)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
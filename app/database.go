@@ -0,0 +1,81 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/demkowo/forum/config"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxConnectBackoff caps the wait between two connection attempts.
+	maxConnectBackoff = 30 * time.Second
+	// pingTimeout limits a single ping of a connection attempt.
+	pingTimeout = 5 * time.Second
+)
+
+// openDB connects to the primary database and panics when it stays
+// unreachable.
+func openDB(cfg config.Database) *sql.DB {
+	log.Trace()
+
+	db, err := connectDB("primary", cfg.Connection, cfg)
+	if err != nil {
+		log.Panic(err)
+	}
+	return db
+}
+
+// openReplica connects to the read replica. It returns nil without error
+// when none is configured and the error when the replica stays
+// unreachable; in both cases reads go to the primary.
+func openReplica(cfg config.Database) (*sql.DB, error) {
+	log.Trace()
+
+	if cfg.ReplicaConnection == "" {
+		return nil, nil
+	}
+	return connectDB("replica", cfg.ReplicaConnection, cfg)
+}
+
+// connectDB opens a connection pool sized by cfg and pings it until the
+// database answers, backing off exponentially from cfg.ConnectBackoff. It
+// gives up when the database is still unreachable after cfg.ConnectTimeout.
+// The connection string is never logged, it may hold a password.
+func connectDB(name, connection string, cfg config.Database) (*sql.DB, error) {
+	log.Trace()
+
+	db, err := sql.Open("postgres", connection)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s database connection: %w", name, err)
+	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	start := time.Now()
+	deadline := start.Add(cfg.ConnectTimeout)
+	backoff := cfg.ConnectBackoff
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+		err = db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			log.Infof("connected to the %s database after %d attempt(s) in %s", name, attempt, time.Since(start).Round(time.Millisecond))
+			return db, nil
+		}
+
+		if time.Now().Add(backoff).After(deadline) {
+			db.Close()
+			return nil, fmt.Errorf("%s database unreachable after %d attempt(s) in %s: %w", name, attempt, time.Since(start).Round(time.Millisecond), err)
+		}
+
+		log.Warnf("%s database unreachable (attempt %d), retrying in %s: %v", name, attempt, backoff, err)
+		time.Sleep(backoff)
+		backoff = min(2*backoff, maxConnectBackoff)
+	}
+}
@@ -1,22 +1,32 @@
 package app
 
 import (
+	"github.com/demkowo/forum/config"
 	handler "github.com/demkowo/forum/handlers"
+	"github.com/demkowo/forum/middleware"
 	log "github.com/sirupsen/logrus"
 )
 
-func addForumRoutes(h handler.Forum) {
+func addForumRoutes(h handler.Forum, features config.Features) {
 	log.Trace()
 
 	public := router.Group("/api/v1/")
 	auth := router.Group("/api/v1/")
+	moderator := router.Group("/api/v1/")
+	moderator.Use(middleware.RequireRole(middleware.RoleModerator, middleware.RoleAdmin))
 
-	auth.POST("/comments/add", h.AddComment)
+	auth.POST("/comments/add", middleware.RequireNickname(), h.AddComment)
 	auth.DELETE("/comments/delete/:comment_id", h.DeleteComment)
 	auth.GET("/comments/get/:comment_id", h.GetComment)
-	auth.GET("/comments/find", h.FindComments)
+	moderator.GET("/comments/find", h.FindComments)
 	public.GET("/comments/find/:article_id", h.FindCommentsByArticle)
 	public.GET("/comments/count/:article_id", h.CountComments)
+	moderator.GET("/comments/held", h.FindHeldComments)
+	public.GET("/comments/mentions/:nickname", h.FindCommentsMentioning)
+	if features.Search {
+		auth.GET("/comments/search", h.SearchComments)
+	}
+	moderator.POST("/comments/approve/:comment_id", h.ApproveComment)
 
 	auth.POST("/likes/add", h.AddLike)
 	auth.DELETE("/likes/delete", h.DeleteLike)
@@ -30,6 +40,14 @@ func addForumRoutes(h handler.Forum) {
 
 	auth.POST("/complaints/add", h.AddComplaint)
 	auth.DELETE("/complaints/delete/:complaint_id", h.DeleteComplaint)
+	moderator.POST("/complaints/uphold/:complaint_id", h.UpholdComplaint)
+	moderator.POST("/complaints/dismiss/:complaint_id", h.DismissComplaint)
 	public.GET("/complaints/count/:comment_id", h.CountComplaints)
 	public.GET("/complaints/find/:comment_id", h.FindComplaintsByComment)
+
+	public.GET("/users/comments/:nickname", h.FindUserComments)
+	public.GET("/users/liked/:nickname", h.FindUserLikedComments)
+	public.GET("/users/disliked/:nickname", h.FindUserDislikedComments)
+	moderator.GET("/users/complaints/:nickname", h.FindUserComplaints)
+	public.GET("/users/stats/:nickname", h.GetUserStats)
 }
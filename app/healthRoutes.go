@@ -0,0 +1,15 @@
+package app
+
+import (
+	handler "github.com/demkowo/forum/handlers"
+	log "github.com/sirupsen/logrus"
+)
+
+// addHealthRoutes serves the probes outside /api/, so they are neither rate
+// limited nor versioned.
+func addHealthRoutes(h handler.Health) {
+	log.Trace()
+
+	router.GET("/healthz", h.Healthz)
+	router.GET("/readyz", h.Readyz)
+}
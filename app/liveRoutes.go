@@ -0,0 +1,14 @@
+package app
+
+import (
+	handler "github.com/demkowo/forum/handlers"
+	log "github.com/sirupsen/logrus"
+)
+
+func addLiveRoutes(h handler.Live) {
+	log.Trace()
+
+	auth := router.Group("/api/v1/")
+
+	auth.GET("/comments/live/:article_id", h.Connect)
+}
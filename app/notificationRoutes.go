@@ -0,0 +1,20 @@
+package app
+
+import (
+	handler "github.com/demkowo/forum/handlers"
+	"github.com/demkowo/forum/middleware"
+	log "github.com/sirupsen/logrus"
+)
+
+func addNotificationRoutes(h handler.Notification) {
+	log.Trace()
+
+	auth := router.Group("/api/v1/")
+	auth.Use(middleware.RequireSelf("nickname"))
+
+	auth.GET("/notifications/find/:nickname", h.FindUnread)
+	auth.POST("/notifications/read/:nickname/:notification_id", h.MarkRead)
+	auth.POST("/notifications/read/:nickname", h.MarkAllRead)
+	auth.GET("/notifications/preferences/:nickname", h.GetPreferences)
+	auth.PUT("/notifications/preferences/:nickname", h.SetPreferences)
+}
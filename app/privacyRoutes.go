@@ -0,0 +1,18 @@
+package app
+
+import (
+	handler "github.com/demkowo/forum/handlers"
+	"github.com/demkowo/forum/middleware"
+	log "github.com/sirupsen/logrus"
+)
+
+func addPrivacyRoutes(h handler.Privacy) {
+	log.Trace()
+
+	auth := router.Group("/api/v1/")
+	auth.Use(middleware.RequireRole(middleware.RoleAdmin))
+
+	auth.GET("/users/export/:nickname", h.ExportUser)
+	auth.POST("/users/erase/:nickname", h.EraseUser)
+	auth.GET("/users/erasures", h.FindErasures)
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/demkowo/forum/config"
+	logger "github.com/demkowo/forum/utils/logger"
+	log "github.com/sirupsen/logrus"
+)
+
+// watchSignals reloads the configuration on every SIGHUP and reopens the
+// log file on reopenSignals until the returned function is called.
+func watchSignals() func() {
+	log.Trace()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	reopen := make(chan os.Signal, 1)
+	if len(reopenSignals) > 0 {
+		signal.Notify(reopen, reopenSignals...)
+	}
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+				reload()
+			case <-reopen:
+				logger.Start.Reopen()
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		signal.Stop(reopen)
+		close(done)
+	}
+}
+
+func reload() {
+	log.Trace()
+
+	applied, ignored, err := config.Reload()
+	if err != nil {
+		log.Errorf("Rejected configuration reload, keeping the running configuration: %v", err)
+		return
+	}
+
+	if len(ignored) > 0 {
+		log.Warnf("configuration keys changed that need a restart: %s", strings.Join(ignored, ", "))
+	}
+
+	if len(applied) == 0 {
+		log.Info("configuration reloaded, nothing changed")
+		return
+	}
+
+	if slices.ContainsFunc(applied, func(key string) bool { return strings.HasPrefix(key, "logrus.") }) {
+		ConfigureLogging(config.Values.Get())
+	}
+
+	log.Infof("configuration reloaded, changed: %s", strings.Join(applied, ", "))
+}
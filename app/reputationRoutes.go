@@ -0,0 +1,17 @@
+package app
+
+import (
+	handler "github.com/demkowo/forum/handlers"
+	"github.com/demkowo/forum/middleware"
+	log "github.com/sirupsen/logrus"
+)
+
+func addReputationRoutes(h handler.Reputation) {
+	log.Trace()
+
+	public := router.Group("/api/v1/")
+	auth := router.Group("/api/v1/")
+
+	public.GET("/users/reputation/:nickname", h.GetReputation)
+	auth.POST("/reputation/rebuild", middleware.RequireRole(middleware.RoleAdmin), h.RebuildReputation)
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/demkowo/forum/config"
+	service "github.com/demkowo/forum/services"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// shutdownSignals start a graceful shutdown, a second one cuts it short.
+var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// newServer returns the HTTP server configured by cfg.
+func newServer(cfg config.Server, handler http.Handler) *http.Server {
+	log.Trace()
+
+	return &http.Server{
+		Addr:              cfg.Address,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// serveMetrics serves Prometheus metrics on cfg.MetricsAddress, apart from
+// the API, so they are only reachable where that listener is. It returns
+// the server to close on shutdown, or nil when MetricsAddress is empty.
+func serveMetrics(cfg config.Server) *http.Server {
+	log.Trace()
+
+	if cfg.MetricsAddress == "" {
+		log.Info("metrics disabled, server.metrics_address is empty")
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{
+		Addr:              cfg.MetricsAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+	}
+
+	go func() {
+		log.Infof("serving metrics on %s", cfg.MetricsAddress)
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Errorf("metrics server failed: %v", err)
+		}
+	}()
+
+	return server
+}
+
+// serve runs server until a shutdown signal arrives, then fails readiness,
+// waits cfg.DrainDelay for load balancers to notice, stops accepting
+// connections and waits up to cfg.ShutdownTimeout for the requests in
+// flight. Functions registered with server.RegisterOnShutdown run when it
+// stops accepting and must end long-lived streams. It returns when the
+// server is closed, or the error that kept it from serving.
+func serve(server *http.Server, cfg config.Server, health service.Health) error {
+	log.Trace()
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, shutdownSignals...)
+	defer signal.Stop(signals)
+
+	failed := make(chan error, 1)
+	go func() {
+		var err error
+		if cfg.TLSCertFile != "" {
+			log.Infof("listening on %s with TLS", cfg.Address)
+			err = server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			log.Infof("listening on %s", cfg.Address)
+			err = server.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			failed <- err
+		}
+	}()
+
+	select {
+	case err := <-failed:
+		return err
+	case sig := <-signals:
+		log.Infof("received %s, shutting down", sig)
+	}
+
+	health.Drain()
+	if cfg.DrainDelay > 0 {
+		log.Infof("waiting %s before closing the listener", cfg.DrainDelay)
+		select {
+		case <-time.After(cfg.DrainDelay):
+		case sig := <-signals:
+			log.Warnf("received %s, skipping the drain delay", sig)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case sig := <-signals:
+			log.Warnf("received %s, closing open connections", sig)
+			cancel()
+		}
+	}()
+
+	if err := server.Shutdown(ctx); err != nil {
+		log.Warnf("requests still in flight after shutdown deadline, closing them: %v", err)
+		server.Close()
+		return nil
+	}
+	log.Info("HTTP server stopped")
+
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package app
+
+import (
+	"os"
+	"syscall"
+)
+
+// reopenSignals make the logger reopen its file, as sent by logrotate.
+var reopenSignals = []os.Signal{syscall.SIGUSR1}
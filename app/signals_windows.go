@@ -0,0 +1,10 @@
+//go:build windows
+
+package app
+
+import (
+	"os"
+)
+
+// reopenSignals is empty, Windows has no SIGUSR1.
+var reopenSignals []os.Signal
@@ -0,0 +1,17 @@
+package app
+
+import (
+	handler "github.com/demkowo/forum/handlers"
+	"github.com/demkowo/forum/middleware"
+	log "github.com/sirupsen/logrus"
+)
+
+func addSpamRoutes(h handler.Spam) {
+	log.Trace()
+
+	auth := router.Group("/api/v1/")
+	auth.Use(middleware.RequireRole(middleware.RoleModerator, middleware.RoleAdmin))
+
+	auth.POST("/spam/retrain", h.Retrain)
+	auth.GET("/spam/stats", h.GetStats)
+}
@@ -0,0 +1,14 @@
+package app
+
+import (
+	handler "github.com/demkowo/forum/handlers"
+	log "github.com/sirupsen/logrus"
+)
+
+func addStreamRoutes(h handler.Stream) {
+	log.Trace()
+
+	public := router.Group("/api/v1/")
+
+	public.GET("/comments/stream/:article_id", h.StreamComments)
+}
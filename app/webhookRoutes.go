@@ -0,0 +1,21 @@
+package app
+
+import (
+	handler "github.com/demkowo/forum/handlers"
+	"github.com/demkowo/forum/middleware"
+	log "github.com/sirupsen/logrus"
+)
+
+func addWebhookRoutes(h handler.Webhook) {
+	log.Trace()
+
+	auth := router.Group("/api/v1/")
+	auth.Use(middleware.RequireRole(middleware.RoleAdmin))
+
+	auth.POST("/webhooks/add", h.AddWebhook)
+	auth.DELETE("/webhooks/delete/:webhook_id", h.DeleteWebhook)
+	auth.GET("/webhooks/find", h.FindWebhooks)
+	auth.GET("/webhooks/deliveries/:webhook_id", h.FindDeliveries)
+	auth.GET("/webhooks/dead-letters", h.FindDeadLetters)
+	auth.POST("/webhooks/replay/:delivery_id", h.ReplayDelivery)
+}
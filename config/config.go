@@ -1,23 +1,529 @@
-package config
-
-import (
-	"os"
-)
-
-var (
-	Values ci = &conf{}
-)
-
-type ci interface {
-	Get() *conf
-}
-
-type conf struct {
-	JWTSecret []byte
-}
-
-func (m *conf) Get() *conf {
-	m.JWTSecret = []byte(os.Getenv("JWT_SECRET"))
-
-	return m
-}
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	model "github.com/demkowo/forum/models"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	Values ci = newStore()
+	source loadSource
+
+	tracingExporters = []string{"none", "stdout", "otlp"}
+)
+
+type ci interface {
+	Get() *Config
+	Set(cfg *Config)
+}
+
+// Getter returns the configuration in effect. Services, middleware and
+// handlers are given Values.Get so they see reloads without reading the
+// global themselves.
+type Getter func() *Config
+
+// Config holds every setting of the service. Load fills it from the
+// defaults, then the YAML file, then the environment, then the flags, each
+// overriding the previous one.
+type Config struct {
+	Server     Server             `yaml:"server"`
+	Database   Database           `yaml:"database"`
+	Auth       Auth               `yaml:"auth"`
+	Logrus     model.LogrusConfig `yaml:"logrus"`
+	RateLimit  RateLimit          `yaml:"rate_limit"`
+	Spam       Spam               `yaml:"spam"`
+	Flood      Flood              `yaml:"flood"`
+	Webhook    Webhook            `yaml:"webhook"`
+	Outbox     Outbox             `yaml:"outbox"`
+	Search     Search             `yaml:"search"`
+	Reputation Reputation         `yaml:"reputation"`
+	Tracing    Tracing            `yaml:"tracing"`
+	Features   Features           `yaml:"features"`
+}
+
+type Server struct {
+	Address           string        `yaml:"address"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`
+	DrainDelay        time.Duration `yaml:"drain_delay"`
+	TLSCertFile       string        `yaml:"tls_cert_file"`
+	TLSKeyFile        string        `yaml:"tls_key_file"`
+	WSAllowedOrigins  []string      `yaml:"ws_allowed_origins"`
+	MetricsAddress    string        `yaml:"metrics_address"`
+}
+
+// Database configures the connection pools of the primary and, when
+// ReplicaConnection is set, of the read replica. On startup connecting is
+// retried for ConnectTimeout, waiting ConnectBackoff after the first failed
+// attempt and twice as long after every next one.
+type Database struct {
+	Connection        string        `yaml:"connection"`
+	ReplicaConnection string        `yaml:"replica_connection"`
+	MaxOpenConns      int           `yaml:"max_open_conns"`
+	MaxIdleConns      int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime   time.Duration `yaml:"conn_max_lifetime"`
+	ConnectTimeout    time.Duration `yaml:"connect_timeout"`
+	ConnectBackoff    time.Duration `yaml:"connect_backoff"`
+}
+
+type Auth struct {
+	JWTSecret string `yaml:"jwt_secret"`
+}
+
+type RateLimit struct {
+	WritePerMinute float64 `yaml:"write_per_minute"`
+	WriteBurst     int     `yaml:"write_burst"`
+	ReadPerMinute  float64 `yaml:"read_per_minute"`
+	ReadBurst      int     `yaml:"read_burst"`
+}
+
+// Spam configures the classifier thresholds and the word lists checked
+// before it. Words match whole words of the content, ignoring case.
+type Spam struct {
+	RejectThreshold float64  `yaml:"reject_threshold"`
+	HoldThreshold   float64  `yaml:"hold_threshold"`
+	MinSamples      int      `yaml:"min_samples"`
+	RejectWords     []string `yaml:"reject_words"`
+	HoldWords       []string `yaml:"hold_words"`
+}
+
+type Flood struct {
+	Window              time.Duration `yaml:"window"`
+	MinInterval         time.Duration `yaml:"min_interval"`
+	DuplicateSimilarity float64       `yaml:"duplicate_similarity"`
+}
+
+type Webhook struct {
+	MaxAttempts  int           `yaml:"max_attempts"`
+	Backoff      time.Duration `yaml:"backoff"`
+	Timeout      time.Duration `yaml:"timeout"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+}
+
+type Outbox struct {
+	PollInterval time.Duration `yaml:"poll_interval"`
+	Retention    time.Duration `yaml:"retention"`
+	MaxAttempts  int           `yaml:"max_attempts"`
+}
+
+type Search struct {
+	Language string `yaml:"language"`
+}
+
+type Reputation struct {
+	ComplaintPenalty float64       `yaml:"complaint_penalty"`
+	Trusted          float64       `yaml:"trusted"`
+	TrustedWeight    float64       `yaml:"trusted_weight"`
+	NewUser          time.Duration `yaml:"new_user"`
+	HoldBelow        float64       `yaml:"hold_below"`
+}
+
+// Tracing selects where OpenTelemetry spans go: "none" keeps only the
+// propagation of incoming trace context, "stdout" writes spans to standard
+// output and "otlp" sends them over OTLP/HTTP to Endpoint.
+type Tracing struct {
+	Exporter    string  `yaml:"exporter"`
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+	ServiceName string  `yaml:"service_name"`
+}
+
+// Features switch optional parts of the API on and off.
+type Features struct {
+	Webhooks bool `yaml:"webhooks"`
+	Stream   bool `yaml:"stream"`
+	Live     bool `yaml:"live"`
+	Search   bool `yaml:"search"`
+}
+
+// Default returns the configuration used when nothing overrides it.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Address:           ":5000",
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+			DrainDelay:        5 * time.Second,
+			MetricsAddress:    "localhost:9090",
+		},
+		Database: Database{
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnectTimeout:  time.Minute,
+			ConnectBackoff:  500 * time.Millisecond,
+		},
+		Logrus: model.LogrusConfig{
+			Output:   []string{"stdout", "file"},
+			Reporter: true,
+			Format:   "custom",
+			Path:     "log.log",
+			Level:    6,
+			MaxSize:  100,
+			MaxAge:   30 * 24 * time.Hour,
+			MaxFiles: 10,
+			Compress: true,
+		},
+		RateLimit: RateLimit{
+			WritePerMinute: 10,
+			WriteBurst:     5,
+			ReadPerMinute:  300,
+			ReadBurst:      60,
+		},
+		Spam: Spam{
+			RejectThreshold: 0.99,
+			HoldThreshold:   0.8,
+			MinSamples:      20,
+		},
+		Flood: Flood{
+			Window:              10 * time.Minute,
+			MinInterval:         15 * time.Second,
+			DuplicateSimilarity: 0.8,
+		},
+		Webhook: Webhook{
+			MaxAttempts:  8,
+			Backoff:      10 * time.Second,
+			Timeout:      10 * time.Second,
+			PollInterval: 5 * time.Second,
+		},
+		Outbox: Outbox{
+			PollInterval: time.Second,
+			Retention:    7 * 24 * time.Hour,
+			MaxAttempts:  10,
+		},
+		Search: Search{
+			Language: "english",
+		},
+		Reputation: Reputation{
+			ComplaintPenalty: 10,
+			Trusted:          50,
+			TrustedWeight:    2,
+			NewUser:          72 * time.Hour,
+			HoldBelow:        0,
+		},
+		Tracing: Tracing{
+			Exporter:    "none",
+			SampleRatio: 1,
+			ServiceName: "forum",
+		},
+		Features: Features{
+			Webhooks: true,
+			Stream:   true,
+			Live:     true,
+			Search:   true,
+		},
+	}
+}
+
+// env maps the environment variables to the settings they override.
+func (c *Config) env() []binding {
+	return []binding{
+		{"SERVER_ADDRESS", &c.Server.Address},
+		{"SERVER_READ_HEADER_TIMEOUT", &c.Server.ReadHeaderTimeout},
+		{"SERVER_READ_TIMEOUT", &c.Server.ReadTimeout},
+		{"SERVER_WRITE_TIMEOUT", &c.Server.WriteTimeout},
+		{"SERVER_IDLE_TIMEOUT", &c.Server.IdleTimeout},
+		{"SERVER_SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout},
+		{"SERVER_DRAIN_DELAY", &c.Server.DrainDelay},
+		{"SERVER_TLS_CERT_FILE", &c.Server.TLSCertFile},
+		{"SERVER_TLS_KEY_FILE", &c.Server.TLSKeyFile},
+		{"WS_ALLOWED_ORIGINS", &c.Server.WSAllowedOrigins},
+		{"SERVER_METRICS_ADDRESS", &c.Server.MetricsAddress},
+		{"DB_CONNECTION", &c.Database.Connection},
+		{"DB_REPLICA_CONNECTION", &c.Database.ReplicaConnection},
+		{"DB_MAX_OPEN_CONNS", &c.Database.MaxOpenConns},
+		{"DB_MAX_IDLE_CONNS", &c.Database.MaxIdleConns},
+		{"DB_CONN_MAX_LIFETIME", &c.Database.ConnMaxLifetime},
+		{"DB_CONNECT_TIMEOUT", &c.Database.ConnectTimeout},
+		{"DB_CONNECT_BACKOFF", &c.Database.ConnectBackoff},
+		{"JWT_SECRET", &c.Auth.JWTSecret},
+		{"LOG_LEVEL", &c.Logrus.Level},
+		{"LOG_FORMAT", &c.Logrus.Format},
+		{"LOG_REPORTER", &c.Logrus.Reporter},
+		{"LOG_OUTPUT", &c.Logrus.Output},
+		{"LOG_PATH", &c.Logrus.Path},
+		{"LOG_MAX_SIZE", &c.Logrus.MaxSize},
+		{"LOG_ROTATE_EVERY", &c.Logrus.RotateEvery},
+		{"LOG_MAX_AGE", &c.Logrus.MaxAge},
+		{"LOG_MAX_FILES", &c.Logrus.MaxFiles},
+		{"LOG_COMPRESS", &c.Logrus.Compress},
+		{"RATE_LIMIT_WRITE_PER_MINUTE", &c.RateLimit.WritePerMinute},
+		{"RATE_LIMIT_WRITE_BURST", &c.RateLimit.WriteBurst},
+		{"RATE_LIMIT_READ_PER_MINUTE", &c.RateLimit.ReadPerMinute},
+		{"RATE_LIMIT_READ_BURST", &c.RateLimit.ReadBurst},
+		{"SPAM_REJECT_THRESHOLD", &c.Spam.RejectThreshold},
+		{"SPAM_HOLD_THRESHOLD", &c.Spam.HoldThreshold},
+		{"SPAM_MIN_SAMPLES", &c.Spam.MinSamples},
+		{"SPAM_REJECT_WORDS", &c.Spam.RejectWords},
+		{"SPAM_HOLD_WORDS", &c.Spam.HoldWords},
+		{"FLOOD_WINDOW", &c.Flood.Window},
+		{"FLOOD_MIN_INTERVAL", &c.Flood.MinInterval},
+		{"DUPLICATE_SIMILARITY", &c.Flood.DuplicateSimilarity},
+		{"WEBHOOK_MAX_ATTEMPTS", &c.Webhook.MaxAttempts},
+		{"WEBHOOK_BACKOFF", &c.Webhook.Backoff},
+		{"WEBHOOK_TIMEOUT", &c.Webhook.Timeout},
+		{"WEBHOOK_POLL_INTERVAL", &c.Webhook.PollInterval},
+		{"OUTBOX_POLL_INTERVAL", &c.Outbox.PollInterval},
+		{"OUTBOX_RETENTION", &c.Outbox.Retention},
+		{"OUTBOX_MAX_ATTEMPTS", &c.Outbox.MaxAttempts},
+		{"SEARCH_LANGUAGE", &c.Search.Language},
+		{"REPUTATION_COMPLAINT_PENALTY", &c.Reputation.ComplaintPenalty},
+		{"REPUTATION_TRUSTED", &c.Reputation.Trusted},
+		{"REPUTATION_TRUSTED_WEIGHT", &c.Reputation.TrustedWeight},
+		{"REPUTATION_NEW_USER", &c.Reputation.NewUser},
+		{"REPUTATION_HOLD_BELOW", &c.Reputation.HoldBelow},
+		{"TRACING_EXPORTER", &c.Tracing.Exporter},
+		{"TRACING_ENDPOINT", &c.Tracing.Endpoint},
+		{"TRACING_INSECURE", &c.Tracing.Insecure},
+		{"TRACING_SAMPLE_RATIO", &c.Tracing.SampleRatio},
+		{"TRACING_SERVICE_NAME", &c.Tracing.ServiceName},
+		{"FEATURE_WEBHOOKS", &c.Features.Webhooks},
+		{"FEATURE_STREAM", &c.Features.Stream},
+		{"FEATURE_LIVE", &c.Features.Live},
+		{"FEATURE_SEARCH", &c.Features.Search},
+	}
+}
+
+// loadSource remembers where Load took the configuration from, for Reload.
+type loadSource struct {
+	file  string
+	flags func(cfg *Config)
+}
+
+// Load builds the configuration from args and the environment, validates
+// it and makes it the current one. The file is taken from -config or
+// CONFIG_FILE. It returns the arguments left after the flags.
+func Load(args []string) (*Config, []string, error) {
+	fs := flag.NewFlagSet("forum", flag.ContinueOnError)
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "path to the YAML configuration")
+	address := fs.String("addr", "", "address to listen on (server.address)")
+	connection := fs.String("db", "", "database connection string (database.connection)")
+	level := fs.Int("log-level", 0, "log level from 0 (panic) to 6 (trace) (logrus.level)")
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	flags := func(cfg *Config) {
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "addr":
+				cfg.Server.Address = *address
+			case "db":
+				cfg.Database.Connection = *connection
+			case "log-level":
+				cfg.Logrus.Level = *level
+			}
+		})
+	}
+
+	cfg, err := build(*file, flags)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	source = loadSource{file: *file, flags: flags}
+	Values.Set(cfg)
+	return cfg, fs.Args(), nil
+}
+
+func build(file string, flags func(cfg *Config)) (*Config, error) {
+	cfg := Default()
+
+	if file != "" {
+		if err := cfg.readFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.readEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	if flags != nil {
+		flags(cfg)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func (c *Config) readEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+
+	for _, b := range c.env() {
+		v, ok := lookup(b.env)
+		if !ok || v == "" {
+			continue
+		}
+		if err := b.set(v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.env, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Address != "", "server.address must not be empty")
+	check(c.Server.ReadHeaderTimeout >= 0 && c.Server.ReadTimeout >= 0 && c.Server.WriteTimeout >= 0 && c.Server.IdleTimeout >= 0,
+		"server timeouts must not be negative")
+	check(c.Server.ShutdownTimeout > 0 && c.Server.DrainDelay >= 0, "server.shutdown_timeout must be positive and server.drain_delay not negative")
+	check((c.Server.TLSCertFile == "") == (c.Server.TLSKeyFile == ""), "server.tls_cert_file and server.tls_key_file must be set together")
+	check(c.Server.MetricsAddress != c.Server.Address, "server.metrics_address must differ from server.address, metrics are not served on the API port")
+	check(c.Database.Connection != "", "database.connection (DB_CONNECTION) is required")
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns must not be negative, got %d", c.Database.MaxOpenConns)
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns must not be negative, got %d", c.Database.MaxIdleConns)
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime must not be negative")
+	check(c.Database.ConnectTimeout >= 0 && c.Database.ConnectBackoff > 0,
+		"database.connect_timeout must not be negative and database.connect_backoff must be positive")
+	check(c.Auth.JWTSecret != "", "auth.jwt_secret (JWT_SECRET) is required")
+	if err := ValidateLogging(&c.Logrus); err != nil {
+		errs = append(errs, err)
+	}
+	check(c.RateLimit.WritePerMinute > 0 && c.RateLimit.ReadPerMinute > 0, "rate_limit rates must be positive")
+	check(c.RateLimit.WriteBurst > 0 && c.RateLimit.ReadBurst > 0, "rate_limit bursts must be positive")
+	check(c.Spam.HoldThreshold >= 0 && c.Spam.HoldThreshold <= c.Spam.RejectThreshold && c.Spam.RejectThreshold <= 1,
+		"spam thresholds must satisfy 0 <= hold_threshold <= reject_threshold <= 1, got %g and %g", c.Spam.HoldThreshold, c.Spam.RejectThreshold)
+	check(c.Spam.MinSamples >= 0, "spam.min_samples must not be negative, got %d", c.Spam.MinSamples)
+	for _, word := range slices.Concat(c.Spam.RejectWords, c.Spam.HoldWords) {
+		check(word != "" && !strings.ContainsFunc(word, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }),
+			"spam.reject_words and spam.hold_words must hold single words of letters and digits, got %q", word)
+	}
+	check(c.Flood.Window > 0 && c.Flood.MinInterval >= 0, "flood.window must be positive and flood.min_interval not negative")
+	check(c.Flood.DuplicateSimilarity > 0 && c.Flood.DuplicateSimilarity <= 1, "flood.duplicate_similarity must be in (0, 1], got %g", c.Flood.DuplicateSimilarity)
+	check(c.Webhook.MaxAttempts > 0, "webhook.max_attempts must be positive, got %d", c.Webhook.MaxAttempts)
+	check(c.Webhook.Backoff > 0 && c.Webhook.Timeout > 0 && c.Webhook.PollInterval > 0, "webhook durations must be positive")
+	check(c.Outbox.PollInterval > 0 && c.Outbox.Retention > 0, "outbox durations must be positive")
+	check(c.Outbox.MaxAttempts > 0, "outbox.max_attempts must be positive, got %d", c.Outbox.MaxAttempts)
+	check(c.Search.Language != "", "search.language must not be empty")
+	check(c.Reputation.TrustedWeight >= 1, "reputation.trusted_weight must be at least 1, got %g", c.Reputation.TrustedWeight)
+	check(c.Reputation.NewUser >= 0, "reputation.new_user must not be negative")
+	check(slices.Contains(tracingExporters, c.Tracing.Exporter), "tracing.exporter must be one of %v, got %q", tracingExporters, c.Tracing.Exporter)
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be in [0, 1], got %g", c.Tracing.SampleRatio)
+	check(c.Tracing.ServiceName != "", "tracing.service_name must not be empty")
+
+	return errors.Join(errs...)
+}
+
+type binding struct {
+	env   string
+	value interface{}
+}
+
+func (b binding) set(v string) error {
+	switch p := b.value.(type) {
+	case *string:
+		*p = v
+	case *[]string:
+		*p = splitList(v)
+	case *int:
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		*p = i
+	case *float64:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", v)
+		}
+		*p = f
+	case *bool:
+		t, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		*p = t
+	case *time.Duration:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, expected e.g. 30s or 5m", v)
+		}
+		*p = d
+	default:
+		return fmt.Errorf("unsupported setting type %T", b.value)
+	}
+	return nil
+}
+
+func splitList(v string) []string {
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// store holds the current configuration. Until Load is called it holds the
+// defaults with the valid environment overrides.
+type store struct {
+	mu  sync.RWMutex
+	cfg *Config
+}
+
+func newStore() *store {
+	cfg := Default()
+	cfg.readEnv(os.LookupEnv)
+
+	return &store{cfg: cfg}
+}
+
+func (s *store) Get() *Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.cfg
+}
+
+func (s *store) Set(cfg *Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cfg = cfg
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	model "github.com/demkowo/forum/models"
+)
+
+var (
+	logFormats = []string{"text", "json", "custom"}
+	logOutputs = []string{"stdout", "file"}
+)
+
+// ValidateLogging checks the level, format, outputs and rotation limits of
+// the logging configuration. A file output needs a path that can be opened
+// for writing; the check does not create the file.
+func ValidateLogging(cfg *model.LogrusConfig) error {
+	var errs []error
+
+	if cfg.Level < 0 || cfg.Level > 6 {
+		errs = append(errs, fmt.Errorf("logrus.level must be between 0 (panic) and 6 (trace), got %d", cfg.Level))
+	}
+
+	if !slices.Contains(logFormats, cfg.Format) {
+		errs = append(errs, fmt.Errorf("logrus.format must be one of %v, got %q", logFormats, cfg.Format))
+	}
+
+	if len(cfg.Output) == 0 {
+		errs = append(errs, errors.New("logrus.output must not be empty"))
+	}
+	for _, output := range cfg.Output {
+		if !slices.Contains(logOutputs, output) {
+			errs = append(errs, fmt.Errorf("logrus.output must be one of %v, got %q", logOutputs, output))
+		}
+	}
+
+	if slices.Contains(cfg.Output, "file") {
+		if cfg.Path == "" {
+			errs = append(errs, errors.New("logrus.path is required for the file output"))
+		} else if err := checkLogPath(cfg.Path); err != nil {
+			errs = append(errs, fmt.Errorf("logrus.path cannot be opened: %w", err))
+		}
+	}
+
+	if cfg.MaxSize < 0 || cfg.MaxFiles < 0 || cfg.RotateEvery < 0 || cfg.MaxAge < 0 {
+		errs = append(errs, errors.New("logrus.max_size, rotate_every, max_age and max_files must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkLogPath opens an existing log file for appending, or checks that the
+// directory of a new one exists, without creating anything.
+func checkLogPath(path string) error {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		dir, err := os.Stat(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		if !dir.IsDir() {
+			return fmt.Errorf("%s is not a directory", filepath.Dir(path))
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
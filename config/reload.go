@@ -0,0 +1,79 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// restartSections are only read at startup, changes to them are not
+// applied by Reload.
+var restartSections = []string{"server.", "database.", "search.", "tracing.", "features."}
+
+// Reload builds the configuration again from the file, environment and
+// flags Load used and makes it the current one. Sections in
+// restartSections keep their running values. It returns the changed keys
+// that were applied and those that need a restart. An invalid
+// configuration is rejected and the current one stays in place.
+func Reload() (applied []string, ignored []string, err error) {
+	current := Values.Get()
+
+	next, err := build(source.file, source.flags)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, key := range Diff(current, next) {
+		if restartOnly(key) {
+			ignored = append(ignored, key)
+		} else {
+			applied = append(applied, key)
+		}
+	}
+
+	next.Server = current.Server
+	next.Database = current.Database
+	next.Search = current.Search
+	next.Tracing = current.Tracing
+	next.Features = current.Features
+
+	Values.Set(next)
+	return applied, ignored, nil
+}
+
+// Diff returns the YAML keys, e.g. "spam.hold_threshold", whose values
+// differ between a and b.
+func Diff(a, b *Config) []string {
+	var keys []string
+	diff("", reflect.ValueOf(*a), reflect.ValueOf(*b), &keys)
+	return keys
+}
+
+func diff(prefix string, a, b reflect.Value, keys *[]string) {
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+
+		x, y := a.Field(i), b.Field(i)
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			diff(key+".", x, y, keys)
+		case field.Type.Kind() == reflect.Slice && x.Len() == 0 && y.Len() == 0:
+		case !reflect.DeepEqual(x.Interface(), y.Interface()):
+			*keys = append(*keys, key)
+		}
+	}
+}
+
+func restartOnly(key string) bool {
+	for _, section := range restartSections {
+		if strings.HasPrefix(key, section) {
+			return true
+		}
+	}
+	return false
+}
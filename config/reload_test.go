@@ -0,0 +1,58 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReloadKeepsRestartSections(t *testing.T) {
+	t.Setenv("DB_CONNECTION", "postgres://reloaded")
+	t.Setenv("JWT_SECRET", "secret")
+
+	change := map[string]func(cfg *Config){
+		"server.":   func(cfg *Config) { cfg.Server.Address = ":5001" },
+		"database.": func(cfg *Config) { cfg.Database.Connection = "postgres://running" },
+		"search.":   func(cfg *Config) { cfg.Search.Language = "german" },
+		"tracing.":  func(cfg *Config) { cfg.Tracing.Exporter = "stdout" },
+		"features.": func(cfg *Config) { cfg.Features.Live = !cfg.Features.Live },
+	}
+
+	current, err := build("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, section := range restartSections {
+		set, ok := change[section]
+		if !ok {
+			t.Fatalf("no change for restart section %q", section)
+		}
+		set(current)
+	}
+	Values.Set(current)
+	t.Cleanup(func() { Values.Set(Default()) })
+
+	_, ignored, err := Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, section := range restartSections {
+		if !hasPrefix(ignored, section) {
+			t.Errorf("no ignored key in %q, got %v", section, ignored)
+		}
+	}
+	for _, key := range Diff(current, Values.Get()) {
+		if restartOnly(key) {
+			t.Errorf("Reload changed %s, which needs a restart", key)
+		}
+	}
+}
+
+func hasPrefix(keys []string, prefix string) bool {
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,12 +1,18 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/demkowo/forum/middleware"
 	model "github.com/demkowo/forum/models"
 	service "github.com/demkowo/forum/services"
+	logger "github.com/demkowo/forum/utils/logger"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
@@ -17,6 +23,7 @@ type Forum interface {
 	CreateTableLikes()
 	CreateTableDislikes()
 	CreateTableComplaints()
+	CreateTableMentions()
 
 	AddComment(c *gin.Context)
 	DeleteComment(c *gin.Context)
@@ -24,6 +31,10 @@ type Forum interface {
 	FindComments(c *gin.Context)
 	FindCommentsByArticle(c *gin.Context)
 	CountComments(c *gin.Context)
+	FindHeldComments(c *gin.Context)
+	ApproveComment(c *gin.Context)
+	FindCommentsMentioning(c *gin.Context)
+	SearchComments(c *gin.Context)
 
 	AddLike(c *gin.Context)
 	DeleteLike(c *gin.Context)
@@ -37,10 +48,23 @@ type Forum interface {
 
 	AddComplaint(c *gin.Context)
 	DeleteComplaint(c *gin.Context)
+	UpholdComplaint(c *gin.Context)
+	DismissComplaint(c *gin.Context)
 	FindComplaintsByComment(c *gin.Context)
 	CountComplaints(c *gin.Context)
+
+	FindUserComments(c *gin.Context)
+	FindUserLikedComments(c *gin.Context)
+	FindUserDislikedComments(c *gin.Context)
+	FindUserComplaints(c *gin.Context)
+	GetUserStats(c *gin.Context)
 }
 
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
 type CommentNode struct {
 	ID      uuid.UUID      `json:"id"`
 	Comment *model.Comment `json:"comment"`
@@ -82,14 +106,23 @@ func (h *forum) CreateTableComplaints() {
 	log.Info(h.service.CreateTableComplaints())
 }
 
+func (h *forum) CreateTableMentions() {
+	log.Trace()
+
+	log.Info(h.service.CreateTableMentions())
+}
+
+// AddComment posts a comment as the nickname of the token, so flood limits,
+// holds and reputation apply to the user who is posting.
 func (h *forum) AddComment(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
 	var input struct {
 		ArticleID string `json:"article_id" binding:"required"`
 		ThreadID  string `json:"thread_id"`
 		ParentID  string `json:"parent_id"`
-		Author    string `json:"author" binding:"required"`
 		Content   string `json:"content" binding:"required"`
 		ReplyTo   string `json:"reply_to"`
 	}
@@ -129,22 +162,44 @@ func (h *forum) AddComment(c *gin.Context) {
 		}
 	}
 
-	if input.ReplyTo != "" {
-		input.Content = fmt.Sprintf("@%s: %s", input.ReplyTo, input.Content)
-	}
-
 	comment := &model.Comment{
 		Id:        id,
 		ArticleId: articleId,
 		ThreadId:  threadId,
 		ParentId:  parentId,
-		Author:    input.Author,
+		Author:    middleware.Nickname(c),
 		Content:   input.Content,
 		Created:   time.Now(),
 		Deleted:   false,
 	}
 
-	if err := h.service.AddComment(*comment); err != nil {
+	if input.ReplyTo != "" {
+		comment.Mentions = []string{input.ReplyTo}
+	}
+
+	if err := h.service.AddComment(ctx, comment); err != nil {
+		if errors.Is(err, service.ErrUnknownMention) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid mention",
+				"details": err.Error(),
+			})
+			return
+		}
+		if errors.Is(err, service.ErrSpamRejected) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Comment rejected as spam"})
+			return
+		}
+		var floodErr *service.FloodError
+		if errors.As(err, &floodErr) {
+			retryAfter := int(math.Ceil(floodErr.RetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       "Too many comments",
+				"details":     floodErr.Reason,
+				"retry_after": retryAfter,
+			})
+			return
+		}
 		log.Errorf("Failed to add comment: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add comment"})
 		return
@@ -156,12 +211,21 @@ func (h *forum) AddComment(c *gin.Context) {
 		Childs:  []CommentNode{},
 	}
 
+	if comment.Held {
+		c.JSON(http.StatusAccepted, gin.H{
+			"comment_held": newNode,
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"comment_added": newNode,
 	})
 }
 
 func (h *forum) DeleteComment(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
 	idStr := c.Param("comment_id")
@@ -172,7 +236,12 @@ func (h *forum) DeleteComment(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.DeleteComment(commentId); err != nil {
+	var moderator string
+	if role := middleware.Role(c); role == middleware.RoleModerator || role == middleware.RoleAdmin {
+		moderator = middleware.Nickname(c)
+	}
+
+	if err := h.service.DeleteComment(ctx, commentId, moderator); err != nil {
 		log.Errorf("Failed to delete comment: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete comment"})
 		return
@@ -182,6 +251,8 @@ func (h *forum) DeleteComment(c *gin.Context) {
 }
 
 func (h *forum) GetComment(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
 	idStr := c.Param("comment_id")
@@ -192,7 +263,7 @@ func (h *forum) GetComment(c *gin.Context) {
 		return
 	}
 
-	comment, err := h.service.GetComment(commentId)
+	comment, err := h.service.GetComment(ctx, commentId)
 	if err != nil {
 		log.Errorf("Failed to retrieve comment: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve comment"})
@@ -202,50 +273,120 @@ func (h *forum) GetComment(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"comment": comment})
 }
 
+// FindComments lists comments for admin tables as a flat, paginated list,
+// e.g. /comments/find?author=bob&deleted=false&has_complaints=true&sort=score&order=asc.
+// view=tree nests the comments of the page under their threads instead.
 func (h *forum) FindComments(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
-	res, err := h.service.FindComments()
-	if err != nil {
-		log.Errorf("Failed to retrieve comments: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve comments"})
+	filter := model.CommentFilter{
+		Author: c.Query("author"),
+		Sort:   c.Query("sort"),
+	}
+
+	var err error
+	if articleId := c.Query("article_id"); articleId != "" {
+		if filter.ArticleId, err = uuid.Parse(articleId); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID"})
+			return
+		}
+	}
+
+	if filter.From, err = parseTimeQuery(c, "from"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date", "details": err.Error()})
+		return
+	}
+	if filter.To, err = parseTimeQuery(c, "to"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date", "details": err.Error()})
 		return
 	}
 
-	commentMap := make(map[uuid.UUID]*CommentNode)
+	for key, dst := range map[string]**bool{"deleted": &filter.Deleted, "held": &filter.Held} {
+		if *dst, err = parseVisibilityQuery(c, key); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + key, "details": err.Error()})
+			return
+		}
+	}
+	if filter.HasComplaints, err = parseBoolQuery(c, "has_complaints"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid has_complaints", "details": err.Error()})
+		return
+	}
 
-	for _, val := range res {
-		node := &CommentNode{
-			ID:      val.Id,
-			Comment: &val,
-			Childs:  []CommentNode{},
+	if v := c.Query("min_score"); v != "" {
+		minScore, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid min_score", "details": err.Error()})
+			return
 		}
-		commentMap[val.Id] = node
+		filter.MinScore = &minScore
 	}
 
-	var roots []CommentNode
+	if v := c.Query("min_spam_score"); v != "" {
+		minSpamScore, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid min_spam_score", "details": err.Error()})
+			return
+		}
+		filter.MinSpamScore = &minSpamScore
+	}
 
-	for _, val := range res {
-		if val.ThreadId == val.Id {
-			roots = append(roots, *commentMap[val.Id])
-		} else {
-			parentNode, found := commentMap[val.ThreadId]
-			if found {
-				parentNode.Childs = append(parentNode.Childs, *commentMap[val.Id])
-			} else {
-				log.Warnf("Parent comment with ID %s not found for child %s", val.ThreadId, val.Id)
-				roots = append(roots, *commentMap[val.Id])
-			}
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+		filter.Ascending = true
+	case "desc":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order, use asc or desc"})
+		return
+	}
+
+	view := c.DefaultQuery("view", "flat")
+	if view != "flat" && view != "tree" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid view, use flat or tree"})
+		return
+	}
+
+	if filter.Limit, filter.Offset, err = parsePagination(c); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination", "details": err.Error()})
+		return
+	}
+
+	items, total, err := h.service.ListComments(ctx, filter)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidSort) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort", "details": err.Error()})
+			return
 		}
+		log.Errorf("Failed to retrieve comments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve comments"})
+		return
+	}
+
+	var comments interface{} = items
+	if items == nil {
+		comments = []model.CommentListItem{}
+	}
+	if view == "tree" {
+		list := make([]model.Comment, len(items))
+		for i := range items {
+			list[i] = items[i].Comment
+		}
+		comments = buildTree(list)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"comments": roots,
-		"count":    len(res),
+		"comments": comments,
+		"count":    len(items),
+		"total":    total,
+		"limit":    filter.Limit,
+		"offset":   filter.Offset,
 	})
 }
 
 func (h *forum) FindCommentsByArticle(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
 	articleIdStr := c.Param("article_id")
@@ -256,13 +397,131 @@ func (h *forum) FindCommentsByArticle(c *gin.Context) {
 		return
 	}
 
-	res, err := h.service.FindCommentsByArticle(articleId)
+	res, err := h.service.FindCommentsByArticle(ctx, articleId)
 	if err != nil {
 		log.Errorf("Failed to retrieve comments for article: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve comments"})
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"comments": buildTree(res),
+		"count":    len(res),
+	})
+}
+
+func (h *forum) FindUserComments(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+	log.Trace()
+
+	h.findUserComments(c, h.service.FindUserComments)
+}
+
+func (h *forum) FindUserLikedComments(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+	log.Trace()
+
+	h.findUserComments(c, h.service.FindUserLikedComments)
+}
+
+func (h *forum) FindUserDislikedComments(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+	log.Trace()
+
+	h.findUserComments(c, h.service.FindUserDislikedComments)
+}
+
+// findUserComments answers with one page of the comments find returns for
+// the :nickname user.
+func (h *forum) findUserComments(c *gin.Context, find func(ctx context.Context, nickname string, limit, offset int) ([]model.Comment, int, error)) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+
+	nickname := c.Param("nickname")
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination", "details": err.Error()})
+		return
+	}
+
+	comments, total, err := find(ctx, nickname, limit, offset)
+	if err != nil {
+		log.Errorf("Failed to retrieve comments of user %s: %v", nickname, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve comments"})
+		return
+	}
+
+	if comments == nil {
+		comments = []model.Comment{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"comments": comments,
+		"count":    len(comments),
+		"total":    total,
+		"limit":    limit,
+		"offset":   offset,
+	})
+}
+
+func (h *forum) FindUserComplaints(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	nickname := c.Param("nickname")
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination", "details": err.Error()})
+		return
+	}
+
+	complaints, total, err := h.service.FindUserComplaints(ctx, nickname, limit, offset)
+	if err != nil {
+		log.Errorf("Failed to retrieve complaints of user %s: %v", nickname, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve complaints"})
+		return
+	}
+
+	if complaints == nil {
+		complaints = []model.Complaint{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"complaints": complaints,
+		"count":      len(complaints),
+		"total":      total,
+		"limit":      limit,
+		"offset":     offset,
+	})
+}
+
+func (h *forum) GetUserStats(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	nickname := c.Param("nickname")
+
+	stats, err := h.service.GetUserStats(ctx, nickname)
+	if err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Errorf("Failed to retrieve stats of user %s: %v", nickname, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// buildTree nests replies under the first comment of their thread. Replies
+// whose thread is not in res become roots.
+func buildTree(res []model.Comment) []CommentNode {
 	commentMap := make(map[uuid.UUID]*CommentNode)
 
 	for _, val := range res {
@@ -274,29 +533,35 @@ func (h *forum) FindCommentsByArticle(c *gin.Context) {
 		commentMap[val.Id] = node
 	}
 
+	// attach replies first, roots are copied below and must be complete
+	orphans := make(map[uuid.UUID]bool)
+	for _, val := range res {
+		if val.ThreadId == val.Id {
+			continue
+		}
+		parentNode, found := commentMap[val.ThreadId]
+		if found {
+			parentNode.Childs = append(parentNode.Childs, *commentMap[val.Id])
+		} else {
+			log.Warnf("Parent comment with ID %s not found for child %s", val.ThreadId, val.Id)
+			orphans[val.Id] = true
+		}
+	}
+
 	var roots []CommentNode
 
 	for _, val := range res {
-		if val.ThreadId == val.Id {
+		if val.ThreadId == val.Id || orphans[val.Id] {
 			roots = append(roots, *commentMap[val.Id])
-		} else {
-			parentNode, found := commentMap[val.ThreadId]
-			if found {
-				parentNode.Childs = append(parentNode.Childs, *commentMap[val.Id])
-			} else {
-				log.Warnf("Parent comment with ID %s not found for child %s", val.ThreadId, val.Id)
-				roots = append(roots, *commentMap[val.Id])
-			}
 		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"comments": roots,
-		"count":    len(res),
-	})
+	return roots
 }
 
 func (h *forum) CountComments(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
 	idStr := c.Param("article_id")
@@ -308,7 +573,7 @@ func (h *forum) CountComments(c *gin.Context) {
 		return
 	}
 
-	nr, err := h.service.CountCommentsByArticle(id)
+	nr, err := h.service.CountCommentsByArticle(ctx, id)
 	if err != nil {
 		log.Error(err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "counting number of articles failed"})
@@ -318,7 +583,130 @@ func (h *forum) CountComments(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"comments_amount": nr})
 }
 
+func (h *forum) FindHeldComments(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	comments, err := h.service.FindHeldComments(ctx)
+	if err != nil {
+		log.Errorf("Failed to retrieve held comments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve held comments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"comments": comments,
+		"count":    len(comments),
+	})
+}
+
+func (h *forum) FindCommentsMentioning(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	nickname := c.Param("nickname")
+
+	comments, err := h.service.FindCommentsMentioning(ctx, nickname)
+	if err != nil {
+		log.Errorf("Failed to retrieve comments mentioning %s: %v", nickname, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve comments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"comments": comments,
+		"count":    len(comments),
+	})
+}
+
+// SearchComments runs a full-text search, e.g.
+// /comments/search?q="spam link" -offer&author=bob&from=2024-01-01&limit=20&offset=40
+func (h *forum) SearchComments(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	search := model.CommentSearch{
+		Query:  c.Query("q"),
+		Author: c.Query("author"),
+	}
+
+	var err error
+	if articleId := c.Query("article_id"); articleId != "" {
+		if search.ArticleId, err = uuid.Parse(articleId); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID"})
+			return
+		}
+	}
+
+	if search.From, err = parseTimeQuery(c, "from"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date", "details": err.Error()})
+		return
+	}
+	if search.To, err = parseTimeQuery(c, "to"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date", "details": err.Error()})
+		return
+	}
+
+	if search.Limit, search.Offset, err = parsePagination(c); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pagination", "details": err.Error()})
+		return
+	}
+
+	results, total, err := h.service.SearchComments(ctx, search)
+	if err != nil {
+		if errors.Is(err, service.ErrEmptySearch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter q is required"})
+			return
+		}
+		log.Errorf("Failed to search comments: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search comments", "details": err.Error()})
+		return
+	}
+
+	if results == nil {
+		results = []model.CommentSearchResult{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"comments": results,
+		"count":    len(results),
+		"total":    total,
+		"limit":    search.Limit,
+		"offset":   search.Offset,
+	})
+}
+
+func (h *forum) ApproveComment(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	idStr := c.Param("comment_id")
+	commentId, err := uuid.Parse(idStr)
+	if err != nil {
+		log.Errorf("Invalid comment ID: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+		return
+	}
+
+	if err := h.service.ApproveComment(ctx, commentId); err != nil {
+		log.Errorf("Failed to approve comment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to approve comment",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comment approved successfully"})
+}
+
 func (h *forum) AddLike(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
 	var input struct {
@@ -355,7 +743,7 @@ func (h *forum) AddLike(c *gin.Context) {
 		UserId:    userId,
 	}
 
-	if err := h.service.AddLike(like); err != nil {
+	if err := h.service.AddLike(ctx, like); err != nil {
 		log.Errorf("Failed to add like: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to add like",
@@ -368,6 +756,8 @@ func (h *forum) AddLike(c *gin.Context) {
 }
 
 func (h *forum) DeleteLike(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
 	var input struct {
@@ -403,7 +793,7 @@ func (h *forum) DeleteLike(c *gin.Context) {
 		UserId:    userId,
 	}
 
-	if err := h.service.DeleteLike(like); err != nil {
+	if err := h.service.DeleteLike(ctx, like); err != nil {
 		log.Errorf("Failed to remove like: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to remove like",
@@ -416,6 +806,8 @@ func (h *forum) DeleteLike(c *gin.Context) {
 }
 
 func (h *forum) FindLikesByComment(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
 	commentIdStr := c.Param("comment_id")
@@ -427,7 +819,7 @@ func (h *forum) FindLikesByComment(c *gin.Context) {
 		return
 	}
 
-	likes, err := h.service.FindLikesByComment(commentId)
+	likes, err := h.service.FindLikesByComment(ctx, commentId)
 	if err != nil {
 		log.Errorf("Failed to retrieve likes: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve likes"})
@@ -438,6 +830,8 @@ func (h *forum) FindLikesByComment(c *gin.Context) {
 }
 
 func (h *forum) CountLikes(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
 	commentIdStr := c.Param("comment_id")
@@ -449,7 +843,7 @@ func (h *forum) CountLikes(c *gin.Context) {
 		return
 	}
 
-	count, err := h.service.CountLikes(commentId)
+	count, err := h.service.CountLikes(ctx, commentId)
 	if err != nil {
 		log.Errorf("Failed to count likes: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count likes"})
@@ -460,6 +854,8 @@ func (h *forum) CountLikes(c *gin.Context) {
 }
 
 func (h *forum) AddDislike(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
 	var input struct {
@@ -496,7 +892,7 @@ func (h *forum) AddDislike(c *gin.Context) {
 		UserId:    userId,
 	}
 
-	if err := h.service.AddDislike(dislike); err != nil {
+	if err := h.service.AddDislike(ctx, dislike); err != nil {
 		log.Errorf("Failed to add dislike: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to add dislike",
@@ -511,6 +907,8 @@ func (h *forum) AddDislike(c *gin.Context) {
 }
 
 func (h *forum) DeleteDislike(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
 	var input struct {
@@ -546,7 +944,7 @@ func (h *forum) DeleteDislike(c *gin.Context) {
 		UserId:    userId,
 	}
 
-	if err := h.service.DeleteDislike(dislike); err != nil {
+	if err := h.service.DeleteDislike(ctx, dislike); err != nil {
 		log.Errorf("Failed to remove dislike: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to remove dislike",
@@ -559,6 +957,8 @@ func (h *forum) DeleteDislike(c *gin.Context) {
 }
 
 func (h *forum) FindDislikesByComment(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
 	commentIdStr := c.Param("comment_id")
@@ -570,7 +970,7 @@ func (h *forum) FindDislikesByComment(c *gin.Context) {
 		return
 	}
 
-	dislikes, err := h.service.FindDislikesByComment(commentId)
+	dislikes, err := h.service.FindDislikesByComment(ctx, commentId)
 	if err != nil {
 		log.Errorf("Failed to retrieve dislikes: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve dislikes"})
@@ -581,6 +981,8 @@ func (h *forum) FindDislikesByComment(c *gin.Context) {
 }
 
 func (h *forum) CountDislikes(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
 	commentIdStr := c.Param("comment_id")
@@ -592,7 +994,7 @@ func (h *forum) CountDislikes(c *gin.Context) {
 		return
 	}
 
-	count, err := h.service.CountDislikes(commentId)
+	count, err := h.service.CountDislikes(ctx, commentId)
 	if err != nil {
 		log.Errorf("Failed to count dislikes: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count dislikes"})
@@ -603,6 +1005,8 @@ func (h *forum) CountDislikes(c *gin.Context) {
 }
 
 func (h *forum) AddComplaint(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
 	var input struct {
@@ -639,9 +1043,14 @@ func (h *forum) AddComplaint(c *gin.Context) {
 		CommentId: commentId,
 		UserId:    userId,
 		Message:   input.Message,
+		Created:   time.Now(),
 	}
 
-	if err := h.service.AddComplaint(complaint); err != nil {
+	if err := h.service.AddComplaint(ctx, complaint); err != nil {
+		if errors.Is(err, service.ErrComplaintClosed) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Complaint not accepted", "details": err.Error()})
+			return
+		}
 		log.Errorf("Failed to add complaint: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to add complaint",
@@ -654,6 +1063,8 @@ func (h *forum) AddComplaint(c *gin.Context) {
 }
 
 func (h *forum) DeleteComplaint(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
 	idStr := c.Param("complaint_id")
@@ -664,7 +1075,7 @@ func (h *forum) DeleteComplaint(c *gin.Context) {
 		return
 	}
 
-	if err := h.service.DeleteComplaint(id); err != nil {
+	if err := h.service.DeleteComplaint(ctx, id); err != nil {
 		log.Errorf("Failed to remove complaint: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "Failed to remove complaint",
@@ -676,7 +1087,59 @@ func (h *forum) DeleteComplaint(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Complaint removed successfully"})
 }
 
+func (h *forum) UpholdComplaint(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	idStr := c.Param("complaint_id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		log.Errorf("Invalid complaint ID: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid complaint ID"})
+		return
+	}
+
+	if err := h.service.UpholdComplaint(ctx, id); err != nil {
+		log.Errorf("Failed to uphold complaint: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to uphold complaint",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Complaint upheld, comment deleted"})
+}
+
+func (h *forum) DismissComplaint(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	idStr := c.Param("complaint_id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		log.Errorf("Invalid complaint ID: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid complaint ID"})
+		return
+	}
+
+	if err := h.service.DismissComplaint(ctx, id); err != nil {
+		log.Errorf("Failed to dismiss complaint: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to dismiss complaint",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Complaint dismissed successfully"})
+}
+
 func (h *forum) FindComplaintsByComment(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
 	commentIdStr := c.Param("comment_id")
@@ -688,7 +1151,7 @@ func (h *forum) FindComplaintsByComment(c *gin.Context) {
 		return
 	}
 
-	complaints, err := h.service.FindComplaintsByComment(commentId)
+	complaints, err := h.service.FindComplaintsByComment(ctx, commentId)
 	if err != nil {
 		log.Errorf("Failed to retrieve complaints: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve complaints"})
@@ -699,6 +1162,8 @@ func (h *forum) FindComplaintsByComment(c *gin.Context) {
 }
 
 func (h *forum) CountComplaints(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
 	commentIdStr := c.Param("comment_id")
@@ -710,7 +1175,7 @@ func (h *forum) CountComplaints(c *gin.Context) {
 		return
 	}
 
-	count, err := h.service.CountComplaints(commentId)
+	count, err := h.service.CountComplaints(ctx, commentId)
 	if err != nil {
 		log.Errorf("Failed to count complaints: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count complaints"})
@@ -719,3 +1184,64 @@ func (h *forum) CountComplaints(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"number_of_complaints": count})
 }
+
+// parsePagination reads ?limit= (default 20, at most 100) and ?offset=.
+func parsePagination(c *gin.Context) (limit int, offset int, err error) {
+	limit, offset = defaultPageSize, 0
+
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxPageSize {
+			return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if offset, err = strconv.Atoi(v); err != nil || offset < 0 {
+			return 0, 0, errors.New("offset must not be negative")
+		}
+	}
+
+	return limit, offset, nil
+}
+
+// parseBoolQuery reads an optional boolean from the query, nil if it is
+// missing.
+func parseBoolQuery(c *gin.Context, key string) (*bool, error) {
+	v := c.Query(key)
+	if v == "" {
+		return nil, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// parseVisibilityQuery reads a flag that hides comments unless set: it is
+// false when missing and nil, not filtering, for "any".
+func parseVisibilityQuery(c *gin.Context, key string) (*bool, error) {
+	if c.Query(key) == "any" {
+		return nil, nil
+	}
+
+	b, err := strconv.ParseBool(c.DefaultQuery(key, "false"))
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// parseTimeQuery reads an RFC 3339 time or a 2006-01-02 date from the query,
+// the zero time if it is missing.
+func parseTimeQuery(c *gin.Context, key string) (time.Time, error) {
+	v := c.Query(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"net/http"
+
+	model "github.com/demkowo/forum/models"
+	service "github.com/demkowo/forum/services"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type Health interface {
+	Healthz(c *gin.Context)
+	Readyz(c *gin.Context)
+}
+
+type health struct {
+	service service.Health
+}
+
+func NewHealth(service service.Health) Health {
+	log.Trace()
+
+	return &health{
+		service: service,
+	}
+}
+
+// Healthz answers as long as the process serves requests.
+func (h *health) Healthz(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+	log.Trace()
+
+	c.JSON(http.StatusOK, gin.H{"status": model.HealthOk})
+}
+
+// Readyz answers 503 while a check fails or the server drains.
+func (h *health) Readyz(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	readiness := h.service.Ready(ctx)
+	if readiness.Status != model.HealthOk {
+		c.JSON(http.StatusServiceUnavailable, readiness)
+		return
+	}
+
+	c.JSON(http.StatusOK, readiness)
+}
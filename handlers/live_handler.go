@@ -0,0 +1,287 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/demkowo/forum/config"
+	"github.com/demkowo/forum/metrics"
+	"github.com/demkowo/forum/middleware"
+	model "github.com/demkowo/forum/models"
+	service "github.com/demkowo/forum/services"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	liveWriteWait    = 10 * time.Second
+	livePongWait     = 60 * time.Second
+	livePingPeriod   = livePongWait * 9 / 10
+	liveMaxMessage   = 4096
+	liveSendBuffer   = 64
+	liveMaxThreads   = 100
+	liveSlowConsumer = "slow_consumer"
+)
+
+type Live interface {
+	Connect(c *gin.Context)
+}
+
+type live struct {
+	service  service.Live
+	upgrader websocket.Upgrader
+}
+
+func NewLive(service service.Live, cfg config.Getter) Live {
+	log.Trace()
+
+	return &live{
+		service: service,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			CheckOrigin:     checkOrigin(cfg),
+		},
+	}
+}
+
+// Connect upgrades an authenticated request to a WebSocket for the article.
+// Clients send {"type": "subscribe" | "unsubscribe" | "typing", "thread_id": ...}
+// and receive comment, comment.deleted, reaction and typing messages of the
+// threads they subscribed to. Clients that cannot keep up are disconnected
+// with close code 1013 and should reconnect and reload the threads.
+func (h *live) Connect(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	articleId, err := uuid.Parse(c.Param("article_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID"})
+		return
+	}
+
+	userId, err := uuid.Parse(middleware.UserId(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	ws, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Warnf("WebSocket upgrade failed: %v", err)
+		return
+	}
+
+	metrics.WebSocketConnections.Inc()
+	defer metrics.WebSocketConnections.Dec()
+
+	conn := &liveConn{
+		ws:      ws,
+		userId:  userId,
+		send:    make(chan model.LiveMessage, liveSendBuffer),
+		threads: make(map[uuid.UUID]bool),
+		done:    make(chan struct{}),
+		written: make(chan struct{}),
+	}
+
+	messages, unsubscribe := h.service.Subscribe(articleId)
+	defer unsubscribe()
+
+	go conn.write()
+	go conn.forward(messages)
+
+	conn.read(ctx, h.service, articleId)
+	conn.close(websocket.CloseNormalClosure, "", "client")
+	<-conn.written
+}
+
+// checkOrigin accepts same-origin requests, requests without Origin (non
+// browser clients) and the origins listed in WS_ALLOWED_ORIGINS.
+func checkOrigin(cfg config.Getter) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+
+		allowed := cfg().Server.WSAllowedOrigins
+		if slices.Contains(allowed, "*") || slices.Contains(allowed, origin) {
+			return true
+		}
+
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+}
+
+// liveConn is a single WebSocket client. Only write sends on the socket,
+// read and forward queue messages for it.
+type liveConn struct {
+	ws      *websocket.Conn
+	userId  uuid.UUID
+	send    chan model.LiveMessage
+	mu      sync.Mutex
+	threads map[uuid.UUID]bool
+	done    chan struct{}
+	written chan struct{}
+	once    sync.Once
+	code    int
+	text    string
+}
+
+func (c *liveConn) read(ctx context.Context, live service.Live, articleId uuid.UUID) {
+	log := logger.FromContext(ctx)
+
+	c.ws.SetReadLimit(liveMaxMessage)
+	c.ws.SetReadDeadline(time.Now().Add(livePongWait))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(livePongWait))
+	})
+
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+				log.Warnf("WebSocket read failed: %v", err)
+			}
+			return
+		}
+		metrics.WebSocketMessages.WithLabelValues("in").Inc()
+
+		var command model.LiveCommand
+		if err := json.Unmarshal(data, &command); err != nil {
+			c.reply("Invalid message", uuid.Nil)
+			continue
+		}
+		if command.ThreadId == uuid.Nil {
+			c.reply("Invalid thread ID", command.ThreadId)
+			continue
+		}
+
+		switch command.Type {
+		case model.LiveSubscribe:
+			c.mu.Lock()
+			full := len(c.threads) >= liveMaxThreads
+			if !full {
+				c.threads[command.ThreadId] = true
+			}
+			c.mu.Unlock()
+			if full {
+				c.reply("Too many subscriptions", command.ThreadId)
+			}
+
+		case model.LiveUnsubscribe:
+			c.mu.Lock()
+			delete(c.threads, command.ThreadId)
+			c.mu.Unlock()
+
+		case model.LiveTyping:
+			if !c.subscribed(command.ThreadId) {
+				c.reply("Not subscribed to thread", command.ThreadId)
+				continue
+			}
+			presence := model.Presence{ArticleId: articleId, ThreadId: command.ThreadId, UserId: c.userId}
+			if err := live.Typing(ctx, presence); err != nil {
+				log.Errorf("Failed to announce typing: %v", err)
+			}
+
+		default:
+			c.reply("Unknown message type", command.ThreadId)
+		}
+	}
+}
+
+// forward queues the subscribed threads' messages. Typing presence is
+// dropped when the client is behind, anything else disconnects it.
+func (c *liveConn) forward(messages <-chan model.LiveMessage) {
+	for {
+		select {
+		case <-c.done:
+			return
+		case message, ok := <-messages:
+			if !ok {
+				c.close(websocket.CloseTryAgainLater, "subscription closed", liveSlowConsumer)
+				return
+			}
+			if !c.subscribed(message.ThreadId) {
+				continue
+			}
+			if presence, ok := message.Data.(model.Presence); ok && presence.UserId == c.userId {
+				continue
+			}
+
+			select {
+			case c.send <- message:
+			default:
+				if message.Type != model.LiveTyping {
+					c.close(websocket.CloseTryAgainLater, "slow consumer", liveSlowConsumer)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (c *liveConn) write() {
+	defer close(c.written)
+	defer c.ws.Close()
+
+	ping := time.NewTicker(livePingPeriod)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(c.code, c.text), time.Now().Add(liveWriteWait))
+			return
+
+		case message := <-c.send:
+			c.ws.SetWriteDeadline(time.Now().Add(liveWriteWait))
+			if err := c.ws.WriteJSON(message); err != nil {
+				log.Warnf("WebSocket write failed: %v", err)
+				c.close(websocket.CloseAbnormalClosure, "", "write_error")
+				return
+			}
+			metrics.WebSocketMessages.WithLabelValues("out").Inc()
+
+		case <-ping.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveWriteWait)); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "", "ping_error")
+				return
+			}
+		}
+	}
+}
+
+func (c *liveConn) subscribed(threadId uuid.UUID) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.threads[threadId]
+}
+
+func (c *liveConn) reply(message string, threadId uuid.UUID) {
+	select {
+	case c.send <- model.LiveMessage{Type: model.LiveError, ThreadId: threadId, Data: gin.H{"error": message}}:
+	default:
+	}
+}
+
+// close stops the connection once, the first reason wins.
+func (c *liveConn) close(code int, text, reason string) {
+	c.once.Do(func() {
+		c.code, c.text = code, text
+		metrics.WebSocketDisconnects.WithLabelValues(reason).Inc()
+		close(c.done)
+	})
+}
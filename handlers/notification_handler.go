@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	model "github.com/demkowo/forum/models"
+	service "github.com/demkowo/forum/services"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+type Notification interface {
+	CreateTableNotifications()
+	CreateTableNotificationPreferences()
+
+	FindUnread(c *gin.Context)
+	MarkRead(c *gin.Context)
+	MarkAllRead(c *gin.Context)
+
+	GetPreferences(c *gin.Context)
+	SetPreferences(c *gin.Context)
+}
+
+type notification struct {
+	service service.Notification
+}
+
+func NewNotification(service service.Notification) Notification {
+	log.Trace()
+
+	return &notification{
+		service: service,
+	}
+}
+
+func (h *notification) CreateTableNotifications() {
+	log.Trace()
+
+	log.Info(h.service.CreateTableNotifications())
+}
+
+func (h *notification) CreateTableNotificationPreferences() {
+	log.Trace()
+
+	log.Info(h.service.CreateTableNotificationPreferences())
+}
+
+func (h *notification) FindUnread(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	nickname := c.Param("nickname")
+
+	notifications, err := h.service.FindUnread(ctx, nickname)
+	if err != nil {
+		log.Errorf("Failed to retrieve notifications: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": notifications,
+		"count":         len(notifications),
+	})
+}
+
+func (h *notification) MarkRead(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	nickname := c.Param("nickname")
+
+	idStr := c.Param("notification_id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		log.Errorf("Invalid notification ID: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	if err := h.service.MarkRead(ctx, nickname, id); err != nil {
+		log.Errorf("Failed to mark notification as read: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to mark notification as read",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Notification marked as read"})
+}
+
+func (h *notification) MarkAllRead(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	nickname := c.Param("nickname")
+
+	count, err := h.service.MarkAllRead(ctx, nickname)
+	if err != nil {
+		log.Errorf("Failed to mark notifications as read: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notifications as read"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"marked_as_read": count})
+}
+
+func (h *notification) GetPreferences(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	nickname := c.Param("nickname")
+
+	preferences, err := h.service.GetPreferences(ctx, nickname)
+	if err != nil {
+		log.Errorf("Failed to retrieve notification preferences: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve notification preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"preferences": preferences})
+}
+
+func (h *notification) SetPreferences(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	var input struct {
+		MutedKinds   []string `json:"muted_kinds"`
+		MutedThreads []string `json:"muted_threads"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.Errorf("Failed to bind JSON input: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	preferences := model.NotificationPreferences{
+		Nickname:     c.Param("nickname"),
+		MutedKinds:   input.MutedKinds,
+		MutedThreads: []uuid.UUID{},
+	}
+
+	for _, thread := range input.MutedThreads {
+		threadId, err := uuid.Parse(thread)
+		if err != nil {
+			log.Errorf("Invalid thread_id UUID: %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid muted_threads format"})
+			return
+		}
+		preferences.MutedThreads = append(preferences.MutedThreads, threadId)
+	}
+
+	if err := h.service.SetPreferences(ctx, preferences); err != nil {
+		if errors.Is(err, service.ErrUnknownNotificationKind) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid muted_kinds",
+				"details": err.Error(),
+			})
+			return
+		}
+		log.Errorf("Failed to save notification preferences: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save notification preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"preferences": preferences})
+}
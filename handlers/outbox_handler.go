@@ -0,0 +1,28 @@
+package handler
+
+import (
+	service "github.com/demkowo/forum/services"
+	log "github.com/sirupsen/logrus"
+)
+
+type Outbox interface {
+	CreateTableOutbox()
+}
+
+type outbox struct {
+	service service.Outbox
+}
+
+func NewOutbox(service service.Outbox) Outbox {
+	log.Trace()
+
+	return &outbox{
+		service: service,
+	}
+}
+
+func (h *outbox) CreateTableOutbox() {
+	log.Trace()
+
+	log.Info(h.service.CreateTableOutbox())
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/demkowo/forum/middleware"
+	service "github.com/demkowo/forum/services"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+type Privacy interface {
+	CreateTableErasures()
+
+	ExportUser(c *gin.Context)
+	EraseUser(c *gin.Context)
+	FindErasures(c *gin.Context)
+}
+
+type privacy struct {
+	service service.Privacy
+}
+
+func NewPrivacy(service service.Privacy) Privacy {
+	log.Trace()
+
+	return &privacy{
+		service: service,
+	}
+}
+
+func (h *privacy) CreateTableErasures() {
+	log.Trace()
+
+	log.Info(h.service.CreateTableErasures())
+}
+
+// ExportUser returns the user's data as JSON, or as a ZIP archive with
+// ?format=zip.
+func (h *privacy) ExportUser(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	nickname := c.Param("nickname")
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "zip" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format, expected json or zip"})
+		return
+	}
+
+	export, err := h.service.ExportUser(ctx, nickname)
+	if err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Errorf("Failed to export user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to export user",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if format == "json" {
+		c.JSON(http.StatusOK, export)
+		return
+	}
+
+	var archive bytes.Buffer
+	if err := h.service.WriteArchive(&archive, export); err != nil {
+		log.Errorf("Failed to write export archive: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to export user",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="forum-%s.zip"`, export.UserId))
+	c.Data(http.StatusOK, "application/zip", archive.Bytes())
+}
+
+func (h *privacy) EraseUser(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	nickname := c.Param("nickname")
+	requestedBy, _ := uuid.Parse(middleware.UserId(c))
+
+	erasure, err := h.service.EraseUser(ctx, nickname, requestedBy)
+	if err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Errorf("Failed to erase user: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to erase user",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User erased successfully",
+		"erasure": erasure,
+	})
+}
+
+func (h *privacy) FindErasures(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	erasures, err := h.service.FindErasures(ctx)
+	if err != nil {
+		log.Errorf("Failed to retrieve erasures: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve erasures"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"erasures": erasures})
+}
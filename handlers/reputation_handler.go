@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"net/http"
+
+	service "github.com/demkowo/forum/services"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type Reputation interface {
+	CreateTableReputation()
+	CreateTableReputationEvents()
+
+	GetReputation(c *gin.Context)
+	RebuildReputation(c *gin.Context)
+}
+
+type reputation struct {
+	service service.Reputation
+}
+
+func NewReputation(service service.Reputation) Reputation {
+	log.Trace()
+
+	return &reputation{
+		service: service,
+	}
+}
+
+func (h *reputation) CreateTableReputation() {
+	log.Trace()
+
+	log.Info(h.service.CreateTableReputation())
+}
+
+func (h *reputation) CreateTableReputationEvents() {
+	log.Trace()
+
+	log.Info(h.service.CreateTableReputationEvents())
+}
+
+func (h *reputation) GetReputation(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	nickname := c.Param("nickname")
+
+	reputation, err := h.service.GetReputation(ctx, nickname)
+	if err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		log.Errorf("Failed to retrieve reputation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrieve reputation",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reputation": reputation})
+}
+
+func (h *reputation) RebuildReputation(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	if err := h.service.RebuildReputation(ctx); err != nil {
+		log.Errorf("Failed to rebuild reputation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to rebuild reputation",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reputation rebuilt successfully"})
+}
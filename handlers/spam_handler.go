@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"net/http"
+
+	service "github.com/demkowo/forum/services"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+type Spam interface {
+	CreateTableSpamSamples()
+	CreateTableSpamTokens()
+	CreateTableSpamStats()
+
+	Retrain(c *gin.Context)
+	GetStats(c *gin.Context)
+}
+
+type spam struct {
+	service service.Spam
+}
+
+func NewSpam(service service.Spam) Spam {
+	log.Trace()
+
+	return &spam{
+		service: service,
+	}
+}
+
+func (h *spam) CreateTableSpamSamples() {
+	log.Trace()
+
+	log.Info(h.service.CreateTableSpamSamples())
+}
+
+func (h *spam) CreateTableSpamTokens() {
+	log.Trace()
+
+	log.Info(h.service.CreateTableSpamTokens())
+}
+
+func (h *spam) CreateTableSpamStats() {
+	log.Trace()
+
+	log.Info(h.service.CreateTableSpamStats())
+}
+
+func (h *spam) Retrain(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	spamModel, err := h.service.Retrain(ctx)
+	if err != nil {
+		log.Errorf("Failed to retrain spam classifier: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to retrain spam classifier",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Spam classifier retrained successfully",
+		"spam_docs": spamModel.SpamDocs,
+		"ham_docs":  spamModel.HamDocs,
+		"tokens":    len(spamModel.Tokens),
+	})
+}
+
+func (h *spam) GetStats(c *gin.Context) {
+	log := logger.FromContext(c.Request.Context())
+	log.Trace()
+
+	c.JSON(http.StatusOK, gin.H{"spam_model": h.service.Stats()})
+}
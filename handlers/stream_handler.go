@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	model "github.com/demkowo/forum/models"
+	service "github.com/demkowo/forum/services"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const streamHeartbeat = 15 * time.Second
+
+type Stream interface {
+	StreamComments(c *gin.Context)
+}
+
+type stream struct {
+	service service.Stream
+}
+
+func NewStream(service service.Stream) Stream {
+	log.Trace()
+
+	return &stream{
+		service: service,
+	}
+}
+
+// StreamComments pushes the changes of an article as Server-Sent Events. A
+// client reconnecting with Last-Event-ID (or ?last_event_id=) first gets the
+// events it missed.
+func (h *stream) StreamComments(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	articleId, err := uuid.Parse(c.Param("article_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid article ID"})
+		return
+	}
+
+	lastEventId := c.GetHeader("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = c.Query("last_event_id")
+	}
+
+	var after int64
+	if lastEventId != "" {
+		after, err = strconv.ParseInt(lastEventId, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Last-Event-ID", "details": err.Error()})
+			return
+		}
+	}
+
+	messages, unsubscribe := h.service.Subscribe(articleId)
+	defer unsubscribe()
+
+	var missed []model.StreamMessage
+	if lastEventId != "" {
+		missed, err = h.service.Replay(ctx, articleId, after)
+		if err != nil {
+			log.Errorf("Failed to replay stream of article %s: %v", articleId, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to replay events", "details": err.Error()})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	for _, message := range missed {
+		c.Render(-1, sse.Event{Id: strconv.FormatInt(message.Id, 10), Event: message.Event, Data: message.Data})
+		after = message.Id
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			if message.Id <= after {
+				continue
+			}
+			c.Render(-1, sse.Event{Id: strconv.FormatInt(message.Id, 10), Event: message.Event, Data: message.Data})
+		}
+		c.Writer.Flush()
+	}
+}
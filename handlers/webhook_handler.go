@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	model "github.com/demkowo/forum/models"
+	service "github.com/demkowo/forum/services"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+type Webhook interface {
+	CreateTableWebhooks()
+	CreateTableWebhookDeliveries()
+	CreateTableWebhookDeadLetters()
+
+	AddWebhook(c *gin.Context)
+	DeleteWebhook(c *gin.Context)
+	FindWebhooks(c *gin.Context)
+	FindDeliveries(c *gin.Context)
+	FindDeadLetters(c *gin.Context)
+	ReplayDelivery(c *gin.Context)
+}
+
+type webhook struct {
+	service service.Webhook
+}
+
+func NewWebhook(service service.Webhook) Webhook {
+	log.Trace()
+
+	return &webhook{
+		service: service,
+	}
+}
+
+func (h *webhook) CreateTableWebhooks() {
+	log.Trace()
+
+	log.Info(h.service.CreateTableWebhooks())
+}
+
+func (h *webhook) CreateTableWebhookDeliveries() {
+	log.Trace()
+
+	log.Info(h.service.CreateTableWebhookDeliveries())
+}
+
+func (h *webhook) CreateTableWebhookDeadLetters() {
+	log.Trace()
+
+	log.Info(h.service.CreateTableWebhookDeadLetters())
+}
+
+func (h *webhook) AddWebhook(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	var input struct {
+		URL    string   `json:"url" binding:"required"`
+		Events []string `json:"events" binding:"required"`
+		Secret string   `json:"secret"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		log.Errorf("Failed to bind JSON input: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid input",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	webhook := &model.Webhook{
+		URL:    input.URL,
+		Events: input.Events,
+		Secret: input.Secret,
+	}
+
+	if err := h.service.AddWebhook(ctx, webhook); err != nil {
+		if errors.Is(err, service.ErrInvalidWebhook) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid webhook",
+				"details": err.Error(),
+			})
+			return
+		}
+		log.Errorf("Failed to add webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add webhook"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhook_added": webhook})
+}
+
+func (h *webhook) DeleteWebhook(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	idStr := c.Param("webhook_id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		log.Errorf("Invalid webhook ID: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	if err := h.service.DeleteWebhook(ctx, id); err != nil {
+		log.Errorf("Failed to delete webhook: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to delete webhook",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+func (h *webhook) FindWebhooks(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	webhooks, err := h.service.FindWebhooks(ctx)
+	if err != nil {
+		log.Errorf("Failed to retrieve webhooks: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"webhooks": webhooks})
+}
+
+func (h *webhook) FindDeliveries(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	idStr := c.Param("webhook_id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		log.Errorf("Invalid webhook ID: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	deliveries, err := h.service.FindDeliveries(ctx, id)
+	if err != nil {
+		log.Errorf("Failed to retrieve webhook deliveries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve webhook deliveries"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+func (h *webhook) FindDeadLetters(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	deliveries, err := h.service.FindDeadLetters(ctx)
+	if err != nil {
+		log.Errorf("Failed to retrieve webhook dead letters: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve webhook dead letters"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dead_letters": deliveries})
+}
+
+func (h *webhook) ReplayDelivery(c *gin.Context) {
+	ctx := c.Request.Context()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	idStr := c.Param("delivery_id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		log.Errorf("Invalid delivery ID: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return
+	}
+
+	newId, err := h.service.ReplayDelivery(ctx, id)
+	if err != nil {
+		log.Errorf("Failed to replay webhook delivery: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to replay webhook delivery",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Webhook delivery queued",
+		"delivery_id": newId,
+	})
+}
@@ -1,9 +1,30 @@
-package main
-
-import (
-	"github.com/demkowo/forum/app"
-)
-
-func main() {
-	app.Start()
-}
+package main
+
+import (
+	"errors"
+	"flag"
+	"os"
+
+	"github.com/demkowo/forum/app"
+	"github.com/demkowo/forum/config"
+	log "github.com/sirupsen/logrus"
+)
+
+func main() {
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	app.ConfigureLogging(cfg)
+
+	if len(args) > 0 {
+		app.Command(cfg, args)
+		return
+	}
+
+	app.Start(cfg)
+}
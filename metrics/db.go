@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "forum_db_query_duration_seconds",
+	Help:    "Duration of the database work of a repository method.",
+	Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+}, []string{"repository", "method"})
+
+// QueryTimer measures a repository method, call ObserveDuration when it
+// returns:
+//
+//	defer metrics.QueryTimer("forum", "GetComment").ObserveDuration()
+func QueryTimer(repository, method string) *prometheus.Timer {
+	return prometheus.NewTimer(DBQueryDuration.WithLabelValues(repository, method))
+}
+
+// RegisterDB exports the connection pool statistics of db as go_sql_*
+// metrics labelled db_name.
+func RegisterDB(db *sql.DB, name string) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
@@ -0,0 +1,70 @@
+// Package metrics holds the Prometheus metrics of the service. They are
+// registered with the default registry and served on /metrics.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	CommentPublished = "published"
+	CommentHeld      = "held"
+
+	ReactionLike    = "like"
+	ReactionDislike = "dislike"
+	ReactionAdded   = "added"
+	ReactionRemoved = "removed"
+
+	ModerationApprove = "approve"
+	ModerationDelete  = "delete"
+	ModerationUphold  = "uphold"
+	ModerationDismiss = "dismiss"
+)
+
+var (
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "forum_http_request_duration_seconds",
+		Help:    "Duration of HTTP requests by method, route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	CommentsCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "forum_comments_created_total",
+		Help: "Number of comments stored, published at once or held for review.",
+	}, []string{"status"})
+	CommentsRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "forum_comments_rejected_total",
+		Help: "Number of comments rejected as spam.",
+	})
+	Reactions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "forum_reactions_total",
+		Help: "Number of likes and dislikes added and removed.",
+	}, []string{"kind", "action"})
+	ComplaintsFiled = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "forum_complaints_filed_total",
+		Help: "Number of complaints filed.",
+	})
+	ModerationActions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "forum_moderation_actions_total",
+		Help: "Number of comments approved or deleted and complaints upheld or dismissed.",
+	}, []string{"action"})
+
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "forum_rate_limited_requests_total",
+		Help: "Number of requests rejected by the rate limiter.",
+	}, []string{"route", "budget"})
+
+	WebSocketConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "forum_websocket_connections",
+		Help: "Number of open WebSocket connections.",
+	})
+	WebSocketMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "forum_websocket_messages_total",
+		Help: "Number of WebSocket messages received (in) and sent (out).",
+	}, []string{"direction"})
+	WebSocketDisconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "forum_websocket_disconnects_total",
+		Help: "Number of closed WebSocket connections by reason.",
+	}, []string{"reason"})
+)
@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/demkowo/forum/config"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	UserIdKey   = "user_id"
+	NicknameKey = "nickname"
+	RoleKey     = "role"
+
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Auth reads the bearer token, if any, stores the user id, nickname and role
+// from its claims in the context and adds the user id to the request's log entry.
+// Browsers cannot set headers on WebSocket upgrades, so these may pass the
+// token as ?access_token= instead. Requests without a valid token pass
+// through anonymously. Tokens are checked against the secret cfg returns.
+func Auth(cfg config.Getter) gin.HandlerFunc {
+	log.Trace()
+
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		tokenStr, found := strings.CutPrefix(header, "Bearer ")
+		if !found && c.IsWebsocket() {
+			tokenStr, found = c.Query("access_token"), true
+		}
+		if !found || tokenStr == "" {
+			c.Next()
+			return
+		}
+
+		claims := jwt.MapClaims{}
+		_, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+			return []byte(cfg().Auth.JWTSecret), nil
+		}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+		if err != nil {
+			logger.FromContext(c.Request.Context()).Warnf("invalid token: %v", err)
+			c.Next()
+			return
+		}
+
+		userId, _ := claims["user_id"].(string)
+		if userId == "" {
+			userId, _ = claims.GetSubject()
+		}
+		nickname, _ := claims["nickname"].(string)
+		role, _ := claims["role"].(string)
+
+		c.Set(UserIdKey, userId)
+		c.Set(NicknameKey, nickname)
+		c.Set(RoleKey, role)
+		c.Request = c.Request.WithContext(logger.WithFields(c.Request.Context(), log.Fields{"user_id": userId}))
+		c.Next()
+	}
+}
+
+// UserId returns the authenticated user id, or "" for anonymous requests.
+func UserId(c *gin.Context) string {
+	return c.GetString(UserIdKey)
+}
+
+// Nickname returns the nickname claim of the authenticated user, or "".
+func Nickname(c *gin.Context) string {
+	return c.GetString(NicknameKey)
+}
+
+// Role returns the role claim of the authenticated user, or "".
+func Role(c *gin.Context) string {
+	return c.GetString(RoleKey)
+}
+
+// RequireNickname rejects anonymous requests with 401 and tokens without a
+// nickname claim with 403, for routes that act as the user.
+func RequireNickname() gin.HandlerFunc {
+	log.Trace()
+
+	return func(c *gin.Context) {
+		if UserId(c) == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		if Nickname(c) == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Token has no nickname"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireSelf rejects anonymous requests with 401 and requests whose
+// nickname claim is not the path parameter param with 403.
+func RequireSelf(param string) gin.HandlerFunc {
+	log.Trace()
+
+	return func(c *gin.Context) {
+		if UserId(c) == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		if nickname := Nickname(c); nickname == "" || nickname != c.Param(param) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Not allowed for this user"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireRole rejects anonymous requests with 401 and requests of users
+// without one of the roles with 403.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	log.Trace()
+
+	return func(c *gin.Context) {
+		if UserId(c) == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		if !slices.Contains(roles, Role(c)) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient role"})
+			return
+		}
+
+		c.Next()
+	}
+}
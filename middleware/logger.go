@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/demkowo/forum/tracing"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	RequestIdHeader = "X-Request-ID"
+	RequestIdKey    = "request_id"
+)
+
+// requestIdPattern limits the ids taken from clients to what is safe to put
+// into logs and response headers.
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// Logger assigns every request an id, taken from X-Request-ID when the client
+// or a proxy sent a valid one, and echoes it in the response. The request
+// context carries a log entry with the id, method, route and the trace id of
+// the span started by Tracing, which handlers, services and repositories log
+// with. When the request is done, Logger writes its access log line with the
+// same entry.
+func Logger() gin.HandlerFunc {
+	log.Trace()
+
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestId := c.GetHeader(RequestIdHeader)
+		if !requestIdPattern.MatchString(requestId) {
+			requestId = uuid.NewString()
+		}
+		c.Set(RequestIdKey, requestId)
+		c.Header(RequestIdHeader, requestId)
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		fields := log.Fields{
+			"request_id": requestId,
+			"method":     c.Request.Method,
+			"route":      route,
+		}
+		if traceId := tracing.TraceId(c.Request.Context()); traceId != "" {
+			fields["trace_id"] = traceId
+		}
+		ctx := logger.WithFields(c.Request.Context(), fields)
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		entry := logger.FromContext(c.Request.Context()).WithFields(log.Fields{
+			"path":       c.Request.URL.Path,
+			"status":     c.Writer.Status(),
+			"bytes":      max(c.Writer.Size(), 0),
+			"latency_ms": time.Since(start).Milliseconds(),
+			"client_ip":  c.ClientIP(),
+		})
+		if len(c.Errors) > 0 {
+			entry = entry.WithField("errors", c.Errors.String())
+		}
+
+		switch status := c.Writer.Status(); {
+		case status >= 500:
+			entry.Error("request completed")
+		case status >= 400:
+			entry.Warn("request completed")
+		default:
+			entry.Info("request completed")
+		}
+	}
+}
+
+// RequestId returns the id Logger assigned to the request.
+func RequestId(c *gin.Context) string {
+	return c.GetString(RequestIdKey)
+}
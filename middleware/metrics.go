@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/demkowo/forum/metrics"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+)
+
+// Metrics observes the duration of every request by method, route pattern
+// and status code. Requests that match no route share the route
+// "unmatched", so scanners cannot add label values.
+func Metrics() gin.HandlerFunc {
+	log.Trace()
+
+	return func(c *gin.Context) {
+		timer := prometheus.NewTimer(prometheus.ObserverFunc(func(seconds float64) {
+			route := c.FullPath()
+			if route == "" {
+				route = "unmatched"
+			}
+			metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Observe(seconds)
+		}))
+		defer timer.ObserveDuration()
+
+		c.Next()
+	}
+}
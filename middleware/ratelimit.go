@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/demkowo/forum/metrics"
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// Budget is a token bucket refilled with Rate tokens per second up to Burst.
+type Budget struct {
+	Name  string
+	Rate  float64
+	Burst int
+}
+
+// Store keeps token buckets. Implementations backed by shared storage let
+// several replicas enforce one budget.
+type Store interface {
+	Take(key string, budget Budget, now time.Time) (allowed bool, retryAfter time.Duration)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	budget Budget
+}
+
+type memoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryStore() Store {
+	log.Trace()
+
+	return &memoryStore{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *memoryStore) Take(key string, budget Budget, now time.Time) (bool, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+
+	b, found := s.buckets[key]
+	if !found {
+		b = &bucket{tokens: float64(budget.Burst), last: now, budget: budget}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(budget.Burst), b.tokens+now.Sub(b.last).Seconds()*budget.Rate)
+	b.last = now
+	b.budget = budget
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - b.tokens) / budget.Rate * float64(time.Second))
+}
+
+// sweep drops buckets that have refilled completely, they would be
+// recreated in the same state.
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*b.budget.Rate >= float64(b.budget.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// RateLimit throttles /api/ requests per user, falling back to the client IP
+// for anonymous requests. Routes listed in writes ("METHOD /full/path") share
+// the write budget, every other route uses the read budget. The budgets are
+// asked for on every request, so they can change at runtime.
+func RateLimit(store Store, budgets func() (read Budget, write Budget), writes []string) gin.HandlerFunc {
+	log.Trace()
+
+	writeRoutes := make(map[string]struct{}, len(writes))
+	for _, route := range writes {
+		writeRoutes[route] = struct{}{}
+	}
+
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if !strings.HasPrefix(route, "/api/") {
+			c.Next()
+			return
+		}
+
+		read, write := budgets()
+		budget := read
+		if _, found := writeRoutes[c.Request.Method+" "+route]; found {
+			budget = write
+		}
+
+		client := UserId(c)
+		if client == "" {
+			client = "ip:" + c.ClientIP()
+		}
+
+		allowed, retryAfter := store.Take(budget.Name+":"+client, budget, time.Now())
+		if !allowed {
+			metrics.RateLimited.WithLabelValues(route, budget.Name).Inc()
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded"})
+			return
+		}
+
+		c.Next()
+	}
+}
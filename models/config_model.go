@@ -1,47 +1,59 @@
-package model
-
-import (
-	"os"
-
-	log "github.com/sirupsen/logrus"
-)
-
-var (
-	Config configInterface = &ConfigStruct{}
-	theme  string
-)
-
-type configInterface interface {
-	Get() *ConfigStruct
-	Set(*ConfigStruct)
-}
-
-type ConfigStruct struct {
-	Logrus LogrusConfig `yaml:"logrus"`
-}
-
-type LogrusConfig struct {
-	Output   []string `yaml:"output"`
-	Reporter bool     `yaml:"reporter"`
-	Format   string   `yaml:"format"`
-	Path     string   `yaml:"path"`
-	Level    int      `yaml:"level"`
-	LogFile  *os.File
-}
-
-func (c *ConfigStruct) Get() *ConfigStruct {
-	log.Trace()
-
-	return c
-}
-
-func (c *ConfigStruct) Set(cfg *ConfigStruct) {
-	log.Trace()
-
-	c.Logrus.Output = cfg.Logrus.Output
-	c.Logrus.Reporter = cfg.Logrus.Reporter
-	c.Logrus.Format = cfg.Logrus.Format
-	c.Logrus.Path = cfg.Logrus.Path
-	c.Logrus.Level = cfg.Logrus.Level
-	c.Logrus.LogFile = cfg.Logrus.LogFile
-}
+package model
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	Config configInterface = &ConfigStruct{}
+	theme  string
+)
+
+type configInterface interface {
+	Get() *ConfigStruct
+	Set(*ConfigStruct)
+}
+
+type ConfigStruct struct {
+	Logrus LogrusConfig `yaml:"logrus"`
+}
+
+// LogrusConfig configures logrus. The file output rotates once it reaches
+// MaxSize megabytes or every RotateEvery, keeps at most MaxFiles rotated
+// files no older than MaxAge and gzips them if Compress is set. Zero
+// disables a limit.
+type LogrusConfig struct {
+	Output      []string      `yaml:"output"`
+	Reporter    bool          `yaml:"reporter"`
+	Format      string        `yaml:"format"`
+	Path        string        `yaml:"path"`
+	Level       int           `yaml:"level"`
+	MaxSize     int           `yaml:"max_size"`
+	RotateEvery time.Duration `yaml:"rotate_every"`
+	MaxAge      time.Duration `yaml:"max_age"`
+	MaxFiles    int           `yaml:"max_files"`
+	Compress    bool          `yaml:"compress"`
+}
+
+func (c *ConfigStruct) Get() *ConfigStruct {
+	log.Trace()
+
+	return c
+}
+
+func (c *ConfigStruct) Set(cfg *ConfigStruct) {
+	log.Trace()
+
+	c.Logrus.Output = cfg.Logrus.Output
+	c.Logrus.Reporter = cfg.Logrus.Reporter
+	c.Logrus.Format = cfg.Logrus.Format
+	c.Logrus.Path = cfg.Logrus.Path
+	c.Logrus.Level = cfg.Logrus.Level
+	c.Logrus.MaxSize = cfg.Logrus.MaxSize
+	c.Logrus.RotateEvery = cfg.Logrus.RotateEvery
+	c.Logrus.MaxAge = cfg.Logrus.MaxAge
+	c.Logrus.MaxFiles = cfg.Logrus.MaxFiles
+	c.Logrus.Compress = cfg.Logrus.Compress
+}
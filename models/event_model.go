@@ -0,0 +1,64 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	EventCommentCreated     = "comment.created"
+	EventCommentDeleted     = "comment.deleted"
+	EventCommentApproved    = "comment.approved"
+	EventLikeAdded          = "like.added"
+	EventLikeRemoved        = "like.removed"
+	EventDislikeAdded       = "dislike.added"
+	EventDislikeRemoved     = "dislike.removed"
+	EventComplaintCreated   = "complaint.created"
+	EventComplaintDeleted   = "complaint.deleted"
+	EventComplaintUpheld    = "complaint.upheld"
+	EventComplaintDismissed = "complaint.dismissed"
+)
+
+var EventTypes = []string{
+	EventCommentCreated,
+	EventCommentDeleted,
+	EventCommentApproved,
+	EventLikeAdded,
+	EventLikeRemoved,
+	EventDislikeAdded,
+	EventDislikeRemoved,
+	EventComplaintCreated,
+	EventComplaintDeleted,
+	EventComplaintUpheld,
+	EventComplaintDismissed,
+}
+
+// Event describes a change in the forum. Id is the idempotency key
+// consumers use to drop redeliveries, Sequence is the outbox position.
+type Event struct {
+	Id        uuid.UUID       `json:"id"`
+	Sequence  int64           `json:"sequence"`
+	Type      string          `json:"type"`
+	CommentId uuid.UUID       `json:"comment_id"`
+	ArticleId uuid.UUID       `json:"article_id"`
+	ThreadId  uuid.UUID       `json:"thread_id"`
+	Data      json.RawMessage `json:"data"`
+	Created   time.Time       `json:"created"`
+}
+
+// StreamMessage is a change pushed to the readers of an article. Id is the
+// sequence of the event it was built from and resumes the stream.
+type StreamMessage struct {
+	Id    int64       `json:"id"`
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+// Reactions carries the current like and dislike counts of a comment.
+type Reactions struct {
+	CommentId uuid.UUID `json:"comment_id"`
+	Likes     int       `json:"likes"`
+	Dislikes  int       `json:"dislikes"`
+}
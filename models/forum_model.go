@@ -6,15 +6,25 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	ComplaintOpen      = "open"
+	ComplaintUpheld    = "upheld"
+	ComplaintDismissed = "dismissed"
+)
+
 type Comment struct {
-	Id        uuid.UUID `json:"id"`
-	ArticleId uuid.UUID `json:"article_id"`
-	ThreadId  uuid.UUID `json:"thread_id"`
-	ParentId  uuid.UUID `json:"parent_id"`
-	Author    string    `json:"author"`
-	Content   string    `json:"content"`
-	Created   time.Time `json:"created"`
-	Deleted   bool      `json:"deleted"`
+	Id          uuid.UUID `json:"id"`
+	ArticleId   uuid.UUID `json:"article_id"`
+	ThreadId    uuid.UUID `json:"thread_id"`
+	ParentId    uuid.UUID `json:"parent_id"`
+	Author      string    `json:"author"`
+	Content     string    `json:"content"`
+	ContentHTML string    `json:"content_html"`
+	Created     time.Time `json:"created"`
+	Deleted     bool      `json:"deleted"`
+	Held        bool      `json:"held"`
+	SpamScore   float64   `json:"spam_score"`
+	Mentions    []string  `json:"mentions"`
 }
 
 type Like struct {
@@ -34,4 +44,81 @@ type Complaint struct {
 	CommentId uuid.UUID `json:"comment_id"`
 	UserId    uuid.UUID `json:"user_id"`
 	Message   string    `json:"message"`
+	Status    string    `json:"status"`
+	Weight    float64   `json:"weight"`
+	Created   time.Time `json:"created"`
+}
+
+// CommentSearch is a full-text query with optional filters. Zero values
+// are not applied.
+type CommentSearch struct {
+	Query     string
+	ArticleId uuid.UUID
+	Author    string
+	From      time.Time
+	To        time.Time
+	Limit     int
+	Offset    int
+}
+
+// CommentSearchResult is a matching comment with its rank and a snippet of
+// the content in which matches are wrapped in <mark>.
+type CommentSearchResult struct {
+	Comment
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+const (
+	SortCreated    = "created"
+	SortScore      = "score"
+	SortLikes      = "likes"
+	SortComplaints = "complaints"
+	SortSpamScore  = "spam_score"
+)
+
+var CommentSortFields = []string{SortCreated, SortScore, SortLikes, SortComplaints, SortSpamScore}
+
+// CommentFilter selects a page of comments for the admin listing. Zero and
+// nil values are not applied.
+type CommentFilter struct {
+	ArticleId     uuid.UUID
+	Author        string
+	From          time.Time
+	To            time.Time
+	Deleted       *bool
+	Held          *bool
+	HasComplaints *bool
+	MinScore      *int
+	MinSpamScore  *float64
+	Sort          string
+	Ascending     bool
+	Limit         int
+	Offset        int
+}
+
+// CommentListItem is a comment with its reaction and complaint counts.
+// Score is likes minus dislikes, ComplaintWeight the sum of the complaint
+// weights.
+type CommentListItem struct {
+	Comment
+	Likes           int     `json:"likes"`
+	Dislikes        int     `json:"dislikes"`
+	Complaints      int     `json:"complaints"`
+	ComplaintWeight float64 `json:"complaint_weight"`
+	Score           int     `json:"score"`
+}
+
+// UserStats summarizes a user's activity. Activity times are nil for users
+// who never commented.
+type UserStats struct {
+	Nickname         string     `json:"nickname"`
+	Comments         int        `json:"comments"`
+	LikesReceived    int        `json:"likes_received"`
+	DislikesReceived int        `json:"dislikes_received"`
+	Karma            int        `json:"karma"`
+	LikesGiven       int        `json:"likes_given"`
+	DislikesGiven    int        `json:"dislikes_given"`
+	FirstActivity    *time.Time `json:"first_activity"`
+	LastActivity     *time.Time `json:"last_activity"`
 }
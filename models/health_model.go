@@ -0,0 +1,25 @@
+package model
+
+const (
+	HealthOk       = "ok"
+	HealthFailing  = "failing"
+	HealthDraining = "draining"
+)
+
+// HealthCheck is the result of one readiness check. Error is empty when
+// Status is HealthOk. An optional check does not affect the readiness.
+type HealthCheck struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	Optional   bool    `json:"optional,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Readiness is HealthOk when every check that is not optional passed. While the server drains it
+// is HealthDraining and the checks are skipped.
+type Readiness struct {
+	Status     string        `json:"status"`
+	Checks     []HealthCheck `json:"checks"`
+	DurationMs float64       `json:"duration_ms"`
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"github.com/google/uuid"
+)
+
+const (
+	LiveSubscribe      = "subscribe"
+	LiveUnsubscribe    = "unsubscribe"
+	LiveTyping         = "typing"
+	LiveComment        = "comment"
+	LiveCommentDeleted = "comment.deleted"
+	LiveReaction       = "reaction"
+	LiveError          = "error"
+)
+
+// LiveCommand is sent by WebSocket clients: subscribe to or unsubscribe
+// from a thread, or announce that the user is typing in it.
+type LiveCommand struct {
+	Type     string    `json:"type"`
+	ThreadId uuid.UUID `json:"thread_id"`
+}
+
+// LiveMessage is sent to WebSocket clients subscribed to ThreadId. Data is a
+// Comment, ReactionDelta, Presence or error description depending on Type.
+type LiveMessage struct {
+	Type     string      `json:"type"`
+	Sequence int64       `json:"sequence,omitempty"`
+	ThreadId uuid.UUID   `json:"thread_id"`
+	Data     interface{} `json:"data"`
+}
+
+// ReactionDelta is a change of a comment's like or dislike count by +1 or -1.
+type ReactionDelta struct {
+	CommentId uuid.UUID `json:"comment_id"`
+	Kind      string    `json:"kind"`
+	Delta     int       `json:"delta"`
+}
+
+// Presence tells the readers of a thread that a user is typing.
+type Presence struct {
+	ArticleId uuid.UUID `json:"article_id"`
+	ThreadId  uuid.UUID `json:"thread_id"`
+	UserId    uuid.UUID `json:"user_id"`
+	Nickname  string    `json:"nickname"`
+}
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	NotificationReply   = "reply"
+	NotificationMention = "mention"
+	NotificationLike    = "like"
+)
+
+type Notification struct {
+	Id        uuid.UUID `json:"id"`
+	Recipient string    `json:"recipient"`
+	Kind      string    `json:"kind"`
+	CommentId uuid.UUID `json:"comment_id"`
+	ThreadId  uuid.UUID `json:"thread_id"`
+	Actors    []string  `json:"actors"`
+	Count     int       `json:"count"`
+	Message   string    `json:"message"`
+	Read      bool      `json:"read"`
+	Created   time.Time `json:"created"`
+	Updated   time.Time `json:"updated"`
+}
+
+type NotificationPreferences struct {
+	Nickname     string      `json:"nickname"`
+	MutedKinds   []string    `json:"muted_kinds"`
+	MutedThreads []uuid.UUID `json:"muted_threads"`
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserExport is all forum data tied to a user: their comments, including
+// deleted and held ones, reactions and complaints.
+type UserExport struct {
+	UserId     uuid.UUID   `json:"user_id"`
+	Nickname   string      `json:"nickname"`
+	Exported   time.Time   `json:"exported"`
+	Comments   []Comment   `json:"comments"`
+	Likes      []Like      `json:"likes"`
+	Dislikes   []Dislike   `json:"dislikes"`
+	Complaints []Complaint `json:"complaints"`
+}
+
+// Erasure records that a user's data was erased and how much of it.
+// RequestedBy is nil for erasures run from the command line.
+type Erasure struct {
+	Id          uuid.UUID `json:"id"`
+	UserId      uuid.UUID `json:"user_id"`
+	RequestedBy uuid.UUID `json:"requested_by"`
+	Comments    int       `json:"comments"`
+	Likes       int       `json:"likes"`
+	Dislikes    int       `json:"dislikes"`
+	Complaints  int       `json:"complaints"`
+	Created     time.Time `json:"created"`
+}
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"time"
+)
+
+// Reputation of a user. Score is computed from the counters and the time
+// since FirstSeen, the user's first comment, which is nil before it.
+type Reputation struct {
+	Nickname         string     `json:"nickname"`
+	LikesReceived    int        `json:"likes_received"`
+	DislikesReceived int        `json:"dislikes_received"`
+	ComplaintsUpheld int        `json:"complaints_upheld"`
+	FirstSeen        *time.Time `json:"first_seen"`
+	Score            float64    `json:"score"`
+	Trusted          bool       `json:"trusted"`
+}
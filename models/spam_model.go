@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SpamSample struct {
+	CommentId uuid.UUID `json:"comment_id"`
+	Content   string    `json:"content"`
+	Spam      bool      `json:"spam"`
+	Created   time.Time `json:"created"`
+}
+
+type SpamToken struct {
+	Token string `json:"token"`
+	Spam  int    `json:"spam"`
+	Ham   int    `json:"ham"`
+}
+
+type SpamModel struct {
+	SpamDocs int                  `json:"spam_docs"`
+	HamDocs  int                  `json:"ham_docs"`
+	Tokens   map[string]SpamToken `json:"-"`
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+)
+
+type Webhook struct {
+	Id      uuid.UUID `json:"id"`
+	URL     string    `json:"url"`
+	Events  []string  `json:"events"`
+	Secret  string    `json:"secret,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+type WebhookDelivery struct {
+	Id          uuid.UUID       `json:"id"`
+	WebhookId   uuid.UUID       `json:"webhook_id"`
+	EventId     uuid.UUID       `json:"event_id"`
+	EventType   string          `json:"event_type"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"last_error"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	Created     time.Time       `json:"created"`
+	URL         string          `json:"-"`
+	Secret      string          `json:"-"`
+}
@@ -0,0 +1,110 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+)
+
+// fakeDB is a database/sql driver that answers every statement with handle,
+// so repositories can be tested without Postgres. Transactions are not
+// isolated: statements take effect when they run and rollbacks undo nothing.
+type fakeDB struct {
+	mu     sync.Mutex
+	handle func(query string, args []driver.Value) (*fakeRows, error)
+}
+
+// fakeRows is the answer to a statement. Statements run with Exec report
+// affected rows.
+type fakeRows struct {
+	columns  []string
+	values   [][]driver.Value
+	affected int64
+	next     int
+}
+
+func openFakeDB(handle func(query string, args []driver.Value) (*fakeRows, error)) *sql.DB {
+	return sql.OpenDB(&fakeDB{handle: handle})
+}
+
+func (db *fakeDB) Connect(ctx context.Context) (driver.Conn, error) {
+	return &fakeConn{db: db}, nil
+}
+
+func (db *fakeDB) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+func (db *fakeDB) run(query string, args []driver.NamedValue) (*fakeRows, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	rows, err := db.handle(query, values)
+	if rows == nil && err == nil {
+		rows = &fakeRows{}
+	}
+	return rows, err
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("fakeDB is opened with sql.OpenDB")
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fakeDB does not prepare statements")
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	rows, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(rows.affected), nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.db.run(query, args)
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+func (r *fakeRows) Columns() []string {
+	return r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.next])
+	r.next++
+	return nil
+}
@@ -1,32 +1,52 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"time"
 
 	model "github.com/demkowo/forum/models"
+	logger "github.com/demkowo/forum/utils/logger"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 )
 
 const (
+	SEARCH_MARK_START         = "\uE000"
+	SEARCH_MARK_STOP          = "\uE001"
 	CHECK_IF_EXIST_COMMENTS   = "SELECT to_regclass('public.comments')"
 	CHECK_IF_EXIST_LIKES      = "SELECT to_regclass('public.likes')"
 	CHECK_IF_EXIST_DISLIKES   = "SELECT to_regclass('public.dislikes')"
 	CHECK_IF_EXIST_COMPLAINTS = "SELECT to_regclass('public.complaints')"
+	CHECK_IF_EXIST_MENTIONS   = "SELECT to_regclass('public.comment_mentions')"
 	CREATE_TABLE_COMMENTS     = `CREATE TABLE comments (
     id UUID PRIMARY KEY,
     article_id UUID NOT NULL,
 	thread_id UUID NOT NULL,
     parent_id UUID,
-    author varchar(255) NOT NULL,
+    author varchar(255),
     content TEXT NOT NULL,
     created TIMESTAMP WITH TIME ZONE NOT NULL,
     deleted BOOLEAN NOT NULL DEFAULT FALSE,
+    held BOOLEAN NOT NULL DEFAULT FALSE,
+    spam_score DOUBLE PRECISION NOT NULL DEFAULT 0,
     FOREIGN KEY (parent_id) REFERENCES comments(id),
     FOREIGN KEY (article_id) REFERENCES articles(id),
     FOREIGN KEY (author) REFERENCES users(nickname)
 	);`
+	ALTER_TABLE_COMMENTS = `ALTER TABLE comments
+    ADD COLUMN IF NOT EXISTS held BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS spam_score DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ALTER COLUMN author DROP NOT NULL;`
+	CREATE_INDEXES_COMMENTS = `
+    CREATE INDEX IF NOT EXISTS comments_author_created_idx ON comments (author, created DESC);
+    CREATE INDEX IF NOT EXISTS comments_article_created_idx ON comments (article_id, created DESC);`
+	ALTER_TABLE_COMMENTS_SEARCH = `ALTER TABLE comments
+    ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (to_tsvector(%s::regconfig, content)) STORED;
+    CREATE INDEX IF NOT EXISTS comments_search_idx ON comments USING GIN (search);`
 	CREATE_TABLE_LIKES = `CREATE TABLE likes (
     id UUID PRIMARY KEY,
     comment_id UUID NOT NULL,
@@ -48,50 +68,107 @@ const (
     comment_id UUID NOT NULL,
     user_id UUID NOT NULL,
     message TEXT,
+    status varchar(16) NOT NULL DEFAULT 'open',
+    weight DOUBLE PRECISION NOT NULL DEFAULT 1,
+    created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
     FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE,
     FOREIGN KEY (user_id) REFERENCES users(id),
     UNIQUE (comment_id, user_id)
 	);`
+	CREATE_INDEXES_LIKES      = `CREATE INDEX IF NOT EXISTS likes_user_idx ON likes (user_id);`
+	CREATE_INDEXES_DISLIKES   = `CREATE INDEX IF NOT EXISTS dislikes_user_idx ON dislikes (user_id);`
+	CREATE_INDEXES_COMPLAINTS = `
+    CREATE INDEX IF NOT EXISTS complaints_user_created_idx ON complaints (user_id, created DESC);
+    DROP INDEX IF EXISTS complaints_user_idx;`
+	ALTER_TABLE_COMPLAINTS = `ALTER TABLE complaints
+    ADD COLUMN IF NOT EXISTS status varchar(16) NOT NULL DEFAULT 'open',
+    ADD COLUMN IF NOT EXISTS weight DOUBLE PRECISION NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS created TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();`
+	CREATE_TABLE_MENTIONS = `CREATE TABLE comment_mentions (
+    comment_id UUID NOT NULL,
+    nickname varchar(255) NOT NULL,
+    PRIMARY KEY (comment_id, nickname),
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE,
+    FOREIGN KEY (nickname) REFERENCES users(nickname)
+	);
+	CREATE INDEX comment_mentions_nickname_idx ON comment_mentions (nickname);`
 )
 
+// RecentComments finds the recent comments a new comment is checked
+// against for flooding.
+type RecentComments interface {
+	FindRecentCommentsByAuthor(ctx context.Context, author string, since time.Time) ([]model.Comment, error)
+	FindRecentCommentsByArticle(ctx context.Context, articleId uuid.UUID, since time.Time) ([]model.Comment, error)
+}
+
 type ForumRepo interface {
+	RecentComments
+
 	CreateTableComments() string
 	CreateTableLikes() string
 	CreateTableDislikes() string
 	CreateTableComplaints() string
-
-	AddComment(comment model.Comment) error
-	DeleteComment(commentId uuid.UUID) error
-	GetComment(commentId uuid.UUID) (*model.Comment, error)
-	FindComments() ([]model.Comment, error)
-	FindCommentsByArticle(articleId uuid.UUID) ([]model.Comment, error)
-	CountCommentsByArticle(articleId uuid.UUID) (int, error)
-
-	AddLike(like model.Like) error
-	DeleteLike(like model.Like) error
-	FindLikesByComment(commentId uuid.UUID) ([]model.Like, error)
-	CountLikes(commentId uuid.UUID) (int, error)
-
-	AddDislike(dislike model.Dislike) error
-	DeleteDislike(model.Dislike) error
-	FindDislikesByComment(commentId uuid.UUID) ([]model.Dislike, error)
-	CountDislikes(commentId uuid.UUID) (int, error)
-
-	AddComplaint(model.Complaint) error
-	DeleteComplaint(uuid.UUID) error
-	FindComplaintsByComment(commentId uuid.UUID) ([]model.Complaint, error)
-	CountComplaints(commentId uuid.UUID) (int, error)
+	CreateTableMentions() string
+
+	AddComment(ctx context.Context, comment model.Comment, check func(recent RecentComments) error, events ...model.Event) error
+	DeleteComment(ctx context.Context, commentId uuid.UUID, events ...model.Event) error
+	GetComment(ctx context.Context, commentId uuid.UUID) (*model.Comment, error)
+	ListComments(ctx context.Context, filter model.CommentFilter) ([]model.CommentListItem, int, error)
+	FindCommentsByArticle(ctx context.Context, articleId uuid.UUID) ([]model.Comment, error)
+	CountCommentsByArticle(ctx context.Context, articleId uuid.UUID) (int, error)
+	FindHeldComments(ctx context.Context) ([]model.Comment, error)
+	ApproveComment(ctx context.Context, commentId uuid.UUID, events ...model.Event) error
+	FindCommentsMentioning(ctx context.Context, nickname string) ([]model.Comment, error)
+	FindExistingNicknames(ctx context.Context, nicknames []string) ([]string, error)
+	SearchComments(ctx context.Context, search model.CommentSearch) ([]model.CommentSearchResult, int, error)
+
+	AddLike(ctx context.Context, like model.Like, events ...model.Event) (bool, error)
+	DeleteLike(ctx context.Context, like model.Like, events ...model.Event) error
+	FindLikesByComment(ctx context.Context, commentId uuid.UUID) ([]model.Like, error)
+	CountLikes(ctx context.Context, commentId uuid.UUID) (int, error)
+
+	AddDislike(ctx context.Context, dislike model.Dislike, events ...model.Event) (bool, error)
+	DeleteDislike(ctx context.Context, dislike model.Dislike, events ...model.Event) error
+	FindDislikesByComment(ctx context.Context, commentId uuid.UUID) ([]model.Dislike, error)
+	CountDislikes(ctx context.Context, commentId uuid.UUID) (int, error)
+
+	AddComplaint(ctx context.Context, complaint model.Complaint, events ...model.Event) (bool, error)
+	DeleteComplaint(ctx context.Context, id uuid.UUID, events ...model.Event) error
+	GetComplaint(ctx context.Context, id uuid.UUID) (*model.Complaint, error)
+	UpdateComplaintStatus(ctx context.Context, id uuid.UUID, from, to string, events ...model.Event) error
+	FindComplaintsByComment(ctx context.Context, commentId uuid.UUID) ([]model.Complaint, error)
+	CountComplaints(ctx context.Context, commentId uuid.UUID) (int, error)
+
+	FindCommentsByAuthor(ctx context.Context, author string, limit, offset int) ([]model.Comment, int, error)
+	FindCommentsLikedBy(ctx context.Context, nickname string, limit, offset int) ([]model.Comment, int, error)
+	FindCommentsDislikedBy(ctx context.Context, nickname string, limit, offset int) ([]model.Comment, int, error)
+	FindComplaintsByUser(ctx context.Context, nickname string, limit, offset int) ([]model.Complaint, int, error)
+	GetUserStats(ctx context.Context, nickname string) (*model.UserStats, error)
 }
 
+// forumRepo writes to db. The Find*, Count*, List* and Search* methods that
+// serve listings read from replica, which may lag behind; the reads that guard
+// writes, such as flood detection and Get*, stay on db.
 type forumRepo struct {
-	db *sql.DB
+	db       *sql.DB
+	replica  *sql.DB
+	language string
 }
 
-func NewForum(db *sql.DB) ForumRepo {
+// NewForum returns the forum repository. replica may be nil, then every
+// query goes to db. language is the text search configuration of the
+// search column and queries.
+func NewForum(db *sql.DB, replica *sql.DB, language string) ForumRepo {
 	log.Trace()
 
+	if replica == nil {
+		replica = db
+	}
+
 	return &forumRepo{
-		db: db,
+		db:       db,
+		replica:  replica,
+		language: language,
 	}
 }
 
@@ -113,6 +190,13 @@ func (r *forumRepo) CreateTableComments() string {
 	}
 
 	if tableName.Valid {
+		if _, err := r.db.Exec(ALTER_TABLE_COMMENTS); err != nil {
+			log.Panicf("ALTER_TABLE_COMMENTS failed: %v", err)
+		}
+		if _, err := r.db.Exec(CREATE_INDEXES_COMMENTS); err != nil {
+			log.Panicf("CREATE_INDEXES_COMMENTS failed: %v", err)
+		}
+		r.addSearchColumn()
 		return "DB comments ready to go"
 	}
 
@@ -121,10 +205,25 @@ func (r *forumRepo) CreateTableComments() string {
 		log.Panicf("CREATE_TABLE_COMMENTS failed: %v", err)
 	}
 
+	if _, err := r.db.Exec(CREATE_INDEXES_COMMENTS); err != nil {
+		log.Panicf("CREATE_INDEXES_COMMENTS failed: %v", err)
+	}
+	r.addSearchColumn()
+
 	return "Table comments created, DB ready to go"
 
 }
 
+// addSearchColumn adds the full-text search vector of the content, built
+// with the SEARCH_LANGUAGE text search configuration. The column keeps the
+// configuration it was created with; to switch, drop the column and restart.
+func (r *forumRepo) addSearchColumn() {
+	query := fmt.Sprintf(ALTER_TABLE_COMMENTS_SEARCH, pq.QuoteLiteral(r.language))
+	if _, err := r.db.Exec(query); err != nil {
+		log.Panicf("ALTER_TABLE_COMMENTS_SEARCH failed: %v", err)
+	}
+}
+
 func (r *forumRepo) CreateTableLikes() string {
 	log.Trace()
 
@@ -143,6 +242,9 @@ func (r *forumRepo) CreateTableLikes() string {
 	}
 
 	if tableName.Valid {
+		if _, err := r.db.Exec(CREATE_INDEXES_LIKES); err != nil {
+			log.Panicf("CREATE_INDEXES_LIKES failed: %v", err)
+		}
 		return "DB likes ready to go"
 	}
 
@@ -151,6 +253,10 @@ func (r *forumRepo) CreateTableLikes() string {
 		log.Panicf("CREATE_TABLE_LIKES failed: %v", err)
 	}
 
+	if _, err := r.db.Exec(CREATE_INDEXES_LIKES); err != nil {
+		log.Panicf("CREATE_INDEXES_LIKES failed: %v", err)
+	}
+
 	return "Table likes created, DB ready to go"
 
 }
@@ -173,6 +279,9 @@ func (r *forumRepo) CreateTableDislikes() string {
 	}
 
 	if tableName.Valid {
+		if _, err := r.db.Exec(CREATE_INDEXES_DISLIKES); err != nil {
+			log.Panicf("CREATE_INDEXES_DISLIKES failed: %v", err)
+		}
 		return "DB dislikes ready to go"
 	}
 
@@ -181,6 +290,10 @@ func (r *forumRepo) CreateTableDislikes() string {
 		log.Panicf("CREATE_TABLE_DISLIKES failed: %v", err)
 	}
 
+	if _, err := r.db.Exec(CREATE_INDEXES_DISLIKES); err != nil {
+		log.Panicf("CREATE_INDEXES_DISLIKES failed: %v", err)
+	}
+
 	return "Table dislikes created, DB ready to go"
 
 }
@@ -203,6 +316,12 @@ func (r *forumRepo) CreateTableComplaints() string {
 	}
 
 	if tableName.Valid {
+		if _, err := r.db.Exec(ALTER_TABLE_COMPLAINTS); err != nil {
+			log.Panicf("ALTER_TABLE_COMPLAINTS failed: %v", err)
+		}
+		if _, err := r.db.Exec(CREATE_INDEXES_COMPLAINTS); err != nil {
+			log.Panicf("CREATE_INDEXES_COMPLAINTS failed: %v", err)
+		}
 		return "DB complaints ready to go"
 	}
 
@@ -211,14 +330,34 @@ func (r *forumRepo) CreateTableComplaints() string {
 		log.Panicf("CREATE_TABLE_COMPLAINTS failed: %v", err)
 	}
 
+	if _, err := r.db.Exec(CREATE_INDEXES_COMPLAINTS); err != nil {
+		log.Panicf("CREATE_INDEXES_COMPLAINTS failed: %v", err)
+	}
+
 	return "Table complaints created, DB ready to go"
 
 }
 
-func (r *forumRepo) AddComment(comment model.Comment) error {
+func (r *forumRepo) CreateTableMentions() string {
+	log.Trace()
+
+	return createTable(r.db, "comment_mentions", CHECK_IF_EXIST_MENTIONS, CREATE_TABLE_MENTIONS)
+}
+
+// AddComment stores the comment, its mentions and events. Unless check is nil
+// it first takes transaction locks on the author and the article and runs
+// check, so concurrent comments of one author or on one article are checked
+// one after the other against the comments committed before them. check
+// reads through recent, which runs on the transaction: waiting for a second
+// connection while holding the locks could exhaust the pool. An error from
+// check is returned as is and nothing is stored.
+func (r *forumRepo) AddComment(ctx context.Context, comment model.Comment, check func(recent RecentComments) error, events ...model.Event) error {
+	log := logger.FromContext(ctx)
 	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "AddComment")
+	defer st.end()
 
-	COMMENTS_ADD := "INSERT INTO comments (id, article_id, thread_id, parent_id, author, content, created, deleted) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)"
+	COMMENTS_ADD := "INSERT INTO comments (id, article_id, thread_id, parent_id, author, content, created, deleted, held, spam_score) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)"
 	var parent interface{}
 
 	if comment.ParentId.String() == "00000000-0000-0000-0000-000000000000" {
@@ -227,21 +366,62 @@ func (r *forumRepo) AddComment(comment model.Comment) error {
 		parent = comment.ParentId
 	}
 
-	_, err := r.db.Exec(COMMENTS_ADD, comment.Id, comment.ArticleId, comment.ThreadId, parent, comment.Author, comment.Content, comment.Created, comment.Deleted)
+	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		log.Error(err)
 		return err
 	}
+	defer tx.Rollback()
+
+	if check != nil {
+		if _, err := exec(ctx, tx, `SELECT pg_advisory_xact_lock(hashtext('comments.author:' || $1))`, comment.Author); err != nil {
+			log.Error(err)
+			return err
+		}
+		if _, err := exec(ctx, tx, `SELECT pg_advisory_xact_lock(hashtext('comments.article:' || $1))`, comment.ArticleId.String()); err != nil {
+			log.Error(err)
+			return err
+		}
+		if err := check(&recentComments{repo: r, q: tx}); err != nil {
+			return err
+		}
+	}
+
+	_, err = exec(ctx, tx, COMMENTS_ADD, comment.Id, comment.ArticleId, comment.ThreadId, parent, comment.Author, comment.Content, comment.Created, comment.Deleted, comment.Held, comment.SpamScore)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	for _, nickname := range comment.Mentions {
+		_, err = exec(ctx, tx, "INSERT INTO comment_mentions (comment_id, nickname) VALUES ($1, $2) ON CONFLICT DO NOTHING", comment.Id, nickname)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+
+	if err := insertOutbox(ctx, tx, events); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		return err
+	}
 
 	return nil
 }
 
-func (r *forumRepo) DeleteComment(commentId uuid.UUID) error {
+func (r *forumRepo) DeleteComment(ctx context.Context, commentId uuid.UUID, events ...model.Event) error {
+	log := logger.FromContext(ctx)
 	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "DeleteComment")
+	defer st.end()
 
 	query := `UPDATE comments SET deleted = TRUE WHERE id = $1`
 
-	_, err := r.db.Exec(query, commentId)
+	_, err := execWithEvents(ctx, r.db, events, query, commentId)
 	if err != nil {
 		log.Error(err)
 		return err
@@ -250,17 +430,21 @@ func (r *forumRepo) DeleteComment(commentId uuid.UUID) error {
 	return nil
 }
 
-func (r *forumRepo) GetComment(commentId uuid.UUID) (*model.Comment, error) {
+func (r *forumRepo) GetComment(ctx context.Context, commentId uuid.UUID) (*model.Comment, error) {
+	log := logger.FromContext(ctx)
 	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "GetComment")
+	defer st.end()
 
 	query := `
-        SELECT id, article_id, thread_id, parent_id, author, content, created, deleted
+        SELECT id, article_id, thread_id, parent_id, COALESCE(author, ''), content, created, deleted, held, spam_score,
+            ARRAY(SELECT m.nickname FROM comment_mentions m WHERE m.comment_id = comments.id ORDER BY m.nickname)
         FROM comments
         WHERE id = $1
     `
-	row := r.db.QueryRow(query, commentId)
+	row := queryRow(ctx, r.db, query, commentId)
 	var comment model.Comment
-	err := row.Scan(&comment.Id, &comment.ArticleId, &comment.ThreadId, &comment.ParentId, &comment.Author, &comment.Content, &comment.Created, &comment.Deleted)
+	err := row.Scan(&comment.Id, &comment.ArticleId, &comment.ThreadId, &comment.ParentId, &comment.Author, &comment.Content, &comment.Created, &comment.Deleted, &comment.Held, &comment.SpamScore, pq.Array(&comment.Mentions))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Warn(err)
@@ -272,85 +456,353 @@ func (r *forumRepo) GetComment(commentId uuid.UUID) (*model.Comment, error) {
 	return &comment, nil
 }
 
-func (r *forumRepo) FindComments() ([]model.Comment, error) {
+var commentSortColumns = map[string]string{
+	model.SortCreated:    "c.created",
+	model.SortScore:      "score",
+	model.SortLikes:      "likes",
+	model.SortComplaints: "complaint_weight",
+	model.SortSpamScore:  "c.spam_score",
+}
+
+// ListComments returns one page of the comments matching the filter with
+// their counts, and the total number of matches.
+func (r *forumRepo) ListComments(ctx context.Context, filter model.CommentFilter) ([]model.CommentListItem, int, error) {
+	log := logger.FromContext(ctx)
 	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "ListComments")
+	defer st.end()
+
+	sort, ok := commentSortColumns[filter.Sort]
+	if !ok {
+		sort = commentSortColumns[model.SortCreated]
+	}
+	direction := "DESC"
+	if filter.Ascending {
+		direction = "ASC"
+	}
 
 	query := `
-        SELECT id, article_id, thread_id, parent_id, author, content, created, deleted
-        FROM comments
-        WHERE deleted = FALSE
-		ORDER by created DESC
+        SELECT c.id, c.article_id, c.thread_id, c.parent_id, COALESCE(c.author, ''), c.content, c.created, c.deleted, c.held, c.spam_score,
+            ARRAY(SELECT m.nickname FROM comment_mentions m WHERE m.comment_id = c.id ORDER BY m.nickname),
+            l.likes, d.dislikes, p.complaints, p.complaint_weight, l.likes - d.dislikes AS score,
+            COUNT(*) OVER ()
+        FROM comments c
+        CROSS JOIN LATERAL (SELECT COUNT(*) AS likes FROM likes WHERE comment_id = c.id) l
+        CROSS JOIN LATERAL (SELECT COUNT(*) AS dislikes FROM dislikes WHERE comment_id = c.id) d
+        CROSS JOIN LATERAL (SELECT COUNT(*) AS complaints, COALESCE(SUM(weight), 0) AS complaint_weight FROM complaints WHERE comment_id = c.id) p
+        WHERE ($1::uuid IS NULL OR c.article_id = $1)
+            AND ($2 = '' OR c.author = $2)
+            AND ($3::timestamptz IS NULL OR c.created >= $3)
+            AND ($4::timestamptz IS NULL OR c.created < $4)
+            AND ($5::boolean IS NULL OR c.deleted = $5)
+            AND ($6::boolean IS NULL OR c.held = $6)
+            AND ($7::boolean IS NULL OR (p.complaints > 0) = $7)
+            AND ($8::integer IS NULL OR l.likes - d.dislikes >= $8)
+            AND ($9::double precision IS NULL OR c.spam_score >= $9)
+        ORDER BY ` + sort + ` ` + direction + `, c.id
+        LIMIT $10 OFFSET $11
     `
-	rows, err := r.db.Query(query)
+	rows, err := queryRows(ctx, r.replica, query, nullUUID(filter.ArticleId), filter.Author, nullTime(filter.From), nullTime(filter.To),
+		filter.Deleted, filter.Held, filter.HasComplaints, filter.MinScore, filter.MinSpamScore, filter.Limit, filter.Offset)
 	if err != nil {
 		log.Error(err)
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
-	var comments []model.Comment
+	var items []model.CommentListItem
+	var total int
 	for rows.Next() {
-		var comment model.Comment
-		err := rows.Scan(&comment.Id, &comment.ArticleId, &comment.ThreadId, &comment.ParentId, &comment.Author, &comment.Content, &comment.Created, &comment.Deleted)
+		var item model.CommentListItem
+		err := rows.Scan(&item.Id, &item.ArticleId, &item.ThreadId, &item.ParentId, &item.Author, &item.Content, &item.Created, &item.Deleted, &item.Held, &item.SpamScore, pq.Array(&item.Mentions),
+			&item.Likes, &item.Dislikes, &item.Complaints, &item.ComplaintWeight, &item.Score, &total)
 		if err != nil {
 			log.Error(err)
-			return nil, err
+			return nil, 0, err
 		}
-		comments = append(comments, comment)
+		items = append(items, item)
 	}
-	return comments, nil
+
+	return items, total, rows.Err()
 }
 
-func (r *forumRepo) FindCommentsByArticle(articleId uuid.UUID) ([]model.Comment, error) {
+func (r *forumRepo) FindCommentsByArticle(ctx context.Context, articleId uuid.UUID) ([]model.Comment, error) {
+	log := logger.FromContext(ctx)
 	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "FindCommentsByArticle")
+	defer st.end()
 
 	query := `
-        SELECT id, article_id, thread_id, parent_id, author, content, created, deleted
+        SELECT id, article_id, thread_id, parent_id, COALESCE(author, ''), content, created, deleted, held, spam_score,
+            ARRAY(SELECT m.nickname FROM comment_mentions m WHERE m.comment_id = comments.id ORDER BY m.nickname)
         FROM comments
-        WHERE article_id = $1 AND deleted = FALSE
+        WHERE article_id = $1 AND deleted = FALSE AND held = FALSE
 		ORDER by created DESC
     `
-	rows, err := r.db.Query(query, articleId)
+	return r.findComments(ctx, r.replica, query, articleId)
+}
+
+func (r *forumRepo) CountCommentsByArticle(ctx context.Context, articleId uuid.UUID) (int, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "CountCommentsByArticle")
+	defer st.end()
+
+	query := `
+        SELECT COUNT(*)
+        FROM comments
+        WHERE article_id = $1
+    `
+	var count int
+	err := queryRow(ctx, r.replica, query, articleId).Scan(&count)
+	if err != nil {
+		log.Warn("db.QueryRow failed: ", err)
+		return 0, nil
+	}
+
+	return count, nil
+
+}
+
+func (r *forumRepo) FindHeldComments(ctx context.Context) ([]model.Comment, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "FindHeldComments")
+	defer st.end()
+
+	query := `
+        SELECT id, article_id, thread_id, parent_id, COALESCE(author, ''), content, created, deleted, held, spam_score,
+            ARRAY(SELECT m.nickname FROM comment_mentions m WHERE m.comment_id = comments.id ORDER BY m.nickname)
+        FROM comments
+        WHERE held = TRUE AND deleted = FALSE
+		ORDER by spam_score DESC, created ASC
+    `
+	return r.findComments(ctx, r.replica, query)
+}
+
+// ApproveComment publishes a held comment and stores events. It fails when
+// the comment is not held, so approving twice stores nothing.
+func (r *forumRepo) ApproveComment(ctx context.Context, commentId uuid.UUID, events ...model.Event) error {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "ApproveComment")
+	defer st.end()
+
+	query := `UPDATE comments SET held = FALSE WHERE id = $1 AND held`
+
+	rowsAffected, err := execWithEvents(ctx, r.db, events, query, commentId)
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		log.Warn("comment is not held")
+		return errors.New("comment is not held")
+	}
+
+	return nil
+}
+
+// recentComments runs the RecentComments queries on q.
+type recentComments struct {
+	repo *forumRepo
+	q    querier
+}
+
+func (c *recentComments) FindRecentCommentsByAuthor(ctx context.Context, author string, since time.Time) ([]model.Comment, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "FindRecentCommentsByAuthor")
+	defer st.end()
+
+	return c.repo.findRecentCommentsByAuthor(ctx, c.q, author, since)
+}
+
+func (c *recentComments) FindRecentCommentsByArticle(ctx context.Context, articleId uuid.UUID, since time.Time) ([]model.Comment, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "FindRecentCommentsByArticle")
+	defer st.end()
+
+	return c.repo.findRecentCommentsByArticle(ctx, c.q, articleId, since)
+}
+
+// FindRecentCommentsByAuthor returns the author's comments created after
+// since, newest first, including deleted and held ones.
+func (r *forumRepo) FindRecentCommentsByAuthor(ctx context.Context, author string, since time.Time) ([]model.Comment, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "FindRecentCommentsByAuthor")
+	defer st.end()
+
+	return r.findRecentCommentsByAuthor(ctx, r.db, author, since)
+}
+
+// FindRecentCommentsByArticle returns comments on the article created after
+// since, newest first, including deleted and held ones.
+func (r *forumRepo) FindRecentCommentsByArticle(ctx context.Context, articleId uuid.UUID, since time.Time) ([]model.Comment, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "FindRecentCommentsByArticle")
+	defer st.end()
+
+	return r.findRecentCommentsByArticle(ctx, r.db, articleId, since)
+}
+
+func (r *forumRepo) findRecentCommentsByAuthor(ctx context.Context, q querier, author string, since time.Time) ([]model.Comment, error) {
+	query := `
+        SELECT id, article_id, thread_id, parent_id, COALESCE(author, ''), content, created, deleted, held, spam_score,
+            ARRAY(SELECT m.nickname FROM comment_mentions m WHERE m.comment_id = comments.id ORDER BY m.nickname)
+        FROM comments
+        WHERE author = $1 AND created > $2
+		ORDER by created DESC
+		LIMIT 200
+    `
+	return r.findComments(ctx, q, query, author, since)
+}
+
+func (r *forumRepo) findRecentCommentsByArticle(ctx context.Context, q querier, articleId uuid.UUID, since time.Time) ([]model.Comment, error) {
+	query := `
+        SELECT id, article_id, thread_id, parent_id, COALESCE(author, ''), content, created, deleted, held, spam_score,
+            ARRAY(SELECT m.nickname FROM comment_mentions m WHERE m.comment_id = comments.id ORDER BY m.nickname)
+        FROM comments
+        WHERE article_id = $1 AND created > $2
+		ORDER by created DESC
+		LIMIT 200
+    `
+	return r.findComments(ctx, q, query, articleId, since)
+}
+
+func (r *forumRepo) FindCommentsMentioning(ctx context.Context, nickname string) ([]model.Comment, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "FindCommentsMentioning")
+	defer st.end()
+
+	query := `
+        SELECT id, article_id, thread_id, parent_id, COALESCE(author, ''), content, created, deleted, held, spam_score,
+            ARRAY(SELECT m.nickname FROM comment_mentions m WHERE m.comment_id = comments.id ORDER BY m.nickname)
+        FROM comments
+        WHERE id IN (SELECT comment_id FROM comment_mentions WHERE nickname = $1)
+            AND deleted = FALSE AND held = FALSE
+		ORDER by created DESC
+    `
+	return r.findComments(ctx, r.replica, query, nickname)
+}
+
+// FindExistingNicknames returns the subset of nicknames that belong to
+// registered users.
+func (r *forumRepo) FindExistingNicknames(ctx context.Context, nicknames []string) ([]string, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "FindExistingNicknames")
+	defer st.end()
+
+	if len(nicknames) == 0 {
+		return nil, nil
+	}
+
+	rows, err := queryRows(ctx, r.db, `SELECT nickname FROM users WHERE nickname = ANY($1)`, pq.Array(nicknames))
 	if err != nil {
 		log.Error(err)
 		return nil, err
 	}
 	defer rows.Close()
 
-	var comments []model.Comment
+	var existing []string
 	for rows.Next() {
-		var comment model.Comment
-		err := rows.Scan(&comment.Id, &comment.ArticleId, &comment.ThreadId, &comment.ParentId, &comment.Author, &comment.Content, &comment.Created, &comment.Deleted)
-		if err != nil {
+		var nickname string
+		if err := rows.Scan(&nickname); err != nil {
 			log.Error(err)
 			return nil, err
 		}
-		comments = append(comments, comment)
+		existing = append(existing, nickname)
 	}
-	return comments, nil
+
+	return existing, rows.Err()
 }
 
-func (r *forumRepo) CountCommentsByArticle(articleId uuid.UUID) (int, error) {
+// SearchComments returns one page of the non-deleted comments matching the
+// web search syntax query (words, "phrases", OR, -word), best match first,
+// and the total number of matches. Matches in the snippet are wrapped in
+// SEARCH_MARK_START and SEARCH_MARK_STOP.
+func (r *forumRepo) SearchComments(ctx context.Context, search model.CommentSearch) ([]model.CommentSearchResult, int, error) {
+	log := logger.FromContext(ctx)
 	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "SearchComments")
+	defer st.end()
 
 	query := `
-        SELECT COUNT(*)
-        FROM comments
-        WHERE article_id = $1
+        SELECT id, article_id, thread_id, parent_id, COALESCE(author, ''), content, created, deleted, held, spam_score,
+            ARRAY(SELECT m.nickname FROM comment_mentions m WHERE m.comment_id = comments.id ORDER BY m.nickname),
+            ts_rank_cd(search, q) AS rank,
+            ts_headline($1::regconfig, content, q, $2),
+            COUNT(*) OVER ()
+        FROM comments, websearch_to_tsquery($1::regconfig, $3) q
+        WHERE search @@ q AND deleted = FALSE AND held = FALSE
+            AND ($4::uuid IS NULL OR article_id = $4)
+            AND ($5 = '' OR author = $5)
+            AND ($6::timestamptz IS NULL OR created >= $6)
+            AND ($7::timestamptz IS NULL OR created < $7)
+        ORDER BY rank DESC, created DESC
+        LIMIT $8 OFFSET $9
     `
-	var count int
-	err := r.db.QueryRow(query, articleId).Scan(&count)
+	options := fmt.Sprintf("StartSel=%s, StopSel=%s, MaxFragments=2, MinWords=5, MaxWords=20", SEARCH_MARK_START, SEARCH_MARK_STOP)
+
+	rows, err := queryRows(ctx, r.replica, query, r.language, options, search.Query,
+		nullUUID(search.ArticleId), search.Author, nullTime(search.From), nullTime(search.To), search.Limit, search.Offset)
 	if err != nil {
-		log.Warn("db.QueryRow failed: ", err)
-		return 0, nil
+		log.Error(err)
+		return nil, 0, err
 	}
+	defer rows.Close()
 
-	return count, nil
+	var results []model.CommentSearchResult
+	var total int
+	for rows.Next() {
+		var result model.CommentSearchResult
+		err := rows.Scan(&result.Id, &result.ArticleId, &result.ThreadId, &result.ParentId, &result.Author, &result.Content, &result.Created, &result.Deleted, &result.Held, &result.SpamScore, pq.Array(&result.Mentions),
+			&result.Rank, &result.Snippet, &total)
+		if err != nil {
+			log.Error(err)
+			return nil, 0, err
+		}
+		results = append(results, result)
+	}
 
+	return results, total, rows.Err()
 }
 
-func (r *forumRepo) AddLike(like model.Like) error {
+func (r *forumRepo) findComments(ctx context.Context, q querier, query string, args ...interface{}) ([]model.Comment, error) {
+	log := logger.FromContext(ctx)
+
+	rows, err := queryRows(ctx, q, query, args...)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []model.Comment
+	for rows.Next() {
+		var comment model.Comment
+		err := rows.Scan(&comment.Id, &comment.ArticleId, &comment.ThreadId, &comment.ParentId, &comment.Author, &comment.Content, &comment.Created, &comment.Deleted, &comment.Held, &comment.SpamScore, pq.Array(&comment.Mentions))
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// AddLike reports whether the like was added, it is false when the user
+// already liked the comment.
+func (r *forumRepo) AddLike(ctx context.Context, like model.Like, events ...model.Event) (bool, error) {
+	log := logger.FromContext(ctx)
 	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "AddLike")
+	defer st.end()
 
 	query := `
         INSERT INTO likes (id, comment_id, user_id)
@@ -358,31 +810,27 @@ func (r *forumRepo) AddLike(like model.Like) error {
         ON CONFLICT (comment_id, user_id) DO NOTHING
     `
 
-	_, err := r.db.Exec(query, like.Id, like.CommentId, like.UserId)
+	rowsAffected, err := execWithEvents(ctx, r.db, events, query, like.Id, like.CommentId, like.UserId)
 	if err != nil {
 		log.Error(err)
-		return err
+		return false, err
 	}
 
-	return nil
+	return rowsAffected > 0, nil
 }
 
-func (r *forumRepo) DeleteLike(like model.Like) error {
+func (r *forumRepo) DeleteLike(ctx context.Context, like model.Like, events ...model.Event) error {
+	log := logger.FromContext(ctx)
 	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "DeleteLike")
+	defer st.end()
 
 	query := `
         DELETE FROM likes
         WHERE comment_id = $1 AND user_id = $2
     `
-	result, err := r.db.Exec(query, like.CommentId, like.UserId)
+	rowsAffected, err := execWithEvents(ctx, r.db, events, query, like.CommentId, like.UserId)
 	if err != nil {
-		log.Error(err)
-		return err
-	}
-
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		log.Error(err)
 		return err
 	}
 
@@ -393,15 +841,18 @@ func (r *forumRepo) DeleteLike(like model.Like) error {
 	return nil
 }
 
-func (r *forumRepo) FindLikesByComment(commentId uuid.UUID) ([]model.Like, error) {
+func (r *forumRepo) FindLikesByComment(ctx context.Context, commentId uuid.UUID) ([]model.Like, error) {
+	log := logger.FromContext(ctx)
 	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "FindLikesByComment")
+	defer st.end()
 
 	query := `
         SELECT id, comment_id, user_id
         FROM likes
         WHERE comment_id = $1
     `
-	rows, err := r.db.Query(query, commentId)
+	rows, err := queryRows(ctx, r.replica, query, commentId)
 	if err != nil {
 		log.Error(err)
 		return nil, err
@@ -422,8 +873,11 @@ func (r *forumRepo) FindLikesByComment(commentId uuid.UUID) ([]model.Like, error
 	return likes, nil
 }
 
-func (r *forumRepo) CountLikes(commentId uuid.UUID) (int, error) {
+func (r *forumRepo) CountLikes(ctx context.Context, commentId uuid.UUID) (int, error) {
+	log := logger.FromContext(ctx)
 	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "CountLikes")
+	defer st.end()
 
 	query := `
         SELECT COUNT(*)
@@ -431,7 +885,7 @@ func (r *forumRepo) CountLikes(commentId uuid.UUID) (int, error) {
         WHERE comment_id = $1
     `
 	var count int
-	err := r.db.QueryRow(query, commentId).Scan(&count)
+	err := queryRow(ctx, r.replica, query, commentId).Scan(&count)
 	if err != nil {
 		log.Error(err)
 		return 0, nil
@@ -440,39 +894,40 @@ func (r *forumRepo) CountLikes(commentId uuid.UUID) (int, error) {
 	return count, nil
 }
 
-func (r *forumRepo) AddDislike(dislike model.Dislike) error {
+// AddDislike reports whether the dislike was added, it is false when the user
+// already disliked the comment.
+func (r *forumRepo) AddDislike(ctx context.Context, dislike model.Dislike, events ...model.Event) (bool, error) {
+	log := logger.FromContext(ctx)
 	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "AddDislike")
+	defer st.end()
 
 	query := `
         INSERT INTO dislikes (id, comment_id, user_id)
         VALUES ($1, $2, $3)
         ON CONFLICT (comment_id, user_id) DO NOTHING
     `
-	_, err := r.db.Exec(query, dislike.Id, dislike.CommentId, dislike.UserId)
+	rowsAffected, err := execWithEvents(ctx, r.db, events, query, dislike.Id, dislike.CommentId, dislike.UserId)
 	if err != nil {
 		log.Error(err)
-		return err
+		return false, err
 	}
 
-	return nil
+	return rowsAffected > 0, nil
 }
 
-func (r *forumRepo) DeleteDislike(dislike model.Dislike) error {
+func (r *forumRepo) DeleteDislike(ctx context.Context, dislike model.Dislike, events ...model.Event) error {
+	log := logger.FromContext(ctx)
 	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "DeleteDislike")
+	defer st.end()
 
 	query := `
         DELETE FROM dislikes
         WHERE comment_id = $1 AND user_id = $2
     `
-	result, err := r.db.Exec(query, dislike.CommentId, dislike.UserId)
-	if err != nil {
-		log.Error(err)
-		return err
-	}
-
-	rowsAffected, err := result.RowsAffected()
+	rowsAffected, err := execWithEvents(ctx, r.db, events, query, dislike.CommentId, dislike.UserId)
 	if err != nil {
-		log.Error(err)
 		return err
 	}
 
@@ -484,15 +939,18 @@ func (r *forumRepo) DeleteDislike(dislike model.Dislike) error {
 	return nil
 }
 
-func (r *forumRepo) FindDislikesByComment(commentId uuid.UUID) ([]model.Dislike, error) {
+func (r *forumRepo) FindDislikesByComment(ctx context.Context, commentId uuid.UUID) ([]model.Dislike, error) {
+	log := logger.FromContext(ctx)
 	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "FindDislikesByComment")
+	defer st.end()
 
 	query := `
         SELECT id, comment_id, user_id
         FROM dislikes
         WHERE comment_id = $1
     `
-	rows, err := r.db.Query(query, commentId)
+	rows, err := queryRows(ctx, r.replica, query, commentId)
 	if err != nil {
 		log.Error(err)
 		return nil, err
@@ -513,8 +971,11 @@ func (r *forumRepo) FindDislikesByComment(commentId uuid.UUID) ([]model.Dislike,
 	return dislikes, nil
 }
 
-func (r *forumRepo) CountDislikes(commentId uuid.UUID) (int, error) {
+func (r *forumRepo) CountDislikes(ctx context.Context, commentId uuid.UUID) (int, error) {
+	log := logger.FromContext(ctx)
 	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "CountDislikes")
+	defer st.end()
 
 	query := `
         SELECT COUNT(*)
@@ -522,7 +983,7 @@ func (r *forumRepo) CountDislikes(commentId uuid.UUID) (int, error) {
         WHERE comment_id = $1
     `
 	var count int
-	err := r.db.QueryRow(query, commentId).Scan(&count)
+	err := queryRow(ctx, r.replica, query, commentId).Scan(&count)
 	if err != nil {
 		log.Error(err)
 		return 0, err
@@ -531,58 +992,114 @@ func (r *forumRepo) CountDislikes(commentId uuid.UUID) (int, error) {
 	return count, nil
 }
 
-func (r *forumRepo) AddComplaint(complaint model.Complaint) error {
+// AddComplaint files the complaint, or adds its message to the user's open
+// complaint on the comment. It stores nothing and returns false when the
+// comment is missing or deleted or the user's complaint was already upheld
+// or dismissed.
+func (r *forumRepo) AddComplaint(ctx context.Context, complaint model.Complaint, events ...model.Event) (bool, error) {
+	log := logger.FromContext(ctx)
 	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "AddComplaint")
+	defer st.end()
 
 	query := `
-        INSERT INTO complaints (id, comment_id, user_id, message)
-		VALUES ($1, $2, $3, $4)
+        INSERT INTO complaints (id, comment_id, user_id, message, status, weight, created)
+		SELECT $1, $2, $3, $4, 'open', $5, $6 FROM comments WHERE id = $2 AND NOT deleted
 		ON CONFLICT (comment_id, user_id)
-		DO UPDATE SET message = complaints.message || E'\n' || EXCLUDED.message
+		DO UPDATE SET message = complaints.message || E'\n' || EXCLUDED.message, weight = EXCLUDED.weight
+		WHERE complaints.status = 'open'
     `
-	_, err := r.db.Exec(query, complaint.Id, complaint.CommentId, complaint.UserId, complaint.Message)
+	rowsAffected, err := execWithEvents(ctx, r.db, events, query, complaint.Id, complaint.CommentId, complaint.UserId, complaint.Message, complaint.Weight, complaint.Created)
 	if err != nil {
 		log.Error(err)
-		return err
+		return false, err
 	}
 
-	return nil
+	return rowsAffected > 0, nil
 }
 
-func (r *forumRepo) DeleteComplaint(id uuid.UUID) error {
+func (r *forumRepo) DeleteComplaint(ctx context.Context, id uuid.UUID, events ...model.Event) error {
+	log := logger.FromContext(ctx)
 	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "DeleteComplaint")
+	defer st.end()
 
 	query := `DELETE FROM complaints WHERE id = $1
     `
-	result, err := r.db.Exec(query, id)
+	rowsAffected, err := execWithEvents(ctx, r.db, events, query, id)
 	if err != nil {
-		log.Error(err)
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	if rowsAffected == 0 {
+		log.Error("complaint not found")
+		return errors.New("complaint not found")
+	}
+
+	return nil
+}
+
+func (r *forumRepo) GetComplaint(ctx context.Context, id uuid.UUID) (*model.Complaint, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "GetComplaint")
+	defer st.end()
+
+	query := `
+        SELECT id, comment_id, user_id, message, status, weight, created
+        FROM complaints
+        WHERE id = $1
+    `
+	var complaint model.Complaint
+	err := queryRow(ctx, r.db, query, id).Scan(&complaint.Id, &complaint.CommentId, &complaint.UserId, &complaint.Message, &complaint.Status, &complaint.Weight, &complaint.Created)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Warn(err)
+			return nil, errors.New("complaint not found")
+		}
 		log.Error(err)
+		return nil, err
+	}
+
+	return &complaint, nil
+}
+
+// UpdateComplaintStatus changes the complaint's status from from to to. It
+// fails if the status is no longer from, so of two concurrent decisions only
+// one stores its events.
+func (r *forumRepo) UpdateComplaintStatus(ctx context.Context, id uuid.UUID, from, to string, events ...model.Event) error {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "UpdateComplaintStatus")
+	defer st.end()
+
+	query := `UPDATE complaints SET status = $3 WHERE id = $1 AND status = $2`
+
+	rowsAffected, err := execWithEvents(ctx, r.db, events, query, id, from, to)
+	if err != nil {
 		return err
 	}
 
 	if rowsAffected == 0 {
-		log.Error("complaint not found")
-		return errors.New("complaint not found")
+		log.Error("complaint not found or already changed")
+		return errors.New("complaint not found or already changed")
 	}
 
 	return nil
 }
 
-func (r *forumRepo) FindComplaintsByComment(commentId uuid.UUID) ([]model.Complaint, error) {
+func (r *forumRepo) FindComplaintsByComment(ctx context.Context, commentId uuid.UUID) ([]model.Complaint, error) {
+	log := logger.FromContext(ctx)
 	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "FindComplaintsByComment")
+	defer st.end()
 
 	query := `
-        SELECT id, comment_id, user_id, message
+        SELECT id, comment_id, user_id, message, status, weight, created
         FROM complaints
         WHERE comment_id = $1
     `
-	rows, err := r.db.Query(query, commentId)
+	rows, err := queryRows(ctx, r.replica, query, commentId)
 	if err != nil {
 		log.Error(err)
 		return nil, err
@@ -592,7 +1109,7 @@ func (r *forumRepo) FindComplaintsByComment(commentId uuid.UUID) ([]model.Compla
 	var complaints []model.Complaint
 	for rows.Next() {
 		var complaint model.Complaint
-		err := rows.Scan(&complaint.Id, &complaint.CommentId, &complaint.UserId, &complaint.Message)
+		err := rows.Scan(&complaint.Id, &complaint.CommentId, &complaint.UserId, &complaint.Message, &complaint.Status, &complaint.Weight, &complaint.Created)
 		if err != nil {
 			log.Error(err)
 			return nil, err
@@ -603,8 +1120,11 @@ func (r *forumRepo) FindComplaintsByComment(commentId uuid.UUID) ([]model.Compla
 	return complaints, nil
 }
 
-func (r *forumRepo) CountComplaints(commentId uuid.UUID) (int, error) {
+func (r *forumRepo) CountComplaints(ctx context.Context, commentId uuid.UUID) (int, error) {
+	log := logger.FromContext(ctx)
 	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "CountComplaints")
+	defer st.end()
 
 	query := `
         SELECT COUNT(*)
@@ -612,10 +1132,192 @@ func (r *forumRepo) CountComplaints(commentId uuid.UUID) (int, error) {
         WHERE comment_id = $1
     `
 	var count int
-	err := r.db.QueryRow(query, commentId).Scan(&count)
+	err := queryRow(ctx, r.replica, query, commentId).Scan(&count)
 	if err != nil {
 		log.Error(err)
 		return 0, err
 	}
 	return count, nil
 }
+
+func nullUUID(id uuid.UUID) interface{} {
+	if id == uuid.Nil {
+		return nil
+	}
+	return id
+}
+
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// FindCommentsByAuthor returns one page of the author's published comments
+// across all articles, newest first, and their total number.
+func (r *forumRepo) FindCommentsByAuthor(ctx context.Context, author string, limit, offset int) ([]model.Comment, int, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "FindCommentsByAuthor")
+	defer st.end()
+
+	query := `
+        SELECT id, article_id, thread_id, parent_id, COALESCE(author, ''), content, created, deleted, held, spam_score,
+            ARRAY(SELECT m.nickname FROM comment_mentions m WHERE m.comment_id = comments.id ORDER BY m.nickname),
+            COUNT(*) OVER ()
+        FROM comments
+        WHERE author = $1 AND deleted = FALSE AND held = FALSE
+        ORDER BY created DESC
+        LIMIT $2 OFFSET $3
+    `
+	return r.findCommentsPage(ctx, query, author, limit, offset)
+}
+
+func (r *forumRepo) FindCommentsLikedBy(ctx context.Context, nickname string, limit, offset int) ([]model.Comment, int, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "FindCommentsLikedBy")
+	defer st.end()
+
+	query := `
+        SELECT c.id, c.article_id, c.thread_id, c.parent_id, COALESCE(c.author, ''), c.content, c.created, c.deleted, c.held, c.spam_score,
+            ARRAY(SELECT m.nickname FROM comment_mentions m WHERE m.comment_id = c.id ORDER BY m.nickname),
+            COUNT(*) OVER ()
+        FROM likes l
+        JOIN users u ON u.id = l.user_id
+        JOIN comments c ON c.id = l.comment_id
+        WHERE u.nickname = $1 AND c.deleted = FALSE AND c.held = FALSE
+        ORDER BY c.created DESC
+        LIMIT $2 OFFSET $3
+    `
+	return r.findCommentsPage(ctx, query, nickname, limit, offset)
+}
+
+func (r *forumRepo) FindCommentsDislikedBy(ctx context.Context, nickname string, limit, offset int) ([]model.Comment, int, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "FindCommentsDislikedBy")
+	defer st.end()
+
+	query := `
+        SELECT c.id, c.article_id, c.thread_id, c.parent_id, COALESCE(c.author, ''), c.content, c.created, c.deleted, c.held, c.spam_score,
+            ARRAY(SELECT m.nickname FROM comment_mentions m WHERE m.comment_id = c.id ORDER BY m.nickname),
+            COUNT(*) OVER ()
+        FROM dislikes d
+        JOIN users u ON u.id = d.user_id
+        JOIN comments c ON c.id = d.comment_id
+        WHERE u.nickname = $1 AND c.deleted = FALSE AND c.held = FALSE
+        ORDER BY c.created DESC
+        LIMIT $2 OFFSET $3
+    `
+	return r.findCommentsPage(ctx, query, nickname, limit, offset)
+}
+
+// FindComplaintsByUser returns one page of the complaints filed by the user
+// and their total number.
+func (r *forumRepo) FindComplaintsByUser(ctx context.Context, nickname string, limit, offset int) ([]model.Complaint, int, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "FindComplaintsByUser")
+	defer st.end()
+
+	query := `
+        SELECT p.id, p.comment_id, p.user_id, p.message, p.status, p.weight, p.created, COUNT(*) OVER ()
+        FROM complaints p
+        JOIN users u ON u.id = p.user_id
+        WHERE u.nickname = $1
+        ORDER BY p.created DESC, p.id
+        LIMIT $2 OFFSET $3
+    `
+	rows, err := queryRows(ctx, r.replica, query, nickname, limit, offset)
+	if err != nil {
+		log.Error(err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var complaints []model.Complaint
+	var total int
+	for rows.Next() {
+		var complaint model.Complaint
+		if err := rows.Scan(&complaint.Id, &complaint.CommentId, &complaint.UserId, &complaint.Message, &complaint.Status, &complaint.Weight, &complaint.Created, &total); err != nil {
+			log.Error(err)
+			return nil, 0, err
+		}
+		complaints = append(complaints, complaint)
+	}
+
+	return complaints, total, rows.Err()
+}
+
+// GetUserStats summarizes the user's activity. Karma counts the likes minus
+// the dislikes received on published comments.
+func (r *forumRepo) GetUserStats(ctx context.Context, nickname string) (*model.UserStats, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "forum", "GetUserStats")
+	defer st.end()
+
+	query := `
+        SELECT u.nickname,
+            (SELECT COUNT(*) FROM comments c WHERE c.author = u.nickname AND c.deleted = FALSE AND c.held = FALSE),
+            (SELECT COUNT(*) FROM likes l JOIN comments c ON c.id = l.comment_id WHERE c.author = u.nickname AND c.deleted = FALSE),
+            (SELECT COUNT(*) FROM dislikes d JOIN comments c ON c.id = d.comment_id WHERE c.author = u.nickname AND c.deleted = FALSE),
+            (SELECT COUNT(*) FROM likes WHERE user_id = u.id),
+            (SELECT COUNT(*) FROM dislikes WHERE user_id = u.id),
+            (SELECT MIN(created) FROM comments WHERE author = u.nickname),
+            (SELECT MAX(created) FROM comments WHERE author = u.nickname)
+        FROM users u
+        WHERE u.nickname = $1
+    `
+	var stats model.UserStats
+	var first, last sql.NullTime
+	err := queryRow(ctx, r.db, query, nickname).Scan(&stats.Nickname, &stats.Comments, &stats.LikesReceived, &stats.DislikesReceived,
+		&stats.LikesGiven, &stats.DislikesGiven, &first, &last)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Warn(err)
+			return nil, errors.New("user not found")
+		}
+		log.Error(err)
+		return nil, err
+	}
+
+	stats.Karma = stats.LikesReceived - stats.DislikesReceived
+	if first.Valid {
+		stats.FirstActivity = &first.Time
+	}
+	if last.Valid {
+		stats.LastActivity = &last.Time
+	}
+
+	return &stats, nil
+}
+
+// findCommentsPage runs a comment query whose last column is the total
+// number of matches.
+func (r *forumRepo) findCommentsPage(ctx context.Context, query string, args ...interface{}) ([]model.Comment, int, error) {
+	log := logger.FromContext(ctx)
+
+	rows, err := queryRows(ctx, r.replica, query, args...)
+	if err != nil {
+		log.Error(err)
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var comments []model.Comment
+	var total int
+	for rows.Next() {
+		var comment model.Comment
+		err := rows.Scan(&comment.Id, &comment.ArticleId, &comment.ThreadId, &comment.ParentId, &comment.Author, &comment.Content, &comment.Created, &comment.Deleted, &comment.Held, &comment.SpamScore, pq.Array(&comment.Mentions), &total)
+		if err != nil {
+			log.Error(err)
+			return nil, 0, err
+		}
+		comments = append(comments, comment)
+	}
+
+	return comments, total, rows.Err()
+}
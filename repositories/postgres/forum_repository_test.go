@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	model "github.com/demkowo/forum/models"
+	"github.com/google/uuid"
+)
+
+// fakeComments answers the statements of AddComment and counts the stored
+// comments and the flood check queries.
+func fakeComments(stored, checked *int) func(query string, args []driver.Value) (*fakeRows, error) {
+	return func(query string, args []driver.Value) (*fakeRows, error) {
+		switch {
+		case strings.Contains(query, "pg_advisory_xact_lock"):
+			return &fakeRows{affected: 1}, nil
+		case strings.Contains(query, "FROM comments") && strings.Contains(query, "created > $2"):
+			*checked++
+			return &fakeRows{columns: []string{"id", "article_id", "thread_id", "parent_id", "author", "content", "created", "deleted", "held", "spam_score", "mentions"}}, nil
+		case strings.Contains(query, "INSERT INTO comments"):
+			*stored++
+			return &fakeRows{affected: 1}, nil
+		}
+		return nil, fmt.Errorf("unexpected query %q", query)
+	}
+}
+
+func TestAddCommentRunsCheckOnItsConnection(t *testing.T) {
+	var stored, checked int
+	db := openFakeDB(fakeComments(&stored, &checked))
+	db.SetMaxOpenConns(1)
+	repo := NewForum(db, nil, "english")
+
+	const posts = 8
+	articleId := uuid.New()
+	done := make(chan struct{})
+	errs := make(chan error, posts)
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		for i := 0; i < posts; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				id := uuid.New()
+				comment := model.Comment{Id: id, ArticleId: articleId, ThreadId: id, Author: fmt.Sprintf("user%d", i%2), Content: "hello", Created: time.Now()}
+				errs <- repo.AddComment(context.Background(), comment, func(recent RecentComments) error {
+					if _, err := recent.FindRecentCommentsByAuthor(context.Background(), comment.Author, time.Now().Add(-time.Minute)); err != nil {
+						return err
+					}
+					_, err := recent.FindRecentCommentsByArticle(context.Background(), comment.ArticleId, time.Now().Add(-time.Minute))
+					return err
+				})
+			}(i)
+		}
+		wg.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("AddComment deadlocked on a pool of one connection")
+	}
+
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if stored != posts || checked != 2*posts {
+		t.Errorf("stored %d comments after %d check queries, want %d after %d", stored, checked, posts, 2*posts)
+	}
+}
@@ -0,0 +1,97 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	FIND_MISSING_SCHEMA = `SELECT name FROM unnest($1::text[]) AS t(name)
+    WHERE to_regclass('public.' || name) IS NULL
+	UNION ALL
+	SELECT name FROM unnest($2::text[]) AS c(name)
+    WHERE NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = 'public'
+            AND table_name = split_part(c.name, '.', 1)
+            AND column_name = split_part(c.name, '.', 2)
+    );`
+)
+
+var (
+	// SchemaTables are the tables created on startup.
+	SchemaTables = []string{
+		"outbox",
+		"comments", "complaints", "likes", "dislikes", "comment_mentions",
+		"user_reputation", "reputation_events",
+		"user_erasures",
+		"notifications", "notification_preferences",
+		"webhooks", "webhook_deliveries", "webhook_dead_letters",
+		"spam_samples", "spam_tokens", "spam_stats",
+	}
+	// SchemaColumns are the columns added to existing tables on startup, as
+	// table.column.
+	SchemaColumns = []string{
+		"outbox.thread_id", "outbox.failed",
+		"comments.held", "comments.spam_score", "comments.search",
+		"complaints.status", "complaints.weight", "complaints.created",
+	}
+)
+
+type HealthRepo interface {
+	Ping(ctx context.Context) error
+	FindMissingSchema(ctx context.Context, tables []string, columns []string) ([]string, error)
+}
+
+type healthRepo struct {
+	db *sql.DB
+}
+
+func NewHealth(db *sql.DB) HealthRepo {
+	log.Trace()
+
+	return &healthRepo{
+		db: db,
+	}
+}
+
+func (r *healthRepo) Ping(ctx context.Context) error {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "health", "Ping")
+	defer st.end()
+
+	err := r.db.PingContext(ctx)
+	st.fail(err)
+	return err
+}
+
+// FindMissingSchema returns the tables and table.column names that do not
+// exist in the public schema.
+func (r *healthRepo) FindMissingSchema(ctx context.Context, tables []string, columns []string) ([]string, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "health", "FindMissingSchema")
+	defer st.end()
+
+	rows, err := queryRows(ctx, r.db, FIND_MISSING_SCHEMA, pq.Array(tables), pq.Array(columns))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var missing []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		missing = append(missing, name)
+	}
+
+	return missing, rows.Err()
+}
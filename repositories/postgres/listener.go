@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	model "github.com/demkowo/forum/models"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+// EventListener receives the sequences of published outbox events announced
+// with NotifyEvent and the presence announced with NotifyPresence by any
+// replica.
+type EventListener interface {
+	Sequences() <-chan int64
+	Presence() <-chan model.Presence
+	Close() error
+}
+
+type eventListener struct {
+	listener  *pq.Listener
+	sequences chan int64
+	presence  chan model.Presence
+}
+
+func NewEventListener(connection string) (EventListener, error) {
+	log.Trace()
+
+	listener := pq.NewListener(connection, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			log.Warnf("event listener disconnected: %v", err)
+		case pq.ListenerEventReconnected:
+			log.Warn("event listener reconnected, notifications sent meanwhile were lost")
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.Errorf("event listener failed to connect: %v", err)
+		}
+	})
+
+	for _, channel := range []string{OUTBOX_CHANNEL, PRESENCE_CHANNEL} {
+		if err := listener.Listen(channel); err != nil {
+			listener.Close()
+			log.Error(err)
+			return nil, err
+		}
+	}
+
+	l := &eventListener{
+		listener:  listener,
+		sequences: make(chan int64, 256),
+		presence:  make(chan model.Presence, 256),
+	}
+	go l.run()
+
+	return l, nil
+}
+
+func (l *eventListener) Sequences() <-chan int64 {
+	return l.sequences
+}
+
+func (l *eventListener) Presence() <-chan model.Presence {
+	return l.presence
+}
+
+func (l *eventListener) Close() error {
+	log.Trace()
+
+	return l.listener.Close()
+}
+
+func (l *eventListener) run() {
+	defer close(l.sequences)
+	defer close(l.presence)
+
+	for notification := range l.listener.Notify {
+		// nil is sent after a reconnect
+		if notification == nil {
+			continue
+		}
+
+		switch notification.Channel {
+		case OUTBOX_CHANNEL:
+			sequence, err := strconv.ParseInt(notification.Extra, 10, 64)
+			if err != nil {
+				log.Warnf("invalid event notification %q", notification.Extra)
+				continue
+			}
+			l.sequences <- sequence
+
+		case PRESENCE_CHANNEL:
+			var presence model.Presence
+			if err := json.Unmarshal([]byte(notification.Extra), &presence); err != nil {
+				log.Warnf("invalid presence notification %q", notification.Extra)
+				continue
+			}
+			// presence is short-lived, drop it rather than hold up events
+			select {
+			case l.presence <- presence:
+			default:
+			}
+		}
+	}
+}
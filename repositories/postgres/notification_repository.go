@@ -0,0 +1,269 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	model "github.com/demkowo/forum/models"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	CHECK_IF_EXIST_NOTIFICATIONS            = "SELECT to_regclass('public.notifications')"
+	CHECK_IF_EXIST_NOTIFICATION_PREFERENCES = "SELECT to_regclass('public.notification_preferences')"
+	CREATE_TABLE_NOTIFICATIONS              = `CREATE TABLE notifications (
+    id UUID PRIMARY KEY,
+    recipient varchar(255) NOT NULL,
+    kind varchar(16) NOT NULL,
+    comment_id UUID NOT NULL,
+    thread_id UUID NOT NULL,
+    actors TEXT[] NOT NULL DEFAULT '{}',
+    count INTEGER NOT NULL DEFAULT 1,
+    read BOOLEAN NOT NULL DEFAULT FALSE,
+    created TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated TIMESTAMP WITH TIME ZONE NOT NULL,
+    FOREIGN KEY (recipient) REFERENCES users(nickname),
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+	);
+	CREATE UNIQUE INDEX notifications_unread_idx ON notifications (recipient, kind, comment_id) WHERE read = FALSE;`
+	CREATE_TABLE_NOTIFICATION_PREFERENCES = `CREATE TABLE notification_preferences (
+    nickname varchar(255) PRIMARY KEY,
+    muted_kinds TEXT[] NOT NULL DEFAULT '{}',
+    muted_threads UUID[] NOT NULL DEFAULT '{}',
+    FOREIGN KEY (nickname) REFERENCES users(nickname)
+	);`
+	// actorsLimit caps how many actor names an aggregated notification keeps.
+	actorsLimit = 10
+)
+
+type NotificationRepo interface {
+	CreateTableNotifications() string
+	CreateTableNotificationPreferences() string
+
+	AddNotification(ctx context.Context, notification model.Notification) error
+	FindUnreadNotifications(ctx context.Context, nickname string) ([]model.Notification, error)
+	MarkNotificationRead(ctx context.Context, nickname string, id uuid.UUID) error
+	MarkAllNotificationsRead(ctx context.Context, nickname string) (int64, error)
+
+	GetNotificationPreferences(ctx context.Context, nickname string) (*model.NotificationPreferences, error)
+	SetNotificationPreferences(ctx context.Context, preferences model.NotificationPreferences) error
+
+	FindNickname(ctx context.Context, userId uuid.UUID) (string, error)
+}
+
+type notificationRepo struct {
+	db *sql.DB
+}
+
+func NewNotification(db *sql.DB) NotificationRepo {
+	log.Trace()
+
+	return &notificationRepo{
+		db: db,
+	}
+}
+
+func (r *notificationRepo) CreateTableNotifications() string {
+	log.Trace()
+
+	return createTable(r.db, "notifications", CHECK_IF_EXIST_NOTIFICATIONS, CREATE_TABLE_NOTIFICATIONS)
+}
+
+func (r *notificationRepo) CreateTableNotificationPreferences() string {
+	log.Trace()
+
+	return createTable(r.db, "notification_preferences", CHECK_IF_EXIST_NOTIFICATION_PREFERENCES, CREATE_TABLE_NOTIFICATION_PREFERENCES)
+}
+
+// AddNotification creates an unread notification or, if the recipient still
+// has an unread one of the same kind for the same comment, folds the new
+// actor into it.
+func (r *notificationRepo) AddNotification(ctx context.Context, n model.Notification) error {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "notification", "AddNotification")
+	defer st.end()
+
+	query := `
+        INSERT INTO notifications (id, recipient, kind, comment_id, thread_id, actors, count, read, created, updated)
+        VALUES ($1, $2, $3, $4, $5, $6, 1, FALSE, $7, $7)
+        ON CONFLICT (recipient, kind, comment_id) WHERE read = FALSE
+        DO UPDATE SET
+            count = CASE
+                WHEN EXCLUDED.actors[1] = ANY(notifications.actors) THEN notifications.count
+                ELSE notifications.count + 1
+            END,
+            actors = CASE
+                WHEN EXCLUDED.actors[1] = ANY(notifications.actors) THEN notifications.actors
+                ELSE (EXCLUDED.actors || notifications.actors)[1:$8]
+            END,
+            updated = EXCLUDED.updated
+    `
+	_, err := exec(ctx, r.db, query, n.Id, n.Recipient, n.Kind, n.CommentId, n.ThreadId, pq.Array(n.Actors), n.Created, actorsLimit)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *notificationRepo) FindUnreadNotifications(ctx context.Context, nickname string) ([]model.Notification, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "notification", "FindUnreadNotifications")
+	defer st.end()
+
+	query := `
+        SELECT id, recipient, kind, comment_id, thread_id, actors, count, read, created, updated
+        FROM notifications
+        WHERE recipient = $1 AND read = FALSE
+        ORDER BY updated DESC
+    `
+	rows, err := queryRows(ctx, r.db, query, nickname)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []model.Notification
+	for rows.Next() {
+		var n model.Notification
+		err := rows.Scan(&n.Id, &n.Recipient, &n.Kind, &n.CommentId, &n.ThreadId, pq.Array(&n.Actors), &n.Count, &n.Read, &n.Created, &n.Updated)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+
+	return notifications, rows.Err()
+}
+
+func (r *notificationRepo) MarkNotificationRead(ctx context.Context, nickname string, id uuid.UUID) error {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "notification", "MarkNotificationRead")
+	defer st.end()
+
+	result, err := exec(ctx, r.db, `UPDATE notifications SET read = TRUE WHERE id = $1 AND recipient = $2`, id, nickname)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	if rowsAffected == 0 {
+		log.Warn("notification not found")
+		return errors.New("notification not found")
+	}
+
+	return nil
+}
+
+func (r *notificationRepo) MarkAllNotificationsRead(ctx context.Context, nickname string) (int64, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "notification", "MarkAllNotificationsRead")
+	defer st.end()
+
+	result, err := exec(ctx, r.db, `UPDATE notifications SET read = TRUE WHERE recipient = $1 AND read = FALSE`, nickname)
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (r *notificationRepo) GetNotificationPreferences(ctx context.Context, nickname string) (*model.NotificationPreferences, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "notification", "GetNotificationPreferences")
+	defer st.end()
+
+	preferences := &model.NotificationPreferences{
+		Nickname:     nickname,
+		MutedKinds:   []string{},
+		MutedThreads: []uuid.UUID{},
+	}
+
+	var threads []string
+	err := queryRow(ctx, r.db, `SELECT muted_kinds, muted_threads FROM notification_preferences WHERE nickname = $1`, nickname).
+		Scan(pq.Array(&preferences.MutedKinds), pq.Array(&threads))
+	if err == sql.ErrNoRows {
+		return preferences, nil
+	}
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	for _, thread := range threads {
+		id, err := uuid.Parse(thread)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		preferences.MutedThreads = append(preferences.MutedThreads, id)
+	}
+
+	return preferences, nil
+}
+
+func (r *notificationRepo) SetNotificationPreferences(ctx context.Context, preferences model.NotificationPreferences) error {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "notification", "SetNotificationPreferences")
+	defer st.end()
+
+	threads := make([]string, 0, len(preferences.MutedThreads))
+	for _, thread := range preferences.MutedThreads {
+		threads = append(threads, thread.String())
+	}
+
+	query := `
+        INSERT INTO notification_preferences (nickname, muted_kinds, muted_threads)
+        VALUES ($1, $2, $3::uuid[])
+        ON CONFLICT (nickname) DO UPDATE SET muted_kinds = EXCLUDED.muted_kinds, muted_threads = EXCLUDED.muted_threads
+    `
+	_, err := exec(ctx, r.db, query, preferences.Nickname, pq.Array(preferences.MutedKinds), pq.Array(threads))
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *notificationRepo) FindNickname(ctx context.Context, userId uuid.UUID) (string, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "notification", "FindNickname")
+	defer st.end()
+
+	return findNickname(ctx, r.db, userId)
+}
+
+func findNickname(ctx context.Context, db *sql.DB, userId uuid.UUID) (string, error) {
+	log := logger.FromContext(ctx)
+
+	var nickname string
+	err := queryRow(ctx, db, `SELECT nickname FROM users WHERE id = $1`, userId).Scan(&nickname)
+	if err != nil {
+		log.Error(err)
+		return "", err
+	}
+
+	return nickname, nil
+}
@@ -0,0 +1,336 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	model "github.com/demkowo/forum/models"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	OUTBOX_CHANNEL        = "forum_events"
+	CHECK_IF_EXIST_OUTBOX = "SELECT to_regclass('public.outbox')"
+	CREATE_TABLE_OUTBOX   = `CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    event_id UUID NOT NULL UNIQUE,
+    type varchar(32) NOT NULL,
+    comment_id UUID NOT NULL,
+    article_id UUID NOT NULL,
+    thread_id UUID,
+    payload JSONB NOT NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL,
+    published TIMESTAMP WITH TIME ZONE,
+    failed TIMESTAMP WITH TIME ZONE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX outbox_pending_idx ON outbox (id) WHERE published IS NULL;
+	CREATE INDEX outbox_article_idx ON outbox (article_id, id);`
+	ALTER_TABLE_OUTBOX = `ALTER TABLE outbox ADD COLUMN IF NOT EXISTS thread_id UUID;
+	ALTER TABLE outbox ADD COLUMN IF NOT EXISTS failed TIMESTAMP WITH TIME ZONE;`
+	OUTBOX_COLUMNS = `id, event_id, type, comment_id, article_id, COALESCE(thread_id, comment_id), payload, created`
+)
+
+type OutboxRepo interface {
+	CreateTableOutbox() string
+
+	PublishOutbox(ctx context.Context, limit int, maxAttempts int, publish func(event model.Event) error) (int, error)
+	DeletePublishedOutbox(ctx context.Context, before time.Time) (int64, error)
+	GetOutboxEvent(ctx context.Context, sequence int64) (*model.Event, error)
+	FindPublishedEventsByArticle(ctx context.Context, articleId uuid.UUID, after int64, limit int) ([]model.Event, error)
+}
+
+type outboxRepo struct {
+	db     *sql.DB
+	notify bool
+}
+
+// NewOutbox returns the outbox repository. With notify PublishOutbox
+// announces every published event on OUTBOX_CHANNEL.
+func NewOutbox(db *sql.DB, notify bool) OutboxRepo {
+	log.Trace()
+
+	return &outboxRepo{
+		db:     db,
+		notify: notify,
+	}
+}
+
+func (r *outboxRepo) CreateTableOutbox() string {
+	log.Trace()
+
+	result := createTable(r.db, "outbox", CHECK_IF_EXIST_OUTBOX, CREATE_TABLE_OUTBOX)
+	if _, err := r.db.Exec(ALTER_TABLE_OUTBOX); err != nil {
+		log.Panicf("ALTER_TABLE_OUTBOX failed: %v", err)
+	}
+
+	return result
+}
+
+// PublishOutbox locks up to limit unpublished events in order, hands them to
+// publish and marks the published ones. It stops at the first failure so
+// events are never published out of order; the failed event is retried on the
+// next call. An event that failed maxAttempts times is marked failed and
+// skipped so it does not hold back the events behind it. Rows locked by
+// another relay are skipped. The NOTIFY of a published event is sent in the
+// same transaction, so Postgres delivers it only once published is committed.
+func (r *outboxRepo) PublishOutbox(ctx context.Context, limit int, maxAttempts int, publish func(event model.Event) error) (int, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "outbox", "PublishOutbox")
+	defer st.end()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	query := `
+        SELECT ` + OUTBOX_COLUMNS + `, attempts
+        FROM outbox
+        WHERE published IS NULL AND failed IS NULL
+        ORDER BY id
+        LIMIT $1
+        FOR UPDATE SKIP LOCKED
+    `
+	rows, err := queryRows(ctx, tx, query, limit)
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+
+	var events []model.Event
+	var attempts []int
+	for rows.Next() {
+		var event model.Event
+		var attempt int
+		if err := rows.Scan(append(eventFields(&event), &attempt)...); err != nil {
+			rows.Close()
+			log.Error(err)
+			return 0, err
+		}
+		events = append(events, event)
+		attempts = append(attempts, attempt)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Error(err)
+		return 0, err
+	}
+
+	published := 0
+	for i, event := range events {
+		if err := publish(event); err != nil {
+			if attempts[i]+1 < maxAttempts {
+				log.Warnf("publishing outbox event %d failed: %v", event.Sequence, err)
+				if _, err := exec(ctx, tx, `UPDATE outbox SET attempts = attempts + 1, last_error = $2 WHERE id = $1`, event.Sequence, err.Error()); err != nil {
+					log.Error(err)
+					return 0, err
+				}
+				break
+			}
+
+			log.Errorf("publishing outbox event %d failed %d times, giving up: %v", event.Sequence, attempts[i]+1, err)
+			if _, err := exec(ctx, tx, `UPDATE outbox SET failed = now(), attempts = attempts + 1, last_error = $2 WHERE id = $1`, event.Sequence, err.Error()); err != nil {
+				log.Error(err)
+				return 0, err
+			}
+			continue
+		}
+
+		if _, err := exec(ctx, tx, `UPDATE outbox SET published = now(), attempts = attempts + 1, last_error = '' WHERE id = $1`, event.Sequence); err != nil {
+			log.Error(err)
+			return 0, err
+		}
+		if r.notify {
+			if err := notifyEvent(ctx, tx, event.Sequence); err != nil {
+				return 0, err
+			}
+		}
+		published++
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		return 0, err
+	}
+
+	return published, nil
+}
+
+func (r *outboxRepo) DeletePublishedOutbox(ctx context.Context, before time.Time) (int64, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "outbox", "DeletePublishedOutbox")
+	defer st.end()
+
+	result, err := exec(ctx, r.db, `DELETE FROM outbox WHERE published IS NOT NULL AND published < $1`, before)
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (r *outboxRepo) GetOutboxEvent(ctx context.Context, sequence int64) (*model.Event, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "outbox", "GetOutboxEvent")
+	defer st.end()
+
+	query := `
+        SELECT ` + OUTBOX_COLUMNS + `
+        FROM outbox
+        WHERE id = $1
+    `
+	var event model.Event
+	if err := scanEvent(queryRow(ctx, r.db, query, sequence), &event); err != nil {
+		if err == sql.ErrNoRows {
+			log.Warn(err)
+			return nil, errors.New("event not found")
+		}
+		log.Error(err)
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// FindPublishedEventsByArticle returns up to limit published events of the
+// article that follow the after sequence, oldest first.
+func (r *outboxRepo) FindPublishedEventsByArticle(ctx context.Context, articleId uuid.UUID, after int64, limit int) ([]model.Event, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "outbox", "FindPublishedEventsByArticle")
+	defer st.end()
+
+	query := `
+        SELECT ` + OUTBOX_COLUMNS + `
+        FROM outbox
+        WHERE article_id = $1 AND id > $2 AND published IS NOT NULL
+        ORDER BY id
+        LIMIT $3
+    `
+	rows, err := queryRows(ctx, r.db, query, articleId, after, limit)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []model.Event
+	for rows.Next() {
+		var event model.Event
+		if err := scanEvent(rows, &event); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// notifyEvent announces a published event to the listeners of every replica
+// when tx commits. The payload is only the sequence, NOTIFY payloads are
+// limited to 8000 bytes.
+func notifyEvent(ctx context.Context, tx *sql.Tx, sequence int64) error {
+	log := logger.FromContext(ctx)
+
+	if _, err := exec(ctx, tx, `SELECT pg_notify($1, $2)`, OUTBOX_CHANNEL, strconv.FormatInt(sequence, 10)); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func scanEvent(row interface{ Scan(dest ...any) error }, event *model.Event) error {
+	return row.Scan(eventFields(event)...)
+}
+
+// eventFields returns the scan destinations of OUTBOX_COLUMNS.
+func eventFields(event *model.Event) []any {
+	return []any{&event.Sequence, &event.Id, &event.Type, &event.CommentId, &event.ArticleId, &event.ThreadId, (*[]byte)(&event.Data), &event.Created}
+}
+
+// insertOutbox stores events in the outbox as part of tx. It fails when the
+// comment of an event does not exist, the event would be lost otherwise.
+func insertOutbox(ctx context.Context, tx *sql.Tx, events []model.Event) error {
+	log := logger.FromContext(ctx)
+
+	query := `
+        INSERT INTO outbox (event_id, type, comment_id, article_id, thread_id, payload, created)
+        SELECT $1, $2, $3, article_id, thread_id, $4, $5 FROM comments WHERE id = $3
+    `
+	for _, event := range events {
+		result, err := exec(ctx, tx, query, event.Id, event.Type, event.CommentId, string(event.Data), event.Created)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		if rowsAffected == 0 {
+			err := fmt.Errorf("event %s: comment %s not found", event.Type, event.CommentId)
+			log.Error(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// execWithEvents runs query and stores events in the outbox in a single
+// transaction and returns the number of affected rows. Nothing is stored
+// when the query affects no rows.
+func execWithEvents(ctx context.Context, db *sql.DB, events []model.Event, query string, args ...interface{}) (int64, error) {
+	log := logger.FromContext(ctx)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := exec(ctx, tx, query, args...)
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+
+	if rowsAffected == 0 {
+		return 0, nil
+	}
+
+	if err := insertOutbox(ctx, tx, events); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		return 0, err
+	}
+
+	return rowsAffected, nil
+}
@@ -0,0 +1,176 @@
+package postgres
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	model "github.com/demkowo/forum/models"
+	"github.com/google/uuid"
+)
+
+type outboxRow struct {
+	sequence  int64
+	attempts  int64
+	published bool
+	failed    bool
+	lastError string
+}
+
+// fakeOutbox answers the statements of PublishOutbox from rows.
+func fakeOutbox(rows []*outboxRow) func(query string, args []driver.Value) (*fakeRows, error) {
+	find := func(sequence driver.Value) *outboxRow {
+		for _, row := range rows {
+			if row.sequence == sequence {
+				return row
+			}
+		}
+		return nil
+	}
+
+	return func(query string, args []driver.Value) (*fakeRows, error) {
+		switch {
+		case strings.Contains(query, "FOR UPDATE SKIP LOCKED"):
+			result := &fakeRows{columns: []string{"id", "event_id", "type", "comment_id", "article_id", "thread_id", "payload", "created", "attempts"}}
+			for _, row := range rows {
+				if !row.published && !row.failed && int64(len(result.values)) < args[0].(int64) {
+					result.values = append(result.values, []driver.Value{
+						row.sequence, uuid.NewString(), model.EventCommentCreated, uuid.NewString(), uuid.NewString(), uuid.NewString(), []byte(`{}`), time.Now(), row.attempts,
+					})
+				}
+			}
+			return result, nil
+		case strings.Contains(query, "SET published = now()"):
+			row := find(args[0])
+			row.published, row.attempts, row.lastError = true, row.attempts+1, ""
+			return &fakeRows{affected: 1}, nil
+		case strings.Contains(query, "SET failed = now()"):
+			row := find(args[0])
+			row.failed, row.attempts, row.lastError = true, row.attempts+1, args[1].(string)
+			return &fakeRows{affected: 1}, nil
+		case strings.Contains(query, "SET attempts = attempts + 1"):
+			row := find(args[0])
+			row.attempts, row.lastError = row.attempts+1, args[1].(string)
+			return &fakeRows{affected: 1}, nil
+		}
+		return nil, fmt.Errorf("unexpected query %q", query)
+	}
+}
+
+func TestPublishOutboxGivesUpAfterMaxAttempts(t *testing.T) {
+	rows := []*outboxRow{{sequence: 1}, {sequence: 2}, {sequence: 3}}
+	repo := NewOutbox(openFakeDB(fakeOutbox(rows)), false)
+
+	var calls []int64
+	publish := func(event model.Event) error {
+		calls = append(calls, event.Sequence)
+		if event.Sequence == 2 {
+			return errors.New("subscriber down")
+		}
+		return nil
+	}
+
+	for i, want := range []int{1, 0, 1, 0} {
+		published, err := repo.PublishOutbox(context.Background(), 10, 3, publish)
+		if err != nil {
+			t.Fatalf("PublishOutbox call %d: %v", i+1, err)
+		}
+		if published != want {
+			t.Errorf("PublishOutbox call %d published %d events, want %d", i+1, published, want)
+		}
+	}
+
+	if want := []int64{1, 2, 2, 2, 3}; !slices.Equal(calls, want) {
+		t.Errorf("published sequences %v, want %v", calls, want)
+	}
+	if !rows[0].published || !rows[2].published {
+		t.Errorf("events 1 and 3 were not marked published: %+v %+v", rows[0], rows[2])
+	}
+	if failed := rows[1]; !failed.failed || failed.published || failed.attempts != 3 || failed.lastError != "subscriber down" {
+		t.Errorf("event 2 = %+v, want failed after 3 attempts", failed)
+	}
+}
+
+func TestPublishOutboxKeepsOrderBeforeMaxAttempts(t *testing.T) {
+	rows := []*outboxRow{{sequence: 1}, {sequence: 2}}
+	repo := NewOutbox(openFakeDB(fakeOutbox(rows)), false)
+
+	var calls []int64
+	published, err := repo.PublishOutbox(context.Background(), 10, 3, func(event model.Event) error {
+		calls = append(calls, event.Sequence)
+		return errors.New("subscriber down")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if published != 0 || !slices.Equal(calls, []int64{1}) {
+		t.Errorf("published %d after calls %v, want 0 after [1]", published, calls)
+	}
+	if rows[0].failed || rows[0].attempts != 1 || rows[1].attempts != 0 {
+		t.Errorf("rows = %+v %+v, want only event 1 retried", rows[0], rows[1])
+	}
+}
+
+func TestPublishOutboxNotifiesPublishedEventsInTransaction(t *testing.T) {
+	rows := []*outboxRow{{sequence: 1}, {sequence: 2}, {sequence: 3, attempts: 2}}
+	handle := fakeOutbox(rows)
+
+	var notified []string
+	repo := NewOutbox(openFakeDB(func(query string, args []driver.Value) (*fakeRows, error) {
+		if strings.Contains(query, "pg_notify") {
+			if args[0] != OUTBOX_CHANNEL {
+				t.Errorf("notified channel %v, want %s", args[0], OUTBOX_CHANNEL)
+			}
+			// Published must already be set in the transaction that
+			// sends the notification.
+			for _, row := range rows {
+				if fmt.Sprint(row.sequence) == args[1] && !row.published {
+					t.Errorf("event %v notified before it was marked published", args[1])
+				}
+			}
+			notified = append(notified, args[1].(string))
+			return nil, nil
+		}
+		return handle(query, args)
+	}), true)
+
+	_, err := repo.PublishOutbox(context.Background(), 10, 3, func(event model.Event) error {
+		if event.Sequence == 3 {
+			return errors.New("subscriber down")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"1", "2"}; !slices.Equal(notified, want) {
+		t.Errorf("notified %v, want %v", notified, want)
+	}
+}
+
+func TestInsertOutboxFailsWithoutComment(t *testing.T) {
+	db := openFakeDB(func(query string, args []driver.Value) (*fakeRows, error) {
+		if strings.Contains(query, "INSERT INTO outbox") {
+			return &fakeRows{affected: 0}, nil
+		}
+		return nil, fmt.Errorf("unexpected query %q", query)
+	})
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	event := model.Event{Id: uuid.New(), Type: model.EventCommentCreated, CommentId: uuid.New(), Data: []byte(`{}`), Created: time.Now()}
+	err = insertOutbox(context.Background(), tx, []model.Event{event})
+	if err == nil || !strings.Contains(err.Error(), event.CommentId.String()) {
+		t.Errorf("insertOutbox = %v, want an error naming the missing comment", err)
+	}
+}
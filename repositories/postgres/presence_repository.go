@@ -0,0 +1,62 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	model "github.com/demkowo/forum/models"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const PRESENCE_CHANNEL = "forum_presence"
+
+type PresenceRepo interface {
+	NotifyPresence(ctx context.Context, presence model.Presence) error
+	FindNickname(ctx context.Context, userId uuid.UUID) (string, error)
+}
+
+type presenceRepo struct {
+	db *sql.DB
+}
+
+func NewPresence(db *sql.DB) PresenceRepo {
+	log.Trace()
+
+	return &presenceRepo{
+		db: db,
+	}
+}
+
+// NotifyPresence announces the presence to the listeners of every replica.
+// Presence is not stored.
+func (r *presenceRepo) NotifyPresence(ctx context.Context, presence model.Presence) error {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "presence", "NotifyPresence")
+	defer st.end()
+
+	payload, err := json.Marshal(presence)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	if _, err := exec(ctx, r.db, `SELECT pg_notify($1, $2)`, PRESENCE_CHANNEL, string(payload)); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *presenceRepo) FindNickname(ctx context.Context, userId uuid.UUID) (string, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "presence", "FindNickname")
+	defer st.end()
+
+	return findNickname(ctx, r.db, userId)
+}
@@ -0,0 +1,339 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	model "github.com/demkowo/forum/models"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	CHECK_IF_EXIST_ERASURES = "SELECT to_regclass('public.user_erasures')"
+	CREATE_TABLE_ERASURES   = `CREATE TABLE user_erasures (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL,
+    requested_by UUID,
+    comments INTEGER NOT NULL,
+    likes INTEGER NOT NULL,
+    dislikes INTEGER NOT NULL,
+    complaints INTEGER NOT NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL
+	);`
+)
+
+type PrivacyRepo interface {
+	CreateTableErasures() string
+
+	ExportUser(ctx context.Context, nickname string) (*model.UserExport, error)
+
+	EraseUser(ctx context.Context, erasure *model.Erasure, nickname string, events ...model.Event) error
+	FindErasures(ctx context.Context) ([]model.Erasure, error)
+}
+
+type privacyRepo struct {
+	db *sql.DB
+}
+
+func NewPrivacy(db *sql.DB) PrivacyRepo {
+	log.Trace()
+
+	return &privacyRepo{
+		db: db,
+	}
+}
+
+func (r *privacyRepo) CreateTableErasures() string {
+	log.Trace()
+
+	return createTable(r.db, "user_erasures", CHECK_IF_EXIST_ERASURES, CREATE_TABLE_ERASURES)
+}
+
+// ExportUser reads the user's comments, reactions and complaints in one
+// read-only transaction, so the export is a consistent snapshot.
+func (r *privacyRepo) ExportUser(ctx context.Context, nickname string) (*model.UserExport, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "privacy", "ExportUser")
+	defer st.end()
+
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	export := &model.UserExport{Nickname: nickname}
+
+	err = queryRow(ctx, tx, `SELECT id FROM users WHERE nickname = $1`, nickname).Scan(&export.UserId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Warn(err)
+			return nil, errors.New("user not found")
+		}
+		log.Error(err)
+		return nil, err
+	}
+
+	if export.Comments, err = findAllCommentsByAuthor(ctx, tx, nickname); err != nil {
+		return nil, err
+	}
+	if export.Likes, err = findLikesByUser(ctx, tx, export.UserId); err != nil {
+		return nil, err
+	}
+	if export.Dislikes, err = findDislikesByUser(ctx, tx, export.UserId); err != nil {
+		return nil, err
+	}
+	if export.Complaints, err = findAllComplaintsByUser(ctx, tx, export.UserId); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	return export, nil
+}
+
+func findAllCommentsByAuthor(ctx context.Context, q querier, nickname string) ([]model.Comment, error) {
+	log := logger.FromContext(ctx)
+
+	query := `
+        SELECT id, article_id, thread_id, parent_id, author, content, created, deleted, held, spam_score,
+            ARRAY(SELECT m.nickname FROM comment_mentions m WHERE m.comment_id = comments.id ORDER BY m.nickname)
+        FROM comments
+        WHERE author = $1
+        ORDER BY created
+    `
+	rows, err := queryRows(ctx, q, query, nickname)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []model.Comment{}
+	for rows.Next() {
+		var comment model.Comment
+		err := rows.Scan(&comment.Id, &comment.ArticleId, &comment.ThreadId, &comment.ParentId, &comment.Author, &comment.Content, &comment.Created, &comment.Deleted, &comment.Held, &comment.SpamScore, pq.Array(&comment.Mentions))
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+
+	return comments, rows.Err()
+}
+
+func findLikesByUser(ctx context.Context, q querier, userId uuid.UUID) ([]model.Like, error) {
+	log := logger.FromContext(ctx)
+
+	rows, err := queryRows(ctx, q, `SELECT id, comment_id, user_id FROM likes WHERE user_id = $1`, userId)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	likes := []model.Like{}
+	for rows.Next() {
+		var like model.Like
+		if err := rows.Scan(&like.Id, &like.CommentId, &like.UserId); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		likes = append(likes, like)
+	}
+
+	return likes, rows.Err()
+}
+
+func findDislikesByUser(ctx context.Context, q querier, userId uuid.UUID) ([]model.Dislike, error) {
+	log := logger.FromContext(ctx)
+
+	rows, err := queryRows(ctx, q, `SELECT id, comment_id, user_id FROM dislikes WHERE user_id = $1`, userId)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	dislikes := []model.Dislike{}
+	for rows.Next() {
+		var dislike model.Dislike
+		if err := rows.Scan(&dislike.Id, &dislike.CommentId, &dislike.UserId); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		dislikes = append(dislikes, dislike)
+	}
+
+	return dislikes, rows.Err()
+}
+
+func findAllComplaintsByUser(ctx context.Context, q querier, userId uuid.UUID) ([]model.Complaint, error) {
+	log := logger.FromContext(ctx)
+
+	query := `
+        SELECT id, comment_id, user_id, message, status, weight, created
+        FROM complaints
+        WHERE user_id = $1
+    `
+	rows, err := queryRows(ctx, q, query, userId)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	complaints := []model.Complaint{}
+	for rows.Next() {
+		var complaint model.Complaint
+		if err := rows.Scan(&complaint.Id, &complaint.CommentId, &complaint.UserId, &complaint.Message, &complaint.Status, &complaint.Weight, &complaint.Created); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		complaints = append(complaints, complaint)
+	}
+
+	return complaints, rows.Err()
+}
+
+// EraseUser removes the user as author of their comments, deletes their
+// reactions, complaints, mentions, notifications, preferences and
+// reputation, records the erasure with the affected counts and stores the
+// events, all in one transaction. The nickname and user id are also removed
+// from the outbox payloads, including the new events, and the webhook
+// deliveries and dead letters that name the user are deleted.
+func (r *privacyRepo) EraseUser(ctx context.Context, erasure *model.Erasure, nickname string, events ...model.Event) error {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "privacy", "EraseUser")
+	defer st.end()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer tx.Rollback()
+
+	counts := []struct {
+		query string
+		arg   interface{}
+		count *int
+	}{
+		{`DELETE FROM likes WHERE user_id = $1`, erasure.UserId, &erasure.Likes},
+		{`DELETE FROM dislikes WHERE user_id = $1`, erasure.UserId, &erasure.Dislikes},
+		{`DELETE FROM complaints WHERE user_id = $1`, erasure.UserId, &erasure.Complaints},
+		{`UPDATE comments SET author = NULL WHERE author = $1`, nickname, &erasure.Comments},
+	}
+	for _, c := range counts {
+		result, err := exec(ctx, tx, c.query, c.arg)
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			log.Error(err)
+			return err
+		}
+		*c.count = int(rowsAffected)
+	}
+
+	queries := []string{
+		`DELETE FROM comment_mentions WHERE nickname = $1`,
+		`DELETE FROM notifications WHERE recipient = $1`,
+		`UPDATE notifications SET actors = array_remove(actors, $1) WHERE $1 = ANY(actors)`,
+		`DELETE FROM notification_preferences WHERE nickname = $1`,
+		`DELETE FROM user_reputation WHERE nickname = $1`,
+	}
+	for _, query := range queries {
+		if _, err := exec(ctx, tx, query, nickname); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+
+	query := `
+        INSERT INTO user_erasures (id, user_id, requested_by, comments, likes, dislikes, complaints, created)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+    `
+	_, err = exec(ctx, tx, query, erasure.Id, erasure.UserId, nullUUID(erasure.RequestedBy),
+		erasure.Comments, erasure.Likes, erasure.Dislikes, erasure.Complaints, erasure.Created)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	if err := insertOutbox(ctx, tx, events); err != nil {
+		return err
+	}
+
+	userId := erasure.UserId.String()
+	scrub := []struct {
+		query string
+		args  []interface{}
+	}{
+		{`UPDATE outbox SET payload = jsonb_set(payload, '{author}', 'null') WHERE payload->>'author' = $1`, []interface{}{nickname}},
+		{`UPDATE outbox SET payload = jsonb_set(payload, '{mentions}', (payload->'mentions') - $1::text) WHERE payload->'mentions' ? $1`, []interface{}{nickname}},
+		{`UPDATE outbox SET payload = jsonb_set(payload, '{user_id}', 'null') WHERE payload->>'user_id' = $1`, []interface{}{userId}},
+		{`DELETE FROM webhook_deliveries
+        WHERE payload->'data'->>'author' = $1 OR payload->'data'->'mentions' ? $1 OR payload->'data'->>'user_id' = $2`, []interface{}{nickname, userId}},
+		{`DELETE FROM webhook_dead_letters
+        WHERE payload->'data'->>'author' = $1 OR payload->'data'->'mentions' ? $1 OR payload->'data'->>'user_id' = $2`, []interface{}{nickname, userId}},
+	}
+	for _, c := range scrub {
+		if _, err := exec(ctx, tx, c.query, c.args...); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *privacyRepo) FindErasures(ctx context.Context) ([]model.Erasure, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "privacy", "FindErasures")
+	defer st.end()
+
+	query := `
+        SELECT id, user_id, requested_by, comments, likes, dislikes, complaints, created
+        FROM user_erasures
+        ORDER BY created DESC
+    `
+	rows, err := queryRows(ctx, r.db, query)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var erasures []model.Erasure
+	for rows.Next() {
+		var erasure model.Erasure
+		err := rows.Scan(&erasure.Id, &erasure.UserId, &erasure.RequestedBy, &erasure.Comments, &erasure.Likes, &erasure.Dislikes, &erasure.Complaints, &erasure.Created)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		erasures = append(erasures, erasure)
+	}
+
+	return erasures, rows.Err()
+}
@@ -0,0 +1,240 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	model "github.com/demkowo/forum/models"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	CHECK_IF_EXIST_REPUTATION        = "SELECT to_regclass('public.user_reputation')"
+	CHECK_IF_EXIST_REPUTATION_EVENTS = "SELECT to_regclass('public.reputation_events')"
+	CREATE_TABLE_REPUTATION          = `CREATE TABLE user_reputation (
+    nickname varchar(255) PRIMARY KEY,
+    likes_received INTEGER NOT NULL DEFAULT 0,
+    dislikes_received INTEGER NOT NULL DEFAULT 0,
+    complaints_upheld INTEGER NOT NULL DEFAULT 0,
+    first_seen TIMESTAMP WITH TIME ZONE,
+    updated TIMESTAMP WITH TIME ZONE NOT NULL,
+    FOREIGN KEY (nickname) REFERENCES users(nickname) ON UPDATE CASCADE ON DELETE CASCADE
+	);`
+	CREATE_TABLE_REPUTATION_EVENTS = `CREATE TABLE reputation_events (
+    event_id UUID PRIMARY KEY,
+    applied TIMESTAMP WITH TIME ZONE NOT NULL
+	);`
+)
+
+type ReputationRepo interface {
+	CreateTableReputation() string
+	CreateTableReputationEvents() string
+
+	ApplyReputationEvent(ctx context.Context, eventId, commentId, actor uuid.UUID, likes, dislikes, upheld int, seen time.Time) error
+	GetReputation(ctx context.Context, nickname string) (*model.Reputation, error)
+	GetReputationByUserId(ctx context.Context, userId uuid.UUID) (*model.Reputation, error)
+	RebuildReputation(ctx context.Context) error
+	DeleteReputationEvents(ctx context.Context, before time.Time) (int64, error)
+}
+
+type reputationRepo struct {
+	db *sql.DB
+}
+
+func NewReputation(db *sql.DB) ReputationRepo {
+	log.Trace()
+
+	return &reputationRepo{
+		db: db,
+	}
+}
+
+func (r *reputationRepo) CreateTableReputation() string {
+	log.Trace()
+
+	return createTable(r.db, "user_reputation", CHECK_IF_EXIST_REPUTATION, CREATE_TABLE_REPUTATION)
+}
+
+func (r *reputationRepo) CreateTableReputationEvents() string {
+	log.Trace()
+
+	return createTable(r.db, "reputation_events", CHECK_IF_EXIST_REPUTATION_EVENTS, CREATE_TABLE_REPUTATION_EVENTS)
+}
+
+// ApplyReputationEvent adds the deltas to the reputation of the comment's
+// author, if it was not erased, and moves first_seen back to seen if it is
+// earlier. Nothing is added when actor, the user who reacted, is the author.
+// An event is applied only once, redeliveries are ignored.
+func (r *reputationRepo) ApplyReputationEvent(ctx context.Context, eventId, commentId, actor uuid.UUID, likes, dislikes, upheld int, seen time.Time) error {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "reputation", "ApplyReputationEvent")
+	defer st.end()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := exec(ctx, tx, `INSERT INTO reputation_events (event_id, applied) VALUES ($1, now()) ON CONFLICT DO NOTHING`, eventId)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return nil
+	}
+
+	query := `
+        INSERT INTO user_reputation (nickname, likes_received, dislikes_received, complaints_upheld, first_seen, updated)
+        SELECT c.author, $2, $3, $4, $5, now() FROM comments c
+        WHERE c.id = $1 AND c.author IS NOT NULL
+            AND NOT EXISTS (SELECT 1 FROM users u WHERE u.id = $6 AND u.nickname = c.author)
+        ON CONFLICT (nickname) DO UPDATE SET
+            likes_received = user_reputation.likes_received + EXCLUDED.likes_received,
+            dislikes_received = user_reputation.dislikes_received + EXCLUDED.dislikes_received,
+            complaints_upheld = user_reputation.complaints_upheld + EXCLUDED.complaints_upheld,
+            first_seen = LEAST(user_reputation.first_seen, EXCLUDED.first_seen),
+            updated = now()
+    `
+	if _, err := exec(ctx, tx, query, commentId, likes, dislikes, upheld, nullTime(seen), actor); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// GetReputation returns the user's counters, all zero for a user without
+// any, or the "user not found" error.
+func (r *reputationRepo) GetReputation(ctx context.Context, nickname string) (*model.Reputation, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "reputation", "GetReputation")
+	defer st.end()
+
+	return r.getReputation(ctx, `u.nickname = $1`, nickname)
+}
+
+func (r *reputationRepo) GetReputationByUserId(ctx context.Context, userId uuid.UUID) (*model.Reputation, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "reputation", "GetReputationByUserId")
+	defer st.end()
+
+	return r.getReputation(ctx, `u.id = $1`, userId)
+}
+
+func (r *reputationRepo) getReputation(ctx context.Context, where string, arg interface{}) (*model.Reputation, error) {
+	log := logger.FromContext(ctx)
+
+	query := `
+        SELECT u.nickname, COALESCE(r.likes_received, 0), COALESCE(r.dislikes_received, 0),
+            COALESCE(r.complaints_upheld, 0), r.first_seen
+        FROM users u
+        LEFT JOIN user_reputation r ON r.nickname = u.nickname
+        WHERE ` + where
+
+	var reputation model.Reputation
+	var firstSeen sql.NullTime
+	err := queryRow(ctx, r.db, query, arg).Scan(&reputation.Nickname, &reputation.LikesReceived, &reputation.DislikesReceived,
+		&reputation.ComplaintsUpheld, &firstSeen)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Warn(err)
+			return nil, errors.New("user not found")
+		}
+		log.Error(err)
+		return nil, err
+	}
+
+	if firstSeen.Valid {
+		reputation.FirstSeen = &firstSeen.Time
+	}
+
+	return &reputation, nil
+}
+
+// RebuildReputation recomputes every user's counters from the reactions,
+// upheld complaints and comments, e.g. after comments were removed.
+// Reactions of authors to their own comments are not counted.
+func (r *reputationRepo) RebuildReputation(ctx context.Context) error {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "reputation", "RebuildReputation")
+	defer st.end()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO user_reputation (nickname, likes_received, dislikes_received, complaints_upheld, first_seen, updated)
+        SELECT c.author,
+            COUNT(*) FILTER (WHERE x.kind = 'like'),
+            COUNT(*) FILTER (WHERE x.kind = 'dislike'),
+            COUNT(*) FILTER (WHERE x.kind = 'upheld'),
+            MIN(c.created),
+            now()
+        FROM comments c
+        LEFT JOIN (
+            SELECT comment_id, user_id, 'like' AS kind FROM likes
+            UNION ALL SELECT comment_id, user_id, 'dislike' FROM dislikes
+            UNION ALL SELECT comment_id, NULL, 'upheld' FROM complaints WHERE status = 'upheld'
+        ) x ON x.comment_id = c.id
+            AND NOT EXISTS (SELECT 1 FROM users u WHERE u.id = x.user_id AND u.nickname = c.author)
+        WHERE c.author IS NOT NULL
+        GROUP BY c.author
+    `
+	if _, err := exec(ctx, tx, `DELETE FROM user_reputation`); err != nil {
+		log.Error(err)
+		return err
+	}
+	if _, err := exec(ctx, tx, query); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *reputationRepo) DeleteReputationEvents(ctx context.Context, before time.Time) (int64, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "reputation", "DeleteReputationEvents")
+	defer st.end()
+
+	result, err := exec(ctx, r.db, `DELETE FROM reputation_events WHERE applied < $1`, before)
+	if err != nil {
+		log.Error(err)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,280 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	model "github.com/demkowo/forum/models"
+	logger "github.com/demkowo/forum/utils/logger"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	CHECK_IF_EXIST_SPAM_SAMPLES = "SELECT to_regclass('public.spam_samples')"
+	CHECK_IF_EXIST_SPAM_TOKENS  = "SELECT to_regclass('public.spam_tokens')"
+	CHECK_IF_EXIST_SPAM_STATS   = "SELECT to_regclass('public.spam_stats')"
+	CREATE_TABLE_SPAM_SAMPLES   = `CREATE TABLE spam_samples (
+    comment_id UUID PRIMARY KEY,
+    spam BOOLEAN NOT NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL,
+    FOREIGN KEY (comment_id) REFERENCES comments(id) ON DELETE CASCADE
+	);`
+	CREATE_TABLE_SPAM_TOKENS = `CREATE TABLE spam_tokens (
+    token varchar(64) PRIMARY KEY,
+    spam_count INTEGER NOT NULL DEFAULT 0,
+    ham_count INTEGER NOT NULL DEFAULT 0
+	);`
+	CREATE_TABLE_SPAM_STATS = `CREATE TABLE spam_stats (
+    id SMALLINT PRIMARY KEY CHECK (id = 1),
+    spam_docs INTEGER NOT NULL DEFAULT 0,
+    ham_docs INTEGER NOT NULL DEFAULT 0,
+    updated TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	);`
+)
+
+type SpamRepo interface {
+	CreateTableSpamSamples() string
+	CreateTableSpamTokens() string
+	CreateTableSpamStats() string
+
+	AddSpamSample(ctx context.Context, sample model.SpamSample) (*model.SpamSample, error)
+	FindSpamSamples(ctx context.Context) ([]model.SpamSample, error)
+
+	GetSpamModel(ctx context.Context) (*model.SpamModel, error)
+	UpdateSpamModel(ctx context.Context, delta model.SpamModel) error
+	ReplaceSpamModel(ctx context.Context, spamModel model.SpamModel) error
+}
+
+type spamRepo struct {
+	db *sql.DB
+}
+
+func NewSpam(db *sql.DB) SpamRepo {
+	log.Trace()
+
+	return &spamRepo{
+		db: db,
+	}
+}
+
+func (r *spamRepo) CreateTableSpamSamples() string {
+	log.Trace()
+
+	return createTable(r.db, "spam_samples", CHECK_IF_EXIST_SPAM_SAMPLES, CREATE_TABLE_SPAM_SAMPLES)
+}
+
+func (r *spamRepo) CreateTableSpamTokens() string {
+	log.Trace()
+
+	return createTable(r.db, "spam_tokens", CHECK_IF_EXIST_SPAM_TOKENS, CREATE_TABLE_SPAM_TOKENS)
+}
+
+func (r *spamRepo) CreateTableSpamStats() string {
+	log.Trace()
+
+	return createTable(r.db, "spam_stats", CHECK_IF_EXIST_SPAM_STATS, CREATE_TABLE_SPAM_STATS)
+}
+
+// AddSpamSample stores the moderator decision for a comment and returns the
+// decision it replaced, or nil if the comment was not labelled before.
+func (r *spamRepo) AddSpamSample(ctx context.Context, sample model.SpamSample) (*model.SpamSample, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "spam", "AddSpamSample")
+	defer st.end()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var previous *model.SpamSample
+	var prev model.SpamSample
+	err = queryRow(ctx, tx, `SELECT comment_id, spam, created FROM spam_samples WHERE comment_id = $1 FOR UPDATE`, sample.CommentId).
+		Scan(&prev.CommentId, &prev.Spam, &prev.Created)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		log.Error(err)
+		return nil, err
+	default:
+		previous = &prev
+	}
+
+	query := `
+        INSERT INTO spam_samples (comment_id, spam, created)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (comment_id) DO UPDATE SET spam = EXCLUDED.spam, created = EXCLUDED.created
+    `
+	if _, err := exec(ctx, tx, query, sample.CommentId, sample.Spam, sample.Created); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		return nil, err
+	}
+
+	return previous, nil
+}
+
+func (r *spamRepo) FindSpamSamples(ctx context.Context) ([]model.SpamSample, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "spam", "FindSpamSamples")
+	defer st.end()
+
+	query := `
+        SELECT s.comment_id, c.content, s.spam, s.created
+        FROM spam_samples s
+        JOIN comments c ON c.id = s.comment_id
+    `
+	rows, err := queryRows(ctx, r.db, query)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var samples []model.SpamSample
+	for rows.Next() {
+		var sample model.SpamSample
+		if err := rows.Scan(&sample.CommentId, &sample.Content, &sample.Spam, &sample.Created); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+
+	return samples, rows.Err()
+}
+
+func (r *spamRepo) GetSpamModel(ctx context.Context) (*model.SpamModel, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "spam", "GetSpamModel")
+	defer st.end()
+
+	spamModel := &model.SpamModel{Tokens: make(map[string]model.SpamToken)}
+
+	err := queryRow(ctx, r.db, `SELECT spam_docs, ham_docs FROM spam_stats WHERE id = 1`).Scan(&spamModel.SpamDocs, &spamModel.HamDocs)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(err)
+		return nil, err
+	}
+
+	rows, err := queryRows(ctx, r.db, `SELECT token, spam_count, ham_count FROM spam_tokens`)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var token model.SpamToken
+		if err := rows.Scan(&token.Token, &token.Spam, &token.Ham); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		spamModel.Tokens[token.Token] = token
+	}
+
+	return spamModel, rows.Err()
+}
+
+// UpdateSpamModel adds the counts in delta (which may be negative) to the
+// persisted model.
+func (r *spamRepo) UpdateSpamModel(ctx context.Context, delta model.SpamModel) error {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "spam", "UpdateSpamModel")
+	defer st.end()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO spam_stats (id, spam_docs, ham_docs, updated)
+        VALUES (1, GREATEST($1, 0), GREATEST($2, 0), now())
+        ON CONFLICT (id) DO UPDATE SET
+            spam_docs = GREATEST(spam_stats.spam_docs + $1, 0),
+            ham_docs = GREATEST(spam_stats.ham_docs + $2, 0),
+            updated = now()
+    `
+	if _, err := exec(ctx, tx, query, delta.SpamDocs, delta.HamDocs); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	query = `
+        INSERT INTO spam_tokens (token, spam_count, ham_count)
+        VALUES ($1, GREATEST($2, 0), GREATEST($3, 0))
+        ON CONFLICT (token) DO UPDATE SET
+            spam_count = GREATEST(spam_tokens.spam_count + $2, 0),
+            ham_count = GREATEST(spam_tokens.ham_count + $3, 0)
+    `
+	for _, token := range delta.Tokens {
+		if _, err := exec(ctx, tx, query, token.Token, token.Spam, token.Ham); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// ReplaceSpamModel overwrites the persisted model, used after a full retrain.
+func (r *spamRepo) ReplaceSpamModel(ctx context.Context, spamModel model.SpamModel) error {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "spam", "ReplaceSpamModel")
+	defer st.end()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := exec(ctx, tx, `DELETE FROM spam_tokens`); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	query := `
+        INSERT INTO spam_stats (id, spam_docs, ham_docs, updated)
+        VALUES (1, $1, $2, now())
+        ON CONFLICT (id) DO UPDATE SET spam_docs = $1, ham_docs = $2, updated = now()
+    `
+	if _, err := exec(ctx, tx, query, spamModel.SpamDocs, spamModel.HamDocs); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	for _, token := range spamModel.Tokens {
+		if _, err := exec(ctx, tx, `INSERT INTO spam_tokens (token, spam_count, ham_count) VALUES ($1, $2, $3)`, token.Token, token.Spam, token.Ham); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/demkowo/forum/metrics"
+	"github.com/demkowo/forum/tracing"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type statementKey struct{}
+
+// statement is the database work of one repository method. It is traced as
+// a client span named postgres.<repository>.<method> and timed in
+// forum_db_query_duration_seconds. exec, queryRows and queryRow add the
+// rows affected and the errors of the queries they run to it.
+type statement struct {
+	span     trace.Span
+	timer    *prometheus.Timer
+	affected int64
+	wrote    bool
+}
+
+func startStatement(ctx context.Context, repository, method string) (context.Context, *statement) {
+	ctx, span := tracing.Start(ctx, "postgres."+repository+"."+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", "postgresql"),
+			attribute.String("db.operation.name", method),
+			attribute.String("db.statement.name", repository+"."+method),
+		))
+
+	s := &statement{span: span, timer: metrics.QueryTimer(repository, method)}
+	return context.WithValue(ctx, statementKey{}, s), s
+}
+
+func (s *statement) end() {
+	if s.wrote {
+		s.span.SetAttributes(attribute.Int64("db.rows_affected", s.affected))
+	}
+	s.timer.ObserveDuration()
+	s.span.End()
+}
+
+// fail records err on the span. sql.ErrNoRows is an answer, not a failure.
+func (s *statement) fail(err error) {
+	if s == nil || err == nil || errors.Is(err, sql.ErrNoRows) {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func statementFrom(ctx context.Context) *statement {
+	s, _ := ctx.Value(statementKey{}).(*statement)
+	return s
+}
+
+// querier is implemented by *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func exec(ctx context.Context, q querier, query string, args ...any) (sql.Result, error) {
+	result, err := q.ExecContext(ctx, query, args...)
+	s := statementFrom(ctx)
+	if err != nil {
+		s.fail(err)
+		return result, err
+	}
+
+	if s != nil {
+		if n, err := result.RowsAffected(); err == nil {
+			s.affected += n
+			s.wrote = true
+		}
+	}
+	return result, nil
+}
+
+func queryRows(ctx context.Context, q querier, query string, args ...any) (*sql.Rows, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	statementFrom(ctx).fail(err)
+	return rows, err
+}
+
+func queryRow(ctx context.Context, q querier, query string, args ...any) *sql.Row {
+	row := q.QueryRowContext(ctx, query, args...)
+	statementFrom(ctx).fail(row.Err())
+	return row
+}
@@ -0,0 +1,29 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// createTable runs the create statement unless the check query reports that
+// the table already exists.
+func createTable(db *sql.DB, name, check, create string) string {
+	log.Trace()
+
+	var tableName sql.NullString
+	if err := db.QueryRow(check).Scan(&tableName); err != nil {
+		log.Panicf("check if table %s exists failed: %v", name, err)
+	}
+
+	if tableName.Valid {
+		return fmt.Sprintf("DB %s ready to go", name)
+	}
+
+	if _, err := db.Exec(create); err != nil {
+		log.Panicf("create table %s failed: %v", name, err)
+	}
+
+	return fmt.Sprintf("Table %s created, DB ready to go", name)
+}
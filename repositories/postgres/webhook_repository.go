@@ -0,0 +1,433 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	model "github.com/demkowo/forum/models"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	CHECK_IF_EXIST_WEBHOOKS             = "SELECT to_regclass('public.webhooks')"
+	CHECK_IF_EXIST_WEBHOOK_DELIVERIES   = "SELECT to_regclass('public.webhook_deliveries')"
+	CHECK_IF_EXIST_WEBHOOK_DEAD_LETTERS = "SELECT to_regclass('public.webhook_dead_letters')"
+	CREATE_TABLE_WEBHOOKS               = `CREATE TABLE webhooks (
+    id UUID PRIMARY KEY,
+    url TEXT NOT NULL,
+    events TEXT[] NOT NULL,
+    secret TEXT NOT NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL
+	);`
+	CREATE_TABLE_WEBHOOK_DELIVERIES = `CREATE TABLE webhook_deliveries (
+    id UUID PRIMARY KEY,
+    webhook_id UUID NOT NULL,
+    event_id UUID NOT NULL,
+    event_type varchar(32) NOT NULL,
+    payload JSONB NOT NULL,
+    status varchar(16) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_attempt TIMESTAMP WITH TIME ZONE NOT NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL,
+    FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+	);
+	CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (next_attempt) WHERE status = 'pending';
+	CREATE INDEX webhook_deliveries_event_idx ON webhook_deliveries (webhook_id, event_id);`
+	CREATE_TABLE_WEBHOOK_DEAD_LETTERS = `CREATE TABLE webhook_dead_letters (
+    id UUID PRIMARY KEY,
+    webhook_id UUID NOT NULL,
+    event_id UUID NOT NULL,
+    event_type varchar(32) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INTEGER NOT NULL,
+    last_error TEXT NOT NULL,
+    created TIMESTAMP WITH TIME ZONE NOT NULL,
+    failed TIMESTAMP WITH TIME ZONE NOT NULL,
+    FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+	);
+	CREATE INDEX webhook_dead_letters_event_idx ON webhook_dead_letters (webhook_id, event_id);`
+)
+
+type WebhookRepo interface {
+	CreateTableWebhooks() string
+	CreateTableWebhookDeliveries() string
+	CreateTableWebhookDeadLetters() string
+
+	AddWebhook(ctx context.Context, webhook model.Webhook) error
+	DeleteWebhook(ctx context.Context, id uuid.UUID) error
+	FindWebhooks(ctx context.Context) ([]model.Webhook, error)
+	FindWebhooksForEvent(ctx context.Context, eventType string) ([]model.Webhook, error)
+
+	AddDeliveries(ctx context.Context, deliveries []model.WebhookDelivery) error
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error)
+	MarkDelivered(ctx context.Context, id uuid.UUID, attempts int) error
+	RetryDelivery(ctx context.Context, id uuid.UUID, attempts int, nextAttempt time.Time, lastError string) error
+	DeadLetterDelivery(ctx context.Context, id uuid.UUID, attempts int, lastError string) error
+	FindDeliveries(ctx context.Context, webhookId uuid.UUID) ([]model.WebhookDelivery, error)
+	FindDeadLetters(ctx context.Context) ([]model.WebhookDelivery, error)
+	ReplayDelivery(ctx context.Context, id uuid.UUID) (uuid.UUID, error)
+}
+
+type webhookRepo struct {
+	db *sql.DB
+}
+
+func NewWebhook(db *sql.DB) WebhookRepo {
+	log.Trace()
+
+	return &webhookRepo{
+		db: db,
+	}
+}
+
+func (r *webhookRepo) CreateTableWebhooks() string {
+	log.Trace()
+
+	return createTable(r.db, "webhooks", CHECK_IF_EXIST_WEBHOOKS, CREATE_TABLE_WEBHOOKS)
+}
+
+func (r *webhookRepo) CreateTableWebhookDeliveries() string {
+	log.Trace()
+
+	return createTable(r.db, "webhook_deliveries", CHECK_IF_EXIST_WEBHOOK_DELIVERIES, CREATE_TABLE_WEBHOOK_DELIVERIES)
+}
+
+func (r *webhookRepo) CreateTableWebhookDeadLetters() string {
+	log.Trace()
+
+	return createTable(r.db, "webhook_dead_letters", CHECK_IF_EXIST_WEBHOOK_DEAD_LETTERS, CREATE_TABLE_WEBHOOK_DEAD_LETTERS)
+}
+
+func (r *webhookRepo) AddWebhook(ctx context.Context, webhook model.Webhook) error {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "webhook", "AddWebhook")
+	defer st.end()
+
+	query := `INSERT INTO webhooks (id, url, events, secret, created) VALUES ($1, $2, $3, $4, $5)`
+
+	_, err := exec(ctx, r.db, query, webhook.Id, webhook.URL, pq.Array(webhook.Events), webhook.Secret, webhook.Created)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *webhookRepo) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "webhook", "DeleteWebhook")
+	defer st.end()
+
+	result, err := exec(ctx, r.db, `DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	if rowsAffected == 0 {
+		log.Warn("webhook not found")
+		return errors.New("webhook not found")
+	}
+
+	return nil
+}
+
+func (r *webhookRepo) FindWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "webhook", "FindWebhooks")
+	defer st.end()
+
+	return r.findWebhooks(ctx, `SELECT id, url, events, '', created FROM webhooks ORDER BY created`)
+}
+
+// FindWebhooksForEvent returns the subscriptions, including secrets, whose
+// filter contains eventType or "*".
+func (r *webhookRepo) FindWebhooksForEvent(ctx context.Context, eventType string) ([]model.Webhook, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "webhook", "FindWebhooksForEvent")
+	defer st.end()
+
+	return r.findWebhooks(ctx, `SELECT id, url, events, secret, created FROM webhooks WHERE $1 = ANY(events) OR '*' = ANY(events)`, eventType)
+}
+
+func (r *webhookRepo) findWebhooks(ctx context.Context, query string, args ...interface{}) ([]model.Webhook, error) {
+	log := logger.FromContext(ctx)
+
+	rows, err := queryRows(ctx, r.db, query, args...)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []model.Webhook
+	for rows.Next() {
+		var webhook model.Webhook
+		if err := rows.Scan(&webhook.Id, &webhook.URL, pq.Array(&webhook.Events), &webhook.Secret, &webhook.Created); err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// AddDeliveries queues the deliveries, skipping events a webhook already has
+// a delivery or dead letter for, so republished events are not sent twice.
+func (r *webhookRepo) AddDeliveries(ctx context.Context, deliveries []model.WebhookDelivery) error {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "webhook", "AddDeliveries")
+	defer st.end()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, payload, status, attempts, last_error, next_attempt, created)
+        SELECT $1, $2, $3, $4, $5, $6, 0, '', $7, $7
+        WHERE NOT EXISTS (SELECT 1 FROM webhook_deliveries WHERE webhook_id = $2 AND event_id = $3)
+        AND NOT EXISTS (SELECT 1 FROM webhook_dead_letters WHERE webhook_id = $2 AND event_id = $3)
+    `
+	for _, d := range deliveries {
+		if _, err := exec(ctx, tx, query, d.Id, d.WebhookId, d.EventId, d.EventType, string(d.Payload), model.DeliveryPending, d.Created); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// ClaimDueDeliveries returns up to limit pending deliveries whose next
+// attempt is due and pushes their next attempt lease into the future, so
+// other workers skip them while they are being sent.
+func (r *webhookRepo) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "webhook", "ClaimDueDeliveries")
+	defer st.end()
+
+	query := `
+        UPDATE webhook_deliveries d
+        SET next_attempt = now() + $2 * interval '1 millisecond'
+        FROM webhooks w
+        WHERE w.id = d.webhook_id AND d.id IN (
+            SELECT id FROM webhook_deliveries
+            WHERE status = 'pending' AND next_attempt <= now()
+            ORDER BY next_attempt
+            LIMIT $1
+            FOR UPDATE SKIP LOCKED
+        )
+        RETURNING d.id, d.webhook_id, d.event_id, d.event_type, d.payload, d.status, d.attempts, d.last_error, d.next_attempt, d.created, w.url, w.secret
+    `
+	rows, err := queryRows(ctx, r.db, query, limit, lease.Milliseconds())
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []model.WebhookDelivery
+	for rows.Next() {
+		var d model.WebhookDelivery
+		err := rows.Scan(&d.Id, &d.WebhookId, &d.EventId, &d.EventType, (*[]byte)(&d.Payload), &d.Status, &d.Attempts, &d.LastError, &d.NextAttempt, &d.Created, &d.URL, &d.Secret)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (r *webhookRepo) MarkDelivered(ctx context.Context, id uuid.UUID, attempts int) error {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "webhook", "MarkDelivered")
+	defer st.end()
+
+	_, err := exec(ctx, r.db, `UPDATE webhook_deliveries SET status = $2, attempts = $3, last_error = '' WHERE id = $1`, id, model.DeliveryDelivered, attempts)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *webhookRepo) RetryDelivery(ctx context.Context, id uuid.UUID, attempts int, nextAttempt time.Time, lastError string) error {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "webhook", "RetryDelivery")
+	defer st.end()
+
+	_, err := exec(ctx, r.db, `UPDATE webhook_deliveries SET attempts = $2, next_attempt = $3, last_error = $4 WHERE id = $1`, id, attempts, nextAttempt, lastError)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+// DeadLetterDelivery moves a delivery that ran out of attempts to the dead
+// letter table, keeping its id so it can be replayed.
+func (r *webhookRepo) DeadLetterDelivery(ctx context.Context, id uuid.UUID, attempts int, lastError string) error {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "webhook", "DeadLetterDelivery")
+	defer st.end()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Error(err)
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+        INSERT INTO webhook_dead_letters (id, webhook_id, event_id, event_type, payload, attempts, last_error, created, failed)
+        SELECT id, webhook_id, event_id, event_type, payload, $2, $3, created, now()
+        FROM webhook_deliveries WHERE id = $1
+    `
+	if _, err := exec(ctx, tx, query, id, attempts, lastError); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	if _, err := exec(ctx, tx, `DELETE FROM webhook_deliveries WHERE id = $1`, id); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Error(err)
+		return err
+	}
+
+	return nil
+}
+
+func (r *webhookRepo) FindDeliveries(ctx context.Context, webhookId uuid.UUID) ([]model.WebhookDelivery, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "webhook", "FindDeliveries")
+	defer st.end()
+
+	query := `
+        SELECT id, webhook_id, event_id, event_type, payload, status, attempts, last_error, next_attempt, created
+        FROM webhook_deliveries
+        WHERE webhook_id = $1
+        ORDER BY created DESC
+        LIMIT 100
+    `
+	return r.findDeliveries(ctx, query, webhookId)
+}
+
+func (r *webhookRepo) FindDeadLetters(ctx context.Context) ([]model.WebhookDelivery, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "webhook", "FindDeadLetters")
+	defer st.end()
+
+	query := `
+        SELECT id, webhook_id, event_id, event_type, payload, 'dead', attempts, last_error, failed, created
+        FROM webhook_dead_letters
+        ORDER BY failed DESC
+        LIMIT 100
+    `
+	return r.findDeliveries(ctx, query)
+}
+
+func (r *webhookRepo) findDeliveries(ctx context.Context, query string, args ...interface{}) ([]model.WebhookDelivery, error) {
+	log := logger.FromContext(ctx)
+
+	rows, err := queryRows(ctx, r.db, query, args...)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []model.WebhookDelivery
+	for rows.Next() {
+		var d model.WebhookDelivery
+		err := rows.Scan(&d.Id, &d.WebhookId, &d.EventId, &d.EventType, (*[]byte)(&d.Payload), &d.Status, &d.Attempts, &d.LastError, &d.NextAttempt, &d.Created)
+		if err != nil {
+			log.Error(err)
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// ReplayDelivery queues a fresh copy of a delivery or dead letter and
+// returns the id of the new delivery.
+func (r *webhookRepo) ReplayDelivery(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	log := logger.FromContext(ctx)
+	log.Trace()
+	ctx, st := startStatement(ctx, "webhook", "ReplayDelivery")
+	defer st.end()
+
+	newId := uuid.New()
+
+	query := `
+        INSERT INTO webhook_deliveries (id, webhook_id, event_id, event_type, payload, status, attempts, last_error, next_attempt, created)
+        SELECT $2, webhook_id, event_id, event_type, payload, 'pending', 0, '', now(), now()
+        FROM (
+            SELECT webhook_id, event_id, event_type, payload FROM webhook_deliveries WHERE id = $1
+            UNION ALL
+            SELECT webhook_id, event_id, event_type, payload FROM webhook_dead_letters WHERE id = $1
+        ) src
+        LIMIT 1
+    `
+	result, err := exec(ctx, r.db, query, id, newId)
+	if err != nil {
+		log.Error(err)
+		return uuid.Nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		log.Error(err)
+		return uuid.Nil, err
+	}
+
+	if rowsAffected == 0 {
+		log.Warn("delivery not found")
+		return uuid.Nil, errors.New("delivery not found")
+	}
+
+	return newId, nil
+}
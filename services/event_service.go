@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	model "github.com/demkowo/forum/models"
+	"github.com/demkowo/forum/repositories/postgres"
+	logger "github.com/demkowo/forum/utils/logger"
+	log "github.com/sirupsen/logrus"
+)
+
+// EventPublisher receives the domain events relayed from the outbox. Events
+// are delivered at least once, so publishers must tolerate duplicates and
+// can use Event.Id to drop them.
+type EventPublisher interface {
+	Publish(ctx context.Context, event model.Event) error
+}
+
+// Publishers fans an event out to several publishers. Every publisher gets
+// the event even when an earlier one fails, the errors are joined.
+type Publishers []EventPublisher
+
+func (p Publishers) Publish(ctx context.Context, event model.Event) error {
+	var errs []error
+	for _, publisher := range p {
+		if err := publisher.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// workerContext returns the context of a background worker. Its log entries
+// carry the worker name where those of a request carry the request id.
+func workerContext(worker string) context.Context {
+	return logger.WithFields(context.Background(), log.Fields{"worker": worker})
+}
+
+// running reports whether a worker was started and its goroutine, which
+// closes done when it returns, is still running.
+func running(started *atomic.Bool, done <-chan struct{}) bool {
+	if !started.Load() {
+		return false
+	}
+	select {
+	case <-done:
+		return false
+	default:
+		return true
+	}
+}
+
+type logPublisher struct{}
+
+// NewLogPublisher returns a publisher that writes every event to the log.
+func NewLogPublisher() EventPublisher {
+	log.Trace()
+
+	return &logPublisher{}
+}
+
+func (p *logPublisher) Publish(ctx context.Context, event model.Event) error {
+	logger.FromContext(ctx).WithFields(log.Fields{
+		"event_id":   event.Id,
+		"sequence":   event.Sequence,
+		"type":       event.Type,
+		"comment_id": event.CommentId,
+	}).Info("event published")
+	return nil
+}
+
+// Bus delivers events to subscribers in the same process.
+type Bus interface {
+	EventPublisher
+	Subscribe(handler func(event model.Event)) (unsubscribe func())
+}
+
+type bus struct {
+	mu       sync.RWMutex
+	next     int
+	handlers map[int]func(event model.Event)
+}
+
+func NewBus() Bus {
+	log.Trace()
+
+	return &bus{
+		handlers: make(map[int]func(event model.Event)),
+	}
+}
+
+// Publish calls every subscriber synchronously, handlers must not block.
+func (b *bus) Publish(ctx context.Context, event model.Event) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, handler := range b.handlers {
+		handler(event)
+	}
+	return nil
+}
+
+func (b *bus) Subscribe(handler func(event model.Event)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.next
+	b.next++
+	b.handlers[id] = handler
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, id)
+	}
+}
+
+// EventFeed passes the events announced by the event listener to the bus.
+type EventFeed interface {
+	Start()
+	Stop()
+	Running() bool
+}
+
+// eventFeed loads the events published by the outbox relay of any replica
+// and passes them to the in-process bus. It does not own the listener, which
+// is shared with the live service and closed by its creator.
+type eventFeed struct {
+	outbox   postgres.OutboxRepo
+	bus      Bus
+	listener postgres.EventListener
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+	started  atomic.Bool
+}
+
+func NewEventFeed(outbox postgres.OutboxRepo, bus Bus, listener postgres.EventListener) EventFeed {
+	log.Trace()
+
+	return &eventFeed{
+		outbox:   outbox,
+		bus:      bus,
+		listener: listener,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start feeds the bus until Stop is called or the listener is closed.
+func (f *eventFeed) Start() {
+	log.Trace()
+
+	f.started.Store(true)
+
+	go func() {
+		defer close(f.done)
+
+		ctx := workerContext("events")
+		log := logger.FromContext(ctx)
+		for {
+			select {
+			case <-f.stop:
+				return
+			case sequence, ok := <-f.listener.Sequences():
+				if !ok {
+					return
+				}
+				event, err := f.outbox.GetOutboxEvent(ctx, sequence)
+				if err != nil {
+					log.Errorf("Failed to load event %d: %v", sequence, err)
+					continue
+				}
+				f.bus.Publish(ctx, *event)
+			}
+		}
+	}()
+}
+
+func (f *eventFeed) Stop() {
+	log.Trace()
+
+	f.once.Do(func() {
+		close(f.stop)
+		<-f.done
+	})
+}
+
+// Running reports whether the worker was started and has not stopped.
+func (f *eventFeed) Running() bool {
+	return running(&f.started, f.done)
+}
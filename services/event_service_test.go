@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	model "github.com/demkowo/forum/models"
+	"github.com/demkowo/forum/repositories/postgres"
+)
+
+type fakeOutboxRepo struct {
+	postgres.OutboxRepo
+}
+
+func (r *fakeOutboxRepo) GetOutboxEvent(ctx context.Context, sequence int64) (*model.Event, error) {
+	return &model.Event{Sequence: sequence}, nil
+}
+
+type fakeListener struct {
+	sequences chan int64
+	closed    bool
+}
+
+func (l *fakeListener) Sequences() <-chan int64 {
+	return l.sequences
+}
+
+func (l *fakeListener) Presence() <-chan model.Presence {
+	return nil
+}
+
+func (l *fakeListener) Close() error {
+	l.closed = true
+	return nil
+}
+
+func TestEventFeedDrainsListenerWithoutStream(t *testing.T) {
+	const events = 300
+	listener := &fakeListener{sequences: make(chan int64)}
+	bus := NewBus()
+	received := make(chan int64, events)
+	bus.Subscribe(func(event model.Event) { received <- event.Sequence })
+
+	feed := NewEventFeed(&fakeOutboxRepo{}, bus, listener)
+	feed.Start()
+
+	for sequence := int64(1); sequence <= events; sequence++ {
+		select {
+		case listener.sequences <- sequence:
+		case <-time.After(time.Second):
+			t.Fatalf("listener stalled after %d events", sequence-1)
+		}
+	}
+	feed.Stop()
+
+	if feed.Running() {
+		t.Error("feed running after Stop")
+	}
+	if len(received) != events {
+		t.Errorf("bus got %d events, want %d", len(received), events)
+	}
+	if listener.closed {
+		t.Error("Stop closed the listener, which belongs to the caller")
+	}
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/demkowo/forum/config"
+	model "github.com/demkowo/forum/models"
+	"github.com/demkowo/forum/repositories/postgres"
+	"github.com/demkowo/forum/tracing"
+	logger "github.com/demkowo/forum/utils/logger"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	shingleSize = 3
+	// articleDuplicateMinShingles is the number of shingles from which a
+	// comment is compared with the other authors' comments on the article.
+	// Short replies such as "Thanks" or "+1" are legitimately posted by
+	// many users.
+	articleDuplicateMinShingles = 3
+)
+
+// FloodError is returned when a comment is posted too soon after the
+// previous one or repeats a recent comment. RetryAfter tells the client
+// when posting the same comment would be accepted again.
+type FloodError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *FloodError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", e.Reason, e.RetryAfter)
+}
+
+type Flood interface {
+	Check(ctx context.Context, comment model.Comment, recent postgres.RecentComments) error
+}
+
+type flood struct {
+	config config.Getter
+}
+
+func NewFlood(cfg config.Getter) Flood {
+	log.Trace()
+
+	return &flood{
+		config: cfg,
+	}
+}
+
+// Check rejects the comment if its author posted less than Flood.MinInterval
+// ago, or if the author posted a near-duplicate within Flood.Window. Comments
+// of at least articleDuplicateMinShingles shingles are also rejected when
+// anyone posted a near-duplicate on the same article. The recent comments
+// are read through recent.
+func (s *flood) Check(ctx context.Context, comment model.Comment, recent postgres.RecentComments) error {
+	ctx, span := tracing.Start(ctx, "flood.Check")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	cfg := s.config()
+	now := time.Now()
+	since := now.Add(-cfg.Flood.Window)
+
+	byAuthor, err := recent.FindRecentCommentsByAuthor(ctx, comment.Author, since)
+	if err != nil {
+		return err
+	}
+
+	if len(byAuthor) > 0 {
+		elapsed := now.Sub(byAuthor[0].Created)
+		if elapsed < cfg.Flood.MinInterval {
+			return &FloodError{
+				Reason:     "posting too fast",
+				RetryAfter: cfg.Flood.MinInterval - elapsed,
+			}
+		}
+	}
+
+	normalized := normalize(comment.Content)
+	hash := sha256.Sum256([]byte(normalized))
+	shingles := shingle(normalized)
+
+	recents := byAuthor
+	if len(shingles) >= articleDuplicateMinShingles {
+		byArticle, err := recent.FindRecentCommentsByArticle(ctx, comment.ArticleId, since)
+		if err != nil {
+			return err
+		}
+		recents = append(recents, byArticle...)
+	}
+
+	for _, recent := range recents {
+		recentNormalized := normalize(recent.Content)
+		if sha256.Sum256([]byte(recentNormalized)) != hash && jaccard(shingles, shingle(recentNormalized)) < cfg.Flood.DuplicateSimilarity {
+			continue
+		}
+
+		log.Warnf("duplicate of comment %s posted by %s", recent.Id, comment.Author)
+		return &FloodError{
+			Reason:     "duplicate comment",
+			RetryAfter: recent.Created.Add(cfg.Flood.Window).Sub(now),
+		}
+	}
+
+	return nil
+}
+
+// normalize lower-cases content and collapses everything that is not a
+// letter or digit into single spaces.
+func normalize(content string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// shingle returns the set of word n-grams of normalized content. Content
+// shorter than one shingle becomes a single shingle.
+func shingle(normalized string) map[string]struct{} {
+	words := strings.Fields(normalized)
+	shingles := make(map[string]struct{})
+
+	if len(words) < shingleSize {
+		shingles[normalized] = struct{}{}
+		return shingles
+	}
+
+	for i := 0; i+shingleSize <= len(words); i++ {
+		shingles[strings.Join(words[i:i+shingleSize], " ")] = struct{}{}
+	}
+
+	return shingles
+}
+
+func jaccard(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	intersection := 0
+	for key := range a {
+		if _, found := b[key]; found {
+			intersection++
+		}
+	}
+
+	return float64(intersection) / float64(len(a)+len(b)-intersection)
+}
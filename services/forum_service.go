@@ -1,48 +1,98 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/demkowo/forum/config"
+	"github.com/demkowo/forum/metrics"
 	model "github.com/demkowo/forum/models"
 	"github.com/demkowo/forum/repositories/postgres"
+	"github.com/demkowo/forum/tracing"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/demkowo/forum/utils/markdown"
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
 )
 
+var (
+	ErrSpamRejected   = errors.New("comment rejected as spam")
+	ErrUnknownMention = errors.New("mentioned user does not exist")
+	ErrEmptySearch    = errors.New("search query is empty")
+	ErrInvalidSort    = errors.New("invalid sort field")
+	// ErrComplaintClosed is returned for complaints on deleted comments and
+	// when the user's complaint on the comment was already decided.
+	ErrComplaintClosed = errors.New("comment is deleted or the complaint was already decided")
+
+	mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@.])@([\p{L}\p{N}_][\p{L}\p{N}_.-]{0,254})`)
+)
+
 type Forum interface {
 	CreateTableComments() string
 	CreateTableLikes() string
 	CreateTableDislikes() string
 	CreateTableComplaints() string
-
-	AddComment(comment model.Comment) error
-	DeleteComment(commentId uuid.UUID) error
-	GetComment(commentId uuid.UUID) (*model.Comment, error)
-	FindComments() ([]model.Comment, error)
-	FindCommentsByArticle(articleId uuid.UUID) ([]model.Comment, error)
-	CountCommentsByArticle(articleId uuid.UUID) (int, error)
-
-	AddLike(like model.Like) error
-	DeleteLike(like model.Like) error
-	FindLikesByComment(commentId uuid.UUID) ([]model.Like, error)
-	CountLikes(commentId uuid.UUID) (int, error)
-
-	AddDislike(dislike model.Dislike) error
-	DeleteDislike(model.Dislike) error
-	FindDislikesByComment(commentId uuid.UUID) ([]model.Dislike, error)
-	CountDislikes(commentId uuid.UUID) (int, error)
-
-	AddComplaint(model.Complaint) error
-	DeleteComplaint(uuid.UUID) error
-	FindComplaintsByComment(commentId uuid.UUID) ([]model.Complaint, error)
-	CountComplaints(commentId uuid.UUID) (int, error)
+	CreateTableMentions() string
+
+	AddComment(ctx context.Context, comment *model.Comment) error
+	DeleteComment(ctx context.Context, commentId uuid.UUID, moderator string) error
+	GetComment(ctx context.Context, commentId uuid.UUID) (*model.Comment, error)
+	ListComments(ctx context.Context, filter model.CommentFilter) ([]model.CommentListItem, int, error)
+	FindCommentsByArticle(ctx context.Context, articleId uuid.UUID) ([]model.Comment, error)
+	CountCommentsByArticle(ctx context.Context, articleId uuid.UUID) (int, error)
+	FindHeldComments(ctx context.Context) ([]model.Comment, error)
+	ApproveComment(ctx context.Context, commentId uuid.UUID) error
+	FindCommentsMentioning(ctx context.Context, nickname string) ([]model.Comment, error)
+	SearchComments(ctx context.Context, search model.CommentSearch) ([]model.CommentSearchResult, int, error)
+
+	AddLike(ctx context.Context, like model.Like) error
+	DeleteLike(ctx context.Context, like model.Like) error
+	FindLikesByComment(ctx context.Context, commentId uuid.UUID) ([]model.Like, error)
+	CountLikes(ctx context.Context, commentId uuid.UUID) (int, error)
+
+	AddDislike(ctx context.Context, dislike model.Dislike) error
+	DeleteDislike(ctx context.Context, dislike model.Dislike) error
+	FindDislikesByComment(ctx context.Context, commentId uuid.UUID) ([]model.Dislike, error)
+	CountDislikes(ctx context.Context, commentId uuid.UUID) (int, error)
+
+	AddComplaint(ctx context.Context, complaint model.Complaint) error
+	DeleteComplaint(ctx context.Context, id uuid.UUID) error
+	UpholdComplaint(ctx context.Context, id uuid.UUID) error
+	DismissComplaint(ctx context.Context, id uuid.UUID) error
+	FindComplaintsByComment(ctx context.Context, commentId uuid.UUID) ([]model.Complaint, error)
+	CountComplaints(ctx context.Context, commentId uuid.UUID) (int, error)
+
+	FindUserComments(ctx context.Context, nickname string, limit, offset int) ([]model.Comment, int, error)
+	FindUserLikedComments(ctx context.Context, nickname string, limit, offset int) ([]model.Comment, int, error)
+	FindUserDislikedComments(ctx context.Context, nickname string, limit, offset int) ([]model.Comment, int, error)
+	FindUserComplaints(ctx context.Context, nickname string, limit, offset int) ([]model.Complaint, int, error)
+	GetUserStats(ctx context.Context, nickname string) (*model.UserStats, error)
 }
 
 type forum struct {
-	repo postgres.ForumRepo
+	repo         postgres.ForumRepo
+	spam         Spam
+	flood        Flood
+	notification Notification
+	reputation   Reputation
+	config       config.Getter
 }
 
-func NewForum(repository postgres.ForumRepo) Forum {
+func NewForum(repository postgres.ForumRepo, spam Spam, flood Flood, notification Notification, reputation Reputation, cfg config.Getter) Forum {
 	return &forum{
-		repo: repository,
+		repo:         repository,
+		spam:         spam,
+		flood:        flood,
+		notification: notification,
+		reputation:   reputation,
+		config:       cfg,
 	}
 }
 
@@ -70,38 +120,253 @@ func (s *forum) CreateTableComplaints() string {
 	return s.repo.CreateTableComplaints()
 }
 
-func (s *forum) AddComment(comment model.Comment) error {
+func (s *forum) CreateTableMentions() string {
 	log.Trace()
 
-	return s.repo.AddComment(comment)
+	return s.repo.CreateTableMentions()
 }
 
-func (s *forum) DeleteComment(commentId uuid.UUID) error {
+// AddComment stores the comment unless it is flooding or spam. Comments
+// with a Spam.RejectWords word are rejected, those with a Spam.HoldWords
+// word are held. Mentions already set on the comment (the reply_to user)
+// must exist, @nicknames parsed from the content are kept only if they
+// belong to a user.
+func (s *forum) AddComment(ctx context.Context, comment *model.Comment) error {
+	ctx, span := tracing.Start(ctx, "forum.AddComment")
+	defer span.End()
+	log := logger.FromContext(ctx)
 	log.Trace()
-	return s.repo.DeleteComment(commentId)
+
+	if err := s.resolveMentions(ctx, comment); err != nil {
+		return err
+	}
+
+	cfg := s.config()
+
+	if containsWord(comment.Content, cfg.Spam.RejectWords) {
+		log.Warnf("comment from %s rejected, it contains a rejected word", comment.Author)
+		metrics.CommentsRejected.Inc()
+		return ErrSpamRejected
+	}
+
+	comment.SpamScore = s.spam.Score(comment.Content)
+	if comment.SpamScore >= cfg.Spam.RejectThreshold {
+		log.Warnf("comment from %s rejected as spam, score %.3f", comment.Author, comment.SpamScore)
+		metrics.CommentsRejected.Inc()
+		return ErrSpamRejected
+	}
+	comment.Held = comment.SpamScore >= cfg.Spam.HoldThreshold || containsWord(comment.Content, cfg.Spam.HoldWords)
+
+	if !comment.Held {
+		reputation, err := s.reputation.GetReputation(ctx, comment.Author)
+		if err != nil {
+			return err
+		}
+		if s.reputation.IsNewUser(*reputation) {
+			log.Infof("comment from new user %s held for review, reputation %.2f", comment.Author, reputation.Score)
+			comment.Held = true
+		}
+	}
+	comment.ContentHTML = markdown.Render(comment.Content)
+
+	var events []model.Event
+	if !comment.Held {
+		events = append(events, event(model.EventCommentCreated, comment.Id, comment))
+	}
+
+	// The flood check runs under the repository's locks so that concurrent
+	// posts of one author cannot all pass it.
+	check := func(recent postgres.RecentComments) error {
+		return s.flood.Check(ctx, *comment, recent)
+	}
+	if err := s.repo.AddComment(ctx, *comment, check, events...); err != nil {
+		return err
+	}
+
+	if comment.Held {
+		metrics.CommentsCreated.WithLabelValues(metrics.CommentHeld).Inc()
+	} else {
+		metrics.CommentsCreated.WithLabelValues(metrics.CommentPublished).Inc()
+		s.notifyComment(ctx, *comment)
+	}
+
+	return nil
 }
 
-func (s *forum) GetComment(commentId uuid.UUID) (*model.Comment, error) {
+// DeleteComment removes the comment. moderator is the nickname of the
+// moderator deleting it, or "" for other users; only a moderator deleting
+// someone else's comment counts as a moderation action and trains the spam
+// classifier.
+func (s *forum) DeleteComment(ctx context.Context, commentId uuid.UUID, moderator string) error {
+	ctx, span := tracing.Start(ctx, "forum.DeleteComment")
+	defer span.End()
+	log := logger.FromContext(ctx)
 	log.Trace()
-	return s.repo.GetComment(commentId)
+
+	comment, err := s.deleteComment(ctx, commentId)
+	if err != nil {
+		return err
+	}
+
+	if moderator != "" && comment != nil && comment.Author != moderator {
+		metrics.ModerationActions.WithLabelValues(metrics.ModerationDelete).Inc()
+		s.train(ctx, comment, true)
+	}
+	return nil
 }
 
-func (s *forum) FindComments() ([]model.Comment, error) {
+// deleteComment removes the comment. It returns the comment as it was
+// before, nil if it did not exist.
+func (s *forum) deleteComment(ctx context.Context, commentId uuid.UUID) (*model.Comment, error) {
+	comment, err := s.repo.GetComment(ctx, commentId)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := event(model.EventCommentDeleted, commentId, map[string]uuid.UUID{"id": commentId})
+	if err := s.repo.DeleteComment(ctx, commentId, deleted); err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+func (s *forum) GetComment(ctx context.Context, commentId uuid.UUID) (*model.Comment, error) {
+	ctx, span := tracing.Start(ctx, "forum.GetComment")
+	defer span.End()
+	log := logger.FromContext(ctx)
 	log.Trace()
-	return s.repo.FindComments()
+
+	comment, err := s.repo.GetComment(ctx, commentId)
+	if err != nil || comment == nil {
+		return comment, err
+	}
+
+	comment.ContentHTML = markdown.Render(comment.Content)
+	return comment, nil
 }
 
-func (s *forum) FindCommentsByArticle(articleId uuid.UUID) ([]model.Comment, error) {
+func (s *forum) ListComments(ctx context.Context, filter model.CommentFilter) ([]model.CommentListItem, int, error) {
+	ctx, span := tracing.Start(ctx, "forum.ListComments")
+	defer span.End()
+	log := logger.FromContext(ctx)
 	log.Trace()
-	return s.repo.FindCommentsByArticle(articleId)
+
+	if filter.Sort == "" {
+		filter.Sort = model.SortCreated
+	}
+	if !slices.Contains(model.CommentSortFields, filter.Sort) {
+		return nil, 0, fmt.Errorf("%w: %s", ErrInvalidSort, filter.Sort)
+	}
+
+	items, total, err := s.repo.ListComments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range items {
+		items[i].ContentHTML = markdown.Render(items[i].Content)
+	}
+
+	return items, total, nil
+}
+
+func (s *forum) FindCommentsByArticle(ctx context.Context, articleId uuid.UUID) ([]model.Comment, error) {
+	ctx, span := tracing.Start(ctx, "forum.FindCommentsByArticle")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	comments, err := s.repo.FindCommentsByArticle(ctx, articleId)
+	return render(comments), err
+}
+
+func (s *forum) CountCommentsByArticle(ctx context.Context, articleId uuid.UUID) (int, error) {
+	ctx, span := tracing.Start(ctx, "forum.CountCommentsByArticle")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+	return s.repo.CountCommentsByArticle(ctx, articleId)
+}
+
+func (s *forum) FindHeldComments(ctx context.Context) ([]model.Comment, error) {
+	ctx, span := tracing.Start(ctx, "forum.FindHeldComments")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	comments, err := s.repo.FindHeldComments(ctx)
+	return render(comments), err
+}
+
+func (s *forum) FindCommentsMentioning(ctx context.Context, nickname string) ([]model.Comment, error) {
+	ctx, span := tracing.Start(ctx, "forum.FindCommentsMentioning")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	comments, err := s.repo.FindCommentsMentioning(ctx, nickname)
+	return render(comments), err
+}
+
+func (s *forum) SearchComments(ctx context.Context, search model.CommentSearch) ([]model.CommentSearchResult, int, error) {
+	ctx, span := tracing.Start(ctx, "forum.SearchComments")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	search.Query = strings.TrimSpace(search.Query)
+	if search.Query == "" {
+		return nil, 0, ErrEmptySearch
+	}
+
+	results, total, err := s.repo.SearchComments(ctx, search)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range results {
+		results[i].ContentHTML = markdown.Render(results[i].Content)
+		results[i].Snippet = highlight(results[i].Snippet)
+	}
+
+	return results, total, nil
 }
 
-func (s *forum) CountCommentsByArticle(articleId uuid.UUID) (int, error) {
+func (s *forum) ApproveComment(ctx context.Context, commentId uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "forum.ApproveComment")
+	defer span.End()
+	log := logger.FromContext(ctx)
 	log.Trace()
-	return s.repo.CountCommentsByArticle(articleId)
+
+	comment, err := s.repo.GetComment(ctx, commentId)
+	if err != nil {
+		return err
+	}
+	if comment == nil {
+		return errors.New("comment not found")
+	}
+	if !comment.Held {
+		return errors.New("comment is not held")
+	}
+
+	comment.Held = false
+	comment.ContentHTML = markdown.Render(comment.Content)
+
+	if err := s.repo.ApproveComment(ctx, commentId, event(model.EventCommentApproved, commentId, comment)); err != nil {
+		return err
+	}
+
+	metrics.ModerationActions.WithLabelValues(metrics.ModerationApprove).Inc()
+	s.train(ctx, comment, false)
+	s.notifyComment(ctx, *comment)
+	return nil
 }
 
-func (s *forum) AddLike(like model.Like) error {
+func (s *forum) AddLike(ctx context.Context, like model.Like) error {
+	ctx, span := tracing.Start(ctx, "forum.AddLike")
+	defer span.End()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
 	dislike := model.Dislike{
@@ -109,31 +374,70 @@ func (s *forum) AddLike(like model.Like) error {
 		UserId:    like.UserId,
 	}
 
-	if err := s.repo.DeleteDislike(dislike); err != nil {
+	if err := s.repo.DeleteDislike(ctx, dislike, event(model.EventDislikeRemoved, dislike.CommentId, dislike)); err != nil {
 		if err.Error() != "dislike not found" {
 			return err
 		}
+	} else {
+		metrics.Reactions.WithLabelValues(metrics.ReactionDislike, metrics.ReactionRemoved).Inc()
 	}
 
-	return s.repo.AddLike(like)
+	added, err := s.repo.AddLike(ctx, like, event(model.EventLikeAdded, like.CommentId, like))
+	if err != nil {
+		return err
+	}
+	// liking a comment twice changes nothing and notifies nobody
+	if !added {
+		return nil
+	}
+	metrics.Reactions.WithLabelValues(metrics.ReactionLike, metrics.ReactionAdded).Inc()
+
+	comment, err := s.repo.GetComment(ctx, like.CommentId)
+	if err != nil {
+		log.Errorf("Failed to get liked comment: %v", err)
+		return nil
+	}
+	if comment != nil {
+		s.notification.NotifyLike(ctx, like, *comment)
+	}
+
+	return nil
 }
 
-func (s *forum) DeleteLike(like model.Like) error {
+func (s *forum) DeleteLike(ctx context.Context, like model.Like) error {
+	ctx, span := tracing.Start(ctx, "forum.DeleteLike")
+	defer span.End()
+	log := logger.FromContext(ctx)
 	log.Trace()
-	return s.repo.DeleteLike(like)
+
+	if err := s.repo.DeleteLike(ctx, like, event(model.EventLikeRemoved, like.CommentId, like)); err != nil {
+		return err
+	}
+
+	metrics.Reactions.WithLabelValues(metrics.ReactionLike, metrics.ReactionRemoved).Inc()
+	return nil
 }
 
-func (s *forum) FindLikesByComment(commentId uuid.UUID) ([]model.Like, error) {
+func (s *forum) FindLikesByComment(ctx context.Context, commentId uuid.UUID) ([]model.Like, error) {
+	ctx, span := tracing.Start(ctx, "forum.FindLikesByComment")
+	defer span.End()
+	log := logger.FromContext(ctx)
 	log.Trace()
-	return s.repo.FindLikesByComment(commentId)
+	return s.repo.FindLikesByComment(ctx, commentId)
 }
 
-func (f *forum) CountLikes(commentId uuid.UUID) (int, error) {
+func (f *forum) CountLikes(ctx context.Context, commentId uuid.UUID) (int, error) {
+	ctx, span := tracing.Start(ctx, "forum.CountLikes")
+	defer span.End()
+	log := logger.FromContext(ctx)
 	log.Trace()
-	return f.repo.CountLikes(commentId)
+	return f.repo.CountLikes(ctx, commentId)
 }
 
-func (s *forum) AddDislike(dislike model.Dislike) error {
+func (s *forum) AddDislike(ctx context.Context, dislike model.Dislike) error {
+	ctx, span := tracing.Start(ctx, "forum.AddDislike")
+	defer span.End()
+	log := logger.FromContext(ctx)
 	log.Trace()
 
 	like := model.Like{
@@ -141,46 +445,335 @@ func (s *forum) AddDislike(dislike model.Dislike) error {
 		UserId:    dislike.UserId,
 	}
 
-	if err := s.repo.DeleteLike(like); err != nil {
+	if err := s.repo.DeleteLike(ctx, like, event(model.EventLikeRemoved, like.CommentId, like)); err != nil {
 		if err.Error() != "like not found" {
 			return err
 		}
+	} else {
+		metrics.Reactions.WithLabelValues(metrics.ReactionLike, metrics.ReactionRemoved).Inc()
 	}
 
-	return s.repo.AddDislike(dislike)
+	added, err := s.repo.AddDislike(ctx, dislike, event(model.EventDislikeAdded, dislike.CommentId, dislike))
+	if err != nil {
+		return err
+	}
+
+	if added {
+		metrics.Reactions.WithLabelValues(metrics.ReactionDislike, metrics.ReactionAdded).Inc()
+	}
+	return nil
 }
 
-func (s *forum) DeleteDislike(dislike model.Dislike) error {
+func (s *forum) DeleteDislike(ctx context.Context, dislike model.Dislike) error {
+	ctx, span := tracing.Start(ctx, "forum.DeleteDislike")
+	defer span.End()
+	log := logger.FromContext(ctx)
 	log.Trace()
-	return s.repo.DeleteDislike(dislike)
+
+	if err := s.repo.DeleteDislike(ctx, dislike, event(model.EventDislikeRemoved, dislike.CommentId, dislike)); err != nil {
+		return err
+	}
+
+	metrics.Reactions.WithLabelValues(metrics.ReactionDislike, metrics.ReactionRemoved).Inc()
+	return nil
+}
+
+func (s *forum) FindDislikesByComment(ctx context.Context, commentId uuid.UUID) ([]model.Dislike, error) {
+	ctx, span := tracing.Start(ctx, "forum.FindDislikesByComment")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+	return s.repo.FindDislikesByComment(ctx, commentId)
+}
+
+func (s *forum) CountDislikes(ctx context.Context, commentId uuid.UUID) (int, error) {
+	ctx, span := tracing.Start(ctx, "forum.CountDislikes")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+	return s.repo.CountDislikes(ctx, commentId)
+}
+
+func (s *forum) AddComplaint(ctx context.Context, complaint model.Complaint) error {
+	ctx, span := tracing.Start(ctx, "forum.AddComplaint")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	reputation, err := s.reputation.GetReputationByUserId(ctx, complaint.UserId)
+	if err != nil {
+		return err
+	}
+
+	complaint.Status = model.ComplaintOpen
+	complaint.Weight = s.reputation.ComplaintWeight(*reputation)
+	added, err := s.repo.AddComplaint(ctx, complaint, event(model.EventComplaintCreated, complaint.CommentId, complaint))
+	if err != nil {
+		return err
+	}
+	if !added {
+		return ErrComplaintClosed
+	}
+
+	metrics.ComplaintsFiled.Inc()
+	return nil
+}
+
+func (s *forum) DeleteComplaint(ctx context.Context, id uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "forum.DeleteComplaint")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	complaint, err := s.repo.GetComplaint(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.DeleteComplaint(ctx, id, event(model.EventComplaintDeleted, complaint.CommentId, complaint))
+}
+
+func (s *forum) UpholdComplaint(ctx context.Context, id uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "forum.UpholdComplaint")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	complaint, err := s.repo.GetComplaint(ctx, id)
+	if err != nil {
+		return err
+	}
+	if complaint.Status == model.ComplaintUpheld {
+		return nil
+	}
+
+	comment, err := s.deleteComment(ctx, complaint.CommentId)
+	if err != nil {
+		return err
+	}
+
+	previous := complaint.Status
+	complaint.Status = model.ComplaintUpheld
+	if err := s.repo.UpdateComplaintStatus(ctx, id, previous, model.ComplaintUpheld, event(model.EventComplaintUpheld, complaint.CommentId, complaint)); err != nil {
+		return err
+	}
+
+	metrics.ModerationActions.WithLabelValues(metrics.ModerationUphold).Inc()
+	if comment != nil {
+		s.train(ctx, comment, true)
+	}
+	return nil
+}
+
+func (s *forum) DismissComplaint(ctx context.Context, id uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "forum.DismissComplaint")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	complaint, err := s.repo.GetComplaint(ctx, id)
+	if err != nil {
+		return err
+	}
+	if complaint.Status == model.ComplaintDismissed {
+		return nil
+	}
+
+	// previous_status tells the reputation to take back the penalty of a
+	// complaint that was upheld before.
+	previous := complaint.Status
+	complaint.Status = model.ComplaintDismissed
+	dismissed := event(model.EventComplaintDismissed, complaint.CommentId, struct {
+		*model.Complaint
+		PreviousStatus string `json:"previous_status"`
+	}{complaint, previous})
+	if err := s.repo.UpdateComplaintStatus(ctx, id, previous, model.ComplaintDismissed, dismissed); err != nil {
+		return err
+	}
+	metrics.ModerationActions.WithLabelValues(metrics.ModerationDismiss).Inc()
+
+	comment, err := s.repo.GetComment(ctx, complaint.CommentId)
+	if err != nil {
+		return err
+	}
+	if comment != nil {
+		s.train(ctx, comment, false)
+	}
+
+	return nil
+}
+
+func (s *forum) FindComplaintsByComment(ctx context.Context, commentId uuid.UUID) ([]model.Complaint, error) {
+	ctx, span := tracing.Start(ctx, "forum.FindComplaintsByComment")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+	return s.repo.FindComplaintsByComment(ctx, commentId)
 }
 
-func (s *forum) FindDislikesByComment(commentId uuid.UUID) ([]model.Dislike, error) {
+func (s *forum) CountComplaints(ctx context.Context, commentId uuid.UUID) (int, error) {
+	ctx, span := tracing.Start(ctx, "forum.CountComplaints")
+	defer span.End()
+	log := logger.FromContext(ctx)
 	log.Trace()
-	return s.repo.FindDislikesByComment(commentId)
+	return s.repo.CountComplaints(ctx, commentId)
 }
 
-func (s *forum) CountDislikes(commentId uuid.UUID) (int, error) {
+func (s *forum) FindUserComments(ctx context.Context, nickname string, limit, offset int) ([]model.Comment, int, error) {
+	ctx, span := tracing.Start(ctx, "forum.FindUserComments")
+	defer span.End()
+	log := logger.FromContext(ctx)
 	log.Trace()
-	return s.repo.CountDislikes(commentId)
+
+	comments, total, err := s.repo.FindCommentsByAuthor(ctx, nickname, limit, offset)
+	return render(comments), total, err
 }
 
-func (s *forum) AddComplaint(complaint model.Complaint) error {
+func (s *forum) FindUserLikedComments(ctx context.Context, nickname string, limit, offset int) ([]model.Comment, int, error) {
+	ctx, span := tracing.Start(ctx, "forum.FindUserLikedComments")
+	defer span.End()
+	log := logger.FromContext(ctx)
 	log.Trace()
-	return s.repo.AddComplaint(complaint)
+
+	comments, total, err := s.repo.FindCommentsLikedBy(ctx, nickname, limit, offset)
+	return render(comments), total, err
 }
 
-func (s *forum) DeleteComplaint(id uuid.UUID) error {
+func (s *forum) FindUserDislikedComments(ctx context.Context, nickname string, limit, offset int) ([]model.Comment, int, error) {
+	ctx, span := tracing.Start(ctx, "forum.FindUserDislikedComments")
+	defer span.End()
+	log := logger.FromContext(ctx)
 	log.Trace()
-	return s.repo.DeleteComplaint(id)
+
+	comments, total, err := s.repo.FindCommentsDislikedBy(ctx, nickname, limit, offset)
+	return render(comments), total, err
 }
 
-func (s *forum) FindComplaintsByComment(commentId uuid.UUID) ([]model.Complaint, error) {
+func (s *forum) FindUserComplaints(ctx context.Context, nickname string, limit, offset int) ([]model.Complaint, int, error) {
+	ctx, span := tracing.Start(ctx, "forum.FindUserComplaints")
+	defer span.End()
+	log := logger.FromContext(ctx)
 	log.Trace()
-	return s.repo.FindComplaintsByComment(commentId)
+	return s.repo.FindComplaintsByUser(ctx, nickname, limit, offset)
 }
 
-func (s *forum) CountComplaints(commentId uuid.UUID) (int, error) {
+func (s *forum) GetUserStats(ctx context.Context, nickname string) (*model.UserStats, error) {
+	ctx, span := tracing.Start(ctx, "forum.GetUserStats")
+	defer span.End()
+	log := logger.FromContext(ctx)
 	log.Trace()
-	return s.repo.CountComplaints(commentId)
+	return s.repo.GetUserStats(ctx, nickname)
+}
+
+func (s *forum) resolveMentions(ctx context.Context, comment *model.Comment) error {
+	required := comment.Mentions
+	parsed := parseMentions(comment.Content)
+
+	existing, err := s.repo.FindExistingNicknames(ctx, append(append([]string{}, required...), parsed...))
+	if err != nil {
+		return err
+	}
+
+	exists := make(map[string]bool, len(existing))
+	for _, nickname := range existing {
+		exists[nickname] = true
+	}
+
+	seen := make(map[string]bool)
+	comment.Mentions = nil
+	for _, nickname := range required {
+		if !exists[nickname] {
+			return fmt.Errorf("%w: %s", ErrUnknownMention, nickname)
+		}
+		if !seen[nickname] {
+			seen[nickname] = true
+			comment.Mentions = append(comment.Mentions, nickname)
+		}
+	}
+	for _, nickname := range parsed {
+		if exists[nickname] && !seen[nickname] {
+			seen[nickname] = true
+			comment.Mentions = append(comment.Mentions, nickname)
+		}
+	}
+
+	return nil
+}
+
+// parseMentions returns the distinct @nicknames in content.
+func parseMentions(content string) []string {
+	var nicknames []string
+	seen := make(map[string]bool)
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		nickname := strings.TrimRight(match[1], ".-")
+		if nickname == "" || seen[nickname] {
+			continue
+		}
+		seen[nickname] = true
+		nicknames = append(nicknames, nickname)
+	}
+
+	return nicknames
+}
+
+// notifyComment notifies the author of the parent comment and every
+// mentioned user about a published comment.
+func (s *forum) notifyComment(ctx context.Context, comment model.Comment) {
+	log := logger.FromContext(ctx)
+
+	if comment.ParentId != uuid.Nil {
+		parent, err := s.repo.GetComment(ctx, comment.ParentId)
+		if err != nil {
+			log.Errorf("Failed to get parent comment: %v", err)
+		} else if parent != nil {
+			s.notification.NotifyReply(ctx, comment, *parent)
+		}
+	}
+
+	s.notification.NotifyMentions(ctx, comment)
+}
+
+// event builds a domain event for the outbox. It is stored in the same
+// transaction as the change it describes and published by the outbox relay.
+func event(eventType string, commentId uuid.UUID, data interface{}) model.Event {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Errorf("Failed to marshal %s event: %v", eventType, err)
+		payload = []byte("null")
+	}
+
+	return model.Event{
+		Id:        uuid.New(),
+		Type:      eventType,
+		CommentId: commentId,
+		Data:      payload,
+		Created:   time.Now(),
+	}
+}
+
+// highlight escapes a search snippet and turns the match markers into
+// <mark> tags.
+func highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, postgres.SEARCH_MARK_START, "<mark>")
+	return strings.ReplaceAll(snippet, postgres.SEARCH_MARK_STOP, "</mark>")
+}
+
+// render fills ContentHTML from the Markdown source of each comment.
+func render(comments []model.Comment) []model.Comment {
+	for i := range comments {
+		comments[i].ContentHTML = markdown.Render(comments[i].Content)
+	}
+	return comments
+}
+
+// train feeds a moderator decision to the spam classifier. Failing to train
+// must not undo the decision itself, so errors are only logged.
+func (s *forum) train(ctx context.Context, comment *model.Comment, isSpam bool) {
+	log := logger.FromContext(ctx)
+
+	if err := s.spam.Train(ctx, comment.Id, comment.Content, isSpam); err != nil {
+		log.Errorf("Failed to train spam classifier: %v", err)
+	}
 }
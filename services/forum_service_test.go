@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/demkowo/forum/config"
+	model "github.com/demkowo/forum/models"
+	"github.com/demkowo/forum/repositories/postgres"
+	"github.com/google/uuid"
+)
+
+// fakeForumRepo keeps comments in memory. Methods the tests do not use are
+// left to the embedded nil interface and panic.
+type fakeForumRepo struct {
+	postgres.ForumRepo
+
+	comments map[uuid.UUID]*model.Comment
+	likes    map[model.Like]bool
+}
+
+func newFakeForumRepo(comments ...model.Comment) *fakeForumRepo {
+	r := &fakeForumRepo{comments: make(map[uuid.UUID]*model.Comment), likes: make(map[model.Like]bool)}
+	for i := range comments {
+		r.comments[comments[i].Id] = &comments[i]
+	}
+	return r
+}
+
+func (r *fakeForumRepo) GetComment(ctx context.Context, commentId uuid.UUID) (*model.Comment, error) {
+	comment, found := r.comments[commentId]
+	if !found {
+		return nil, nil
+	}
+	copied := *comment
+	return &copied, nil
+}
+
+func (r *fakeForumRepo) DeleteComment(ctx context.Context, commentId uuid.UUID, events ...model.Event) error {
+	if comment, found := r.comments[commentId]; found {
+		comment.Deleted = true
+	}
+	return nil
+}
+
+func (r *fakeForumRepo) AddLike(ctx context.Context, like model.Like, events ...model.Event) (bool, error) {
+	key := model.Like{CommentId: like.CommentId, UserId: like.UserId}
+	if r.likes[key] {
+		return false, nil
+	}
+	r.likes[key] = true
+	return true, nil
+}
+
+func (r *fakeForumRepo) DeleteDislike(ctx context.Context, dislike model.Dislike, events ...model.Event) error {
+	return errors.New("dislike not found")
+}
+
+// fakeNotification counts the like notifications.
+type fakeNotification struct {
+	Notification
+
+	likes int
+}
+
+func (n *fakeNotification) NotifyLike(ctx context.Context, like model.Like, comment model.Comment) {
+	n.likes++
+}
+
+// fakeSpam records the training decisions.
+type fakeSpam struct {
+	Spam
+
+	trained map[uuid.UUID]bool
+}
+
+func (s *fakeSpam) Train(ctx context.Context, commentId uuid.UUID, content string, isSpam bool) error {
+	if s.trained == nil {
+		s.trained = make(map[uuid.UUID]bool)
+	}
+	s.trained[commentId] = isSpam
+	return nil
+}
+
+func TestDeleteCommentTrainsOnlyModeratorDeletes(t *testing.T) {
+	tests := []struct {
+		name      string
+		moderator string
+		trained   bool
+	}{
+		{"author deletes own comment", "", false},
+		{"moderator deletes own comment", "alice", false},
+		{"moderator deletes another user's comment", "mod", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comment := model.Comment{Id: uuid.New(), Author: "alice", Content: "hello"}
+			spam := &fakeSpam{}
+			s := NewForum(newFakeForumRepo(comment), spam, nil, nil, nil, config.Default)
+
+			if err := s.DeleteComment(context.Background(), comment.Id, tt.moderator); err != nil {
+				t.Fatal(err)
+			}
+
+			isSpam, trained := spam.trained[comment.Id]
+			if trained != tt.trained || (trained && !isSpam) {
+				t.Errorf("trained = %t (spam %t), want trained = %t as spam", trained, isSpam, tt.trained)
+			}
+		})
+	}
+}
+
+func TestApproveCommentRejectsCommentsThatAreNotHeld(t *testing.T) {
+	comment := model.Comment{Id: uuid.New(), Author: "alice", Content: "hello"}
+	spam := &fakeSpam{}
+	s := NewForum(newFakeForumRepo(comment), spam, nil, nil, nil, config.Default)
+
+	err := s.ApproveComment(context.Background(), comment.Id)
+	if err == nil || err.Error() != "comment is not held" {
+		t.Fatalf("ApproveComment = %v, want comment is not held", err)
+	}
+	if len(spam.trained) != 0 {
+		t.Errorf("trained %v, want nothing", spam.trained)
+	}
+}
+
+func TestAddLikeNotifiesOnlyOnce(t *testing.T) {
+	comment := model.Comment{Id: uuid.New(), Author: "alice", Content: "hello"}
+	notification := &fakeNotification{}
+	s := NewForum(newFakeForumRepo(comment), nil, nil, notification, nil, config.Default)
+
+	userId := uuid.New()
+	for i := 0; i < 2; i++ {
+		if err := s.AddLike(context.Background(), model.Like{Id: uuid.New(), CommentId: comment.Id, UserId: userId}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if notification.likes != 1 {
+		t.Errorf("sent %d like notifications, want 1", notification.likes)
+	}
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	model "github.com/demkowo/forum/models"
+	"github.com/demkowo/forum/repositories/postgres"
+	"github.com/demkowo/forum/tracing"
+	logger "github.com/demkowo/forum/utils/logger"
+	log "github.com/sirupsen/logrus"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+// Worker is a background worker whose state readiness reports.
+type Worker interface {
+	Running() bool
+}
+
+type Health interface {
+	AddCheck(name string, check func(ctx context.Context) error)
+	AddOptionalCheck(name string, check func(ctx context.Context) error)
+	AddWorker(name string, worker Worker)
+	Ready(ctx context.Context) model.Readiness
+	Drain()
+}
+
+type namedCheck struct {
+	name     string
+	check    func(ctx context.Context) error
+	optional bool
+}
+
+// health checks whether the service can take traffic: the database answers,
+// the schema created on startup is complete, every registered worker is
+// running and every added check passes. Once Drain is called it reports
+// draining without checking, so the load balancer stops routing to the
+// server before it shuts down.
+type health struct {
+	repo     postgres.HealthRepo
+	mu       sync.Mutex
+	checks   []namedCheck
+	draining atomic.Bool
+}
+
+func NewHealth(repository postgres.HealthRepo) Health {
+	log.Trace()
+
+	s := &health{
+		repo: repository,
+	}
+	s.checks = []namedCheck{
+		{name: "database", check: s.repo.Ping},
+		{name: "schema", check: s.checkSchema},
+	}
+	return s
+}
+
+func (s *health) AddCheck(name string, check func(ctx context.Context) error) {
+	log.Trace()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks = append(s.checks, namedCheck{name: name, check: check})
+}
+
+// AddOptionalCheck adds a check that is reported but does not make the
+// service unready when it fails.
+func (s *health) AddOptionalCheck(name string, check func(ctx context.Context) error) {
+	log.Trace()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks = append(s.checks, namedCheck{name: name, check: check, optional: true})
+}
+
+// AddWorker adds the check worker:<name> that fails unless worker runs.
+func (s *health) AddWorker(name string, worker Worker) {
+	log.Trace()
+
+	s.AddCheck("worker:"+name, checkWorker(worker))
+}
+
+// Ready runs the checks concurrently, each limited to healthCheckTimeout.
+func (s *health) Ready(ctx context.Context) model.Readiness {
+	ctx, span := tracing.Start(ctx, "health.Ready")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	start := time.Now()
+	if s.draining.Load() {
+		return model.Readiness{Status: model.HealthDraining, Checks: []model.HealthCheck{}}
+	}
+
+	s.mu.Lock()
+	checks := slices.Clone(s.checks)
+	s.mu.Unlock()
+
+	readiness := model.Readiness{Status: model.HealthOk, Checks: make([]model.HealthCheck, len(checks))}
+
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c namedCheck) {
+			defer wg.Done()
+			readiness.Checks[i] = runCheck(ctx, c.name, c.check)
+			readiness.Checks[i].Optional = c.optional
+		}(i, c)
+	}
+	wg.Wait()
+
+	for _, check := range readiness.Checks {
+		if check.Status == model.HealthOk {
+			continue
+		}
+		if check.Optional {
+			log.Warnf("optional readiness check %s failed: %s", check.Name, check.Error)
+			continue
+		}
+		readiness.Status = model.HealthFailing
+		log.Warnf("readiness check %s failed: %s", check.Name, check.Error)
+	}
+	readiness.DurationMs = milliseconds(time.Since(start))
+
+	return readiness
+}
+
+// Drain makes every later readiness check fail.
+func (s *health) Drain() {
+	log.Trace()
+
+	if !s.draining.Swap(true) {
+		log.Info("readiness set to draining")
+	}
+}
+
+func (s *health) checkSchema(ctx context.Context) error {
+	missing, err := s.repo.FindMissingSchema(ctx, postgres.SchemaTables, postgres.SchemaColumns)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func checkWorker(worker Worker) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if !worker.Running() {
+			return errors.New("not running")
+		}
+		return nil
+	}
+}
+
+func runCheck(ctx context.Context, name string, check func(ctx context.Context) error) model.HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := model.HealthCheck{Name: name, Status: model.HealthOk, DurationMs: milliseconds(time.Since(start))}
+	if err != nil {
+		result.Status = model.HealthFailing
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
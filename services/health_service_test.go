@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	model "github.com/demkowo/forum/models"
+)
+
+type fakeHealthRepo struct {
+	pingErr error
+}
+
+func (r *fakeHealthRepo) Ping(ctx context.Context) error {
+	return r.pingErr
+}
+
+func (r *fakeHealthRepo) FindMissingSchema(ctx context.Context, tables []string, columns []string) ([]string, error) {
+	return nil, nil
+}
+
+func findCheck(t *testing.T, readiness model.Readiness, name string) model.HealthCheck {
+	t.Helper()
+	for _, check := range readiness.Checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	t.Fatalf("no check %q in %+v", name, readiness.Checks)
+	return model.HealthCheck{}
+}
+
+func TestReadyReportsOptionalChecksWithoutFailing(t *testing.T) {
+	s := NewHealth(&fakeHealthRepo{})
+	s.AddOptionalCheck("replica", func(ctx context.Context) error { return errors.New("replica down") })
+
+	readiness := s.Ready(context.Background())
+
+	if readiness.Status != model.HealthOk {
+		t.Errorf("status %s, want %s with only an optional check failing", readiness.Status, model.HealthOk)
+	}
+	replica := findCheck(t, readiness, "replica")
+	if replica.Status != model.HealthFailing || !replica.Optional || replica.Error != "replica down" {
+		t.Errorf("replica check %+v, want an optional failing check", replica)
+	}
+}
+
+func TestReadyFailsOnRequiredChecks(t *testing.T) {
+	s := NewHealth(&fakeHealthRepo{pingErr: errors.New("primary down")})
+	s.AddOptionalCheck("replica", func(ctx context.Context) error { return nil })
+
+	readiness := s.Ready(context.Background())
+
+	if readiness.Status != model.HealthFailing {
+		t.Errorf("status %s, want %s", readiness.Status, model.HealthFailing)
+	}
+	if database := findCheck(t, readiness, "database"); database.Status != model.HealthFailing || database.Optional {
+		t.Errorf("database check %+v, want a required failing check", database)
+	}
+}
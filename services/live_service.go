@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	model "github.com/demkowo/forum/models"
+	"github.com/demkowo/forum/repositories/postgres"
+	"github.com/demkowo/forum/tracing"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	liveBufferSize     = 256
+	typingInterval     = 3 * time.Second
+	typingSweepEntries = 10000
+)
+
+type Live interface {
+	Subscribe(articleId uuid.UUID) (messages <-chan model.LiveMessage, unsubscribe func())
+	Typing(ctx context.Context, presence model.Presence) error
+
+	Start()
+	Stop()
+	Running() bool
+}
+
+// live pushes new comments, reaction deltas and typing presence to the
+// WebSocket clients of an article. Events come from the in-process bus,
+// presence from the event listener, so clients on every replica get both.
+type live struct {
+	repo        postgres.PresenceRepo
+	bus         Bus
+	listener    postgres.EventListener
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[chan model.LiveMessage]struct{}
+	typingMu    sync.Mutex
+	typing      map[string]time.Time
+	unsubscribe func()
+	stop        chan struct{}
+	done        chan struct{}
+	once        sync.Once
+	started     atomic.Bool
+}
+
+func NewLive(repository postgres.PresenceRepo, bus Bus, listener postgres.EventListener) Live {
+	log.Trace()
+
+	return &live{
+		repo:        repository,
+		bus:         bus,
+		listener:    listener,
+		subscribers: make(map[uuid.UUID]map[chan model.LiveMessage]struct{}),
+		typing:      make(map[string]time.Time),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Subscribe returns the messages of every thread of the article. Typing
+// presence is dropped for a subscriber whose buffer is full, any other
+// message closes its channel: the client must reconnect and reload.
+func (s *live) Subscribe(articleId uuid.UUID) (<-chan model.LiveMessage, func()) {
+	log.Trace()
+
+	messages := make(chan model.LiveMessage, liveBufferSize)
+
+	s.mu.Lock()
+	if s.subscribers[articleId] == nil {
+		s.subscribers[articleId] = make(map[chan model.LiveMessage]struct{})
+	}
+	s.subscribers[articleId][messages] = struct{}{}
+	s.mu.Unlock()
+
+	return messages, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.remove(articleId, messages)
+	}
+}
+
+// Typing announces the presence at most once per typingInterval for a user
+// and thread.
+func (s *live) Typing(ctx context.Context, presence model.Presence) error {
+	ctx, span := tracing.Start(ctx, "live.Typing")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	key := presence.UserId.String() + presence.ThreadId.String()
+	now := time.Now()
+
+	s.typingMu.Lock()
+	if now.Sub(s.typing[key]) < typingInterval {
+		s.typingMu.Unlock()
+		return nil
+	}
+	s.typing[key] = now
+	if len(s.typing) > typingSweepEntries {
+		for k, t := range s.typing {
+			if now.Sub(t) >= typingInterval {
+				delete(s.typing, k)
+			}
+		}
+	}
+	s.typingMu.Unlock()
+
+	nickname, err := s.repo.FindNickname(ctx, presence.UserId)
+	if err != nil {
+		return err
+	}
+	presence.Nickname = nickname
+
+	return s.repo.NotifyPresence(ctx, presence)
+}
+
+// Start forwards events and presence to the subscribers until Stop is
+// called.
+func (s *live) Start() {
+	log.Trace()
+
+	s.started.Store(true)
+
+	s.unsubscribe = s.bus.Subscribe(s.broadcastEvent)
+
+	go func() {
+		defer close(s.done)
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case presence, ok := <-s.listener.Presence():
+				if !ok {
+					return
+				}
+				s.broadcast(presence.ArticleId, model.LiveMessage{Type: model.LiveTyping, ThreadId: presence.ThreadId, Data: presence}, false)
+			}
+		}
+	}()
+}
+
+// Stop closes every subscription.
+func (s *live) Stop() {
+	log.Trace()
+
+	s.once.Do(func() {
+		close(s.stop)
+		<-s.done
+
+		if s.unsubscribe != nil {
+			s.unsubscribe()
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for articleId, subscribers := range s.subscribers {
+			for messages := range subscribers {
+				s.remove(articleId, messages)
+			}
+		}
+	})
+}
+
+// Running reports whether the worker was started and has not stopped.
+func (s *live) Running() bool {
+	return running(&s.started, s.done)
+}
+
+func (s *live) broadcastEvent(event model.Event) {
+	message := model.LiveMessage{Sequence: event.Sequence, ThreadId: event.ThreadId}
+
+	switch event.Type {
+	case model.EventCommentCreated, model.EventCommentApproved:
+		message.Type = model.LiveComment
+		message.Data = event.Data
+	case model.EventCommentDeleted:
+		message.Type = model.LiveCommentDeleted
+		message.Data = event.Data
+	case model.EventLikeAdded, model.EventLikeRemoved, model.EventDislikeAdded, model.EventDislikeRemoved:
+		message.Type = model.LiveReaction
+		message.Data = reactionDelta(event)
+	default:
+		return
+	}
+
+	s.broadcast(event.ArticleId, message, true)
+}
+
+func (s *live) broadcast(articleId uuid.UUID, message model.LiveMessage, required bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for messages := range s.subscribers[articleId] {
+		select {
+		case messages <- message:
+		default:
+			if required {
+				log.Warnf("dropping slow live subscriber of article %s", articleId)
+				s.remove(articleId, messages)
+			}
+		}
+	}
+}
+
+// remove closes a subscription, s.mu must be held.
+func (s *live) remove(articleId uuid.UUID, messages chan model.LiveMessage) {
+	subscribers, ok := s.subscribers[articleId]
+	if !ok {
+		return
+	}
+	if _, ok := subscribers[messages]; !ok {
+		return
+	}
+
+	delete(subscribers, messages)
+	close(messages)
+	if len(subscribers) == 0 {
+		delete(s.subscribers, articleId)
+	}
+}
+
+func reactionDelta(event model.Event) model.ReactionDelta {
+	delta := model.ReactionDelta{CommentId: event.CommentId, Kind: "like", Delta: 1}
+
+	switch event.Type {
+	case model.EventLikeRemoved:
+		delta.Delta = -1
+	case model.EventDislikeAdded:
+		delta.Kind = "dislike"
+	case model.EventDislikeRemoved:
+		delta.Kind, delta.Delta = "dislike", -1
+	}
+
+	return delta
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	model "github.com/demkowo/forum/models"
+	"github.com/demkowo/forum/repositories/postgres"
+	"github.com/demkowo/forum/tracing"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrUnknownNotificationKind = errors.New("unknown notification kind")
+
+	notificationKinds = []string{model.NotificationReply, model.NotificationMention, model.NotificationLike}
+)
+
+type Notification interface {
+	CreateTableNotifications() string
+	CreateTableNotificationPreferences() string
+
+	NotifyReply(ctx context.Context, reply model.Comment, parent model.Comment)
+	NotifyMentions(ctx context.Context, comment model.Comment)
+	NotifyLike(ctx context.Context, like model.Like, comment model.Comment)
+
+	FindUnread(ctx context.Context, nickname string) ([]model.Notification, error)
+	MarkRead(ctx context.Context, nickname string, id uuid.UUID) error
+	MarkAllRead(ctx context.Context, nickname string) (int64, error)
+
+	GetPreferences(ctx context.Context, nickname string) (*model.NotificationPreferences, error)
+	SetPreferences(ctx context.Context, preferences model.NotificationPreferences) error
+}
+
+type notification struct {
+	repo postgres.NotificationRepo
+}
+
+func NewNotification(repository postgres.NotificationRepo) Notification {
+	log.Trace()
+
+	return &notification{
+		repo: repository,
+	}
+}
+
+func (s *notification) CreateTableNotifications() string {
+	log.Trace()
+
+	return s.repo.CreateTableNotifications()
+}
+
+func (s *notification) CreateTableNotificationPreferences() string {
+	log.Trace()
+
+	return s.repo.CreateTableNotificationPreferences()
+}
+
+// NotifyReply tells the parent's author about a reply. Replies to the same
+// comment are aggregated until the notification is read.
+func (s *notification) NotifyReply(ctx context.Context, reply model.Comment, parent model.Comment) {
+	ctx, span := tracing.Start(ctx, "notification.NotifyReply")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	s.notify(ctx, parent.Author, reply.Author, model.NotificationReply, parent.Id, parent.ThreadId)
+}
+
+func (s *notification) NotifyMentions(ctx context.Context, comment model.Comment) {
+	ctx, span := tracing.Start(ctx, "notification.NotifyMentions")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	for _, nickname := range comment.Mentions {
+		s.notify(ctx, nickname, comment.Author, model.NotificationMention, comment.Id, comment.ThreadId)
+	}
+}
+
+func (s *notification) NotifyLike(ctx context.Context, like model.Like, comment model.Comment) {
+	ctx, span := tracing.Start(ctx, "notification.NotifyLike")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	actor, err := s.repo.FindNickname(ctx, like.UserId)
+	if err != nil {
+		log.Errorf("Failed to find nickname of user %s: %v", like.UserId, err)
+		return
+	}
+
+	s.notify(ctx, comment.Author, actor, model.NotificationLike, comment.Id, comment.ThreadId)
+}
+
+func (s *notification) FindUnread(ctx context.Context, nickname string) ([]model.Notification, error) {
+	ctx, span := tracing.Start(ctx, "notification.FindUnread")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	notifications, err := s.repo.FindUnreadNotifications(ctx, nickname)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range notifications {
+		notifications[i].Message = message(notifications[i])
+	}
+
+	return notifications, nil
+}
+
+func (s *notification) MarkRead(ctx context.Context, nickname string, id uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "notification.MarkRead")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+	return s.repo.MarkNotificationRead(ctx, nickname, id)
+}
+
+func (s *notification) MarkAllRead(ctx context.Context, nickname string) (int64, error) {
+	ctx, span := tracing.Start(ctx, "notification.MarkAllRead")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+	return s.repo.MarkAllNotificationsRead(ctx, nickname)
+}
+
+func (s *notification) GetPreferences(ctx context.Context, nickname string) (*model.NotificationPreferences, error) {
+	ctx, span := tracing.Start(ctx, "notification.GetPreferences")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+	return s.repo.GetNotificationPreferences(ctx, nickname)
+}
+
+func (s *notification) SetPreferences(ctx context.Context, preferences model.NotificationPreferences) error {
+	ctx, span := tracing.Start(ctx, "notification.SetPreferences")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	for _, kind := range preferences.MutedKinds {
+		if !slices.Contains(notificationKinds, kind) {
+			return fmt.Errorf("%w: %s", ErrUnknownNotificationKind, kind)
+		}
+	}
+
+	if preferences.MutedKinds == nil {
+		preferences.MutedKinds = []string{}
+	}
+
+	return s.repo.SetNotificationPreferences(ctx, preferences)
+}
+
+// notify stores a notification unless the recipient is the actor or muted
+// the kind or thread. Notifications are a side effect of the action that
+// caused them, so failures are only logged.
+func (s *notification) notify(ctx context.Context, recipient, actor, kind string, commentId, threadId uuid.UUID) {
+	log := logger.FromContext(ctx)
+
+	if recipient == "" || recipient == actor {
+		return
+	}
+
+	preferences, err := s.repo.GetNotificationPreferences(ctx, recipient)
+	if err != nil {
+		log.Errorf("Failed to get notification preferences of %s: %v", recipient, err)
+		return
+	}
+	if slices.Contains(preferences.MutedKinds, kind) || slices.Contains(preferences.MutedThreads, threadId) {
+		return
+	}
+
+	err = s.repo.AddNotification(ctx, model.Notification{
+		Id:        uuid.New(),
+		Recipient: recipient,
+		Kind:      kind,
+		CommentId: commentId,
+		ThreadId:  threadId,
+		Actors:    []string{actor},
+		Created:   time.Now(),
+	})
+	if err != nil {
+		log.Errorf("Failed to add %s notification for %s: %v", kind, recipient, err)
+	}
+}
+
+// message describes an aggregated notification, e.g. "alice and 4 others
+// liked your comment".
+func message(n model.Notification) string {
+	var who string
+	switch {
+	case n.Count <= 1 && len(n.Actors) > 0:
+		who = n.Actors[0]
+	case len(n.Actors) == 0:
+		who = fmt.Sprintf("%d people", n.Count)
+	case n.Count == 2 && len(n.Actors) == 2:
+		who = strings.Join(n.Actors, " and ")
+	default:
+		who = fmt.Sprintf("%s and %d others", n.Actors[0], n.Count-1)
+	}
+
+	switch n.Kind {
+	case model.NotificationReply:
+		return who + " replied to your comment"
+	case model.NotificationMention:
+		return who + " mentioned you"
+	case model.NotificationLike:
+		return who + " liked your comment"
+	default:
+		return who + " " + n.Kind
+	}
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/demkowo/forum/config"
+	model "github.com/demkowo/forum/models"
+	"github.com/demkowo/forum/repositories/postgres"
+	logger "github.com/demkowo/forum/utils/logger"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	outboxBatchSize       = 100
+	outboxCleanupInterval = time.Hour
+)
+
+type Outbox interface {
+	CreateTableOutbox() string
+
+	Start()
+	Stop()
+	Running() bool
+}
+
+// outbox relays the events stored by the repositories to the publisher in
+// outbox order. An event is marked published only after the publisher
+// accepted it, so a crash in between publishes it again.
+type outbox struct {
+	repo      postgres.OutboxRepo
+	publisher EventPublisher
+	config    config.Getter
+	stop      chan struct{}
+	done      chan struct{}
+	once      sync.Once
+	started   atomic.Bool
+	cleaned   time.Time
+}
+
+func NewOutbox(repository postgres.OutboxRepo, publisher EventPublisher, cfg config.Getter) Outbox {
+	log.Trace()
+
+	return &outbox{
+		repo:      repository,
+		publisher: publisher,
+		config:    cfg,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+func (s *outbox) CreateTableOutbox() string {
+	log.Trace()
+
+	return s.repo.CreateTableOutbox()
+}
+
+// Start runs the relay until Stop is called.
+func (s *outbox) Start() {
+	log.Trace()
+
+	s.started.Store(true)
+
+	go func() {
+		defer close(s.done)
+
+		ctx := workerContext("outbox")
+		interval := s.config().Outbox.PollInterval
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			s.relay(ctx)
+
+			// A reloaded poll_interval applies from the next wait.
+			if next := s.config().Outbox.PollInterval; next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop finishes the batch in flight and stops the relay.
+func (s *outbox) Stop() {
+	log.Trace()
+
+	s.once.Do(func() {
+		close(s.stop)
+		<-s.done
+	})
+}
+
+// Running reports whether the worker was started and has not stopped.
+func (s *outbox) Running() bool {
+	return running(&s.started, s.done)
+}
+
+// relay publishes pending events until the outbox is drained or publishing
+// fails, then removes published events older than Outbox.Retention.
+func (s *outbox) relay(ctx context.Context) {
+	log := logger.FromContext(ctx)
+
+	maxAttempts := s.config().Outbox.MaxAttempts
+	for {
+		published, err := s.repo.PublishOutbox(ctx, outboxBatchSize, maxAttempts, func(event model.Event) error {
+			return s.publisher.Publish(ctx, event)
+		})
+		if err != nil {
+			log.Errorf("Failed to relay outbox events: %v", err)
+			return
+		}
+		if published < outboxBatchSize {
+			break
+		}
+
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+	}
+
+	if time.Since(s.cleaned) < outboxCleanupInterval {
+		return
+	}
+	s.cleaned = time.Now()
+
+	deleted, err := s.repo.DeletePublishedOutbox(ctx, time.Now().Add(-s.config().Outbox.Retention))
+	if err != nil {
+		log.Errorf("Failed to clean up outbox: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Infof("Removed %d published outbox events", deleted)
+	}
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	model "github.com/demkowo/forum/models"
+	"github.com/demkowo/forum/repositories/postgres"
+	"github.com/demkowo/forum/tracing"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+type Privacy interface {
+	CreateTableErasures() string
+
+	ExportUser(ctx context.Context, nickname string) (*model.UserExport, error)
+	WriteArchive(w io.Writer, export *model.UserExport) error
+	EraseUser(ctx context.Context, nickname string, requestedBy uuid.UUID) (*model.Erasure, error)
+	FindErasures(ctx context.Context) ([]model.Erasure, error)
+}
+
+// privacy answers data subject requests: it exports the forum data tied to
+// a user and erases it.
+type privacy struct {
+	repo postgres.PrivacyRepo
+}
+
+func NewPrivacy(repository postgres.PrivacyRepo) Privacy {
+	log.Trace()
+
+	return &privacy{
+		repo: repository,
+	}
+}
+
+func (s *privacy) CreateTableErasures() string {
+	log.Trace()
+
+	return s.repo.CreateTableErasures()
+}
+
+func (s *privacy) ExportUser(ctx context.Context, nickname string) (*model.UserExport, error) {
+	ctx, span := tracing.Start(ctx, "privacy.ExportUser")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	export, err := s.repo.ExportUser(ctx, nickname)
+	if err != nil {
+		return nil, err
+	}
+	export.Exported = time.Now()
+
+	return export, nil
+}
+
+// WriteArchive writes the export as a ZIP archive with one JSON file per
+// kind of data.
+func (s *privacy) WriteArchive(w io.Writer, export *model.UserExport) error {
+	log.Trace()
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"user.json", map[string]interface{}{"user_id": export.UserId, "nickname": export.Nickname, "exported": export.Exported}},
+		{"comments.json", export.Comments},
+		{"likes.json", export.Likes},
+		{"dislikes.json", export.Dislikes},
+		{"complaints.json", export.Complaints},
+	}
+
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		f, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: export.Exported})
+		if err != nil {
+			return err
+		}
+
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// EraseUser anonymizes the user's comments and deletes the rest of their
+// data in one transaction. Removed reactions and complaints are published
+// like any other removal, so counters and subscribers follow.
+func (s *privacy) EraseUser(ctx context.Context, nickname string, requestedBy uuid.UUID) (*model.Erasure, error) {
+	ctx, span := tracing.Start(ctx, "privacy.EraseUser")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	export, err := s.ExportUser(ctx, nickname)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []model.Event
+	for _, like := range export.Likes {
+		events = append(events, event(model.EventLikeRemoved, like.CommentId, like))
+	}
+	for _, dislike := range export.Dislikes {
+		events = append(events, event(model.EventDislikeRemoved, dislike.CommentId, dislike))
+	}
+	for _, complaint := range export.Complaints {
+		events = append(events, event(model.EventComplaintDeleted, complaint.CommentId, complaint))
+	}
+
+	erasure := &model.Erasure{
+		Id:          uuid.New(),
+		UserId:      export.UserId,
+		RequestedBy: requestedBy,
+		Created:     time.Now(),
+	}
+	if err := s.repo.EraseUser(ctx, erasure, nickname, events...); err != nil {
+		return nil, err
+	}
+
+	log.Infof("erased user %s: %d comments anonymized, %d likes, %d dislikes, %d complaints deleted",
+		erasure.UserId, erasure.Comments, erasure.Likes, erasure.Dislikes, erasure.Complaints)
+
+	return erasure, nil
+}
+
+func (s *privacy) FindErasures(ctx context.Context) ([]model.Erasure, error) {
+	ctx, span := tracing.Start(ctx, "privacy.FindErasures")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+	return s.repo.FindErasures(ctx)
+}
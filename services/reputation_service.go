@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/demkowo/forum/config"
+	model "github.com/demkowo/forum/models"
+	"github.com/demkowo/forum/repositories/postgres"
+	"github.com/demkowo/forum/tracing"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	reputationAgeCap     = 365 * 24 * time.Hour
+	reputationAgeDivisor = 30 * 24 * time.Hour
+	reputationPruneEvery = time.Hour
+)
+
+type Reputation interface {
+	CreateTableReputation() string
+	CreateTableReputationEvents() string
+
+	GetReputation(ctx context.Context, nickname string) (*model.Reputation, error)
+	GetReputationByUserId(ctx context.Context, userId uuid.UUID) (*model.Reputation, error)
+	RebuildReputation(ctx context.Context) error
+
+	IsNewUser(reputation model.Reputation) bool
+	ComplaintWeight(reputation model.Reputation) float64
+
+	Publish(ctx context.Context, event model.Event) error
+}
+
+// reputation keeps per-user counters of the reactions received and the
+// complaints upheld against the user's comments, updated from the outbox
+// events. The score is computed when read:
+//
+//	likes - dislikes - Reputation.ComplaintPenalty * upheld + min(age, 1 year) / 30 days
+//
+// where age is the time since the user's first comment.
+type reputation struct {
+	repo      postgres.ReputationRepo
+	config    config.Getter
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+func NewReputation(repository postgres.ReputationRepo, cfg config.Getter) Reputation {
+	log.Trace()
+
+	return &reputation{
+		repo:   repository,
+		config: cfg,
+	}
+}
+
+func (s *reputation) CreateTableReputation() string {
+	log.Trace()
+
+	return s.repo.CreateTableReputation()
+}
+
+func (s *reputation) CreateTableReputationEvents() string {
+	log.Trace()
+
+	return s.repo.CreateTableReputationEvents()
+}
+
+func (s *reputation) GetReputation(ctx context.Context, nickname string) (*model.Reputation, error) {
+	ctx, span := tracing.Start(ctx, "reputation.GetReputation")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	reputation, err := s.repo.GetReputation(ctx, nickname)
+	if err != nil {
+		return nil, err
+	}
+
+	s.score(reputation)
+	return reputation, nil
+}
+
+func (s *reputation) GetReputationByUserId(ctx context.Context, userId uuid.UUID) (*model.Reputation, error) {
+	ctx, span := tracing.Start(ctx, "reputation.GetReputationByUserId")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	reputation, err := s.repo.GetReputationByUserId(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	s.score(reputation)
+	return reputation, nil
+}
+
+func (s *reputation) RebuildReputation(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "reputation.RebuildReputation")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+	return s.repo.RebuildReputation(ctx)
+}
+
+// IsNewUser reports whether the user commented for the first time less than
+// Reputation.NewUser ago, or never did, with a score at or below
+// Reputation.HoldBelow. Their comments are held for review.
+func (s *reputation) IsNewUser(reputation model.Reputation) bool {
+	log.Trace()
+
+	cfg := s.config()
+
+	if reputation.FirstSeen != nil && time.Since(*reputation.FirstSeen) >= cfg.Reputation.NewUser {
+		return false
+	}
+	return reputation.Score <= cfg.Reputation.HoldBelow
+}
+
+// ComplaintWeight is Reputation.TrustedWeight for complaints filed by
+// trusted users and 1 for everyone else.
+func (s *reputation) ComplaintWeight(reputation model.Reputation) float64 {
+	log.Trace()
+
+	if reputation.Trusted {
+		return s.config().Reputation.TrustedWeight
+	}
+	return 1
+}
+
+// Publish applies a reaction, upheld complaint or new comment to the
+// reputation of the comment's author. Reactions of authors to their own
+// comments and dismissals of complaints that were never upheld change
+// nothing. Each event is applied once.
+func (s *reputation) Publish(ctx context.Context, event model.Event) error {
+	ctx, span := tracing.Start(ctx, "reputation.Publish")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	var likes, dislikes, upheld int
+	var seen time.Time
+	var data struct {
+		UserId         uuid.UUID `json:"user_id"`
+		PreviousStatus string    `json:"previous_status"`
+	}
+
+	switch event.Type {
+	case model.EventCommentCreated, model.EventCommentApproved:
+		seen = event.Created
+	case model.EventLikeAdded:
+		likes = 1
+	case model.EventLikeRemoved:
+		likes = -1
+	case model.EventDislikeAdded:
+		dislikes = 1
+	case model.EventDislikeRemoved:
+		dislikes = -1
+	case model.EventComplaintUpheld:
+		upheld = 1
+	case model.EventComplaintDismissed:
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return err
+		}
+		if data.PreviousStatus != model.ComplaintUpheld {
+			return nil
+		}
+		upheld = -1
+	default:
+		return nil
+	}
+
+	var actor uuid.UUID
+	if likes != 0 || dislikes != 0 {
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			return err
+		}
+		actor = data.UserId
+	}
+
+	if err := s.repo.ApplyReputationEvent(ctx, event.Id, event.CommentId, actor, likes, dislikes, upheld, seen); err != nil {
+		return err
+	}
+
+	s.prune(ctx)
+	return nil
+}
+
+// prune forgets applied events older than Outbox.Retention, at most once per
+// reputationPruneEvery. The outbox does not redeliver them after that.
+func (s *reputation) prune(ctx context.Context) {
+	log := logger.FromContext(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.lastPrune) < reputationPruneEvery {
+		return
+	}
+	s.lastPrune = time.Now()
+
+	deleted, err := s.repo.DeleteReputationEvents(ctx, time.Now().Add(-s.config().Outbox.Retention))
+	if err != nil {
+		log.Errorf("Failed to delete applied reputation events: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Infof("deleted %d applied reputation events", deleted)
+	}
+}
+
+func (s *reputation) score(reputation *model.Reputation) {
+	cfg := s.config()
+
+	var age time.Duration
+	if reputation.FirstSeen != nil {
+		age = min(time.Since(*reputation.FirstSeen), reputationAgeCap)
+	}
+
+	score := float64(reputation.LikesReceived-reputation.DislikesReceived) -
+		cfg.Reputation.ComplaintPenalty*float64(reputation.ComplaintsUpheld) +
+		float64(age)/float64(reputationAgeDivisor)
+
+	reputation.Score = math.Round(score*100) / 100
+	reputation.Trusted = reputation.Score >= cfg.Reputation.Trusted
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/demkowo/forum/config"
+	model "github.com/demkowo/forum/models"
+	"github.com/demkowo/forum/repositories/postgres"
+	"github.com/google/uuid"
+)
+
+type appliedReputation struct {
+	actor                   uuid.UUID
+	likes, dislikes, upheld int
+}
+
+// fakeReputationRepo records the applied events. Methods the tests do not
+// use are left to the embedded nil interface and panic.
+type fakeReputationRepo struct {
+	postgres.ReputationRepo
+
+	applied []appliedReputation
+}
+
+func (r *fakeReputationRepo) ApplyReputationEvent(ctx context.Context, eventId, commentId, actor uuid.UUID, likes, dislikes, upheld int, seen time.Time) error {
+	r.applied = append(r.applied, appliedReputation{actor: actor, likes: likes, dislikes: dislikes, upheld: upheld})
+	return nil
+}
+
+func (r *fakeReputationRepo) DeleteReputationEvents(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestIsNewUserHoldsNewUsersWithDefaults(t *testing.T) {
+	s := NewReputation(&fakeReputationRepo{}, config.Default)
+
+	recently := time.Now().Add(-time.Hour)
+	longAgo := time.Now().Add(-30 * 24 * time.Hour)
+
+	tests := []struct {
+		name       string
+		reputation model.Reputation
+		want       bool
+	}{
+		{"never commented", model.Reputation{}, true},
+		{"first comment an hour ago", model.Reputation{FirstSeen: &recently}, true},
+		{"new user with negative score", model.Reputation{FirstSeen: &recently, Score: -3}, true},
+		{"new user with likes", model.Reputation{FirstSeen: &recently, Score: 2}, false},
+		{"established user", model.Reputation{FirstSeen: &longAgo}, false},
+		{"established user with negative score", model.Reputation{FirstSeen: &longAgo, Score: -5}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.IsNewUser(tt.reputation); got != tt.want {
+				t.Errorf("IsNewUser(%+v) = %t, want %t", tt.reputation, got, tt.want)
+			}
+		})
+	}
+}
+
+func reputationEvent(t *testing.T, eventType string, data any) model.Event {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model.Event{Id: uuid.New(), Type: eventType, CommentId: uuid.New(), Data: payload, Created: time.Now()}
+}
+
+func TestReputationPublish(t *testing.T) {
+	liker := uuid.New()
+	complaint := model.Complaint{Id: uuid.New(), UserId: uuid.New(), Status: model.ComplaintDismissed}
+
+	tests := []struct {
+		name  string
+		event model.Event
+		want  []appliedReputation
+	}{
+		{
+			name:  "like passes the liker",
+			event: reputationEvent(t, model.EventLikeAdded, model.Like{Id: uuid.New(), UserId: liker}),
+			want:  []appliedReputation{{actor: liker, likes: 1}},
+		},
+		{
+			name:  "dislike removal passes the user",
+			event: reputationEvent(t, model.EventDislikeRemoved, model.Dislike{Id: uuid.New(), UserId: liker}),
+			want:  []appliedReputation{{actor: liker, dislikes: -1}},
+		},
+		{
+			name:  "upheld complaint",
+			event: reputationEvent(t, model.EventComplaintUpheld, complaint),
+			want:  []appliedReputation{{upheld: 1}},
+		},
+		{
+			name: "dismissing an upheld complaint takes back the penalty",
+			event: reputationEvent(t, model.EventComplaintDismissed, map[string]any{
+				"id": complaint.Id, "user_id": complaint.UserId, "status": model.ComplaintDismissed, "previous_status": model.ComplaintUpheld,
+			}),
+			want: []appliedReputation{{upheld: -1}},
+		},
+		{
+			name: "dismissing an open complaint",
+			event: reputationEvent(t, model.EventComplaintDismissed, map[string]any{
+				"id": complaint.Id, "user_id": complaint.UserId, "status": model.ComplaintDismissed, "previous_status": model.ComplaintOpen,
+			}),
+		},
+		{
+			name:  "unrelated event",
+			event: reputationEvent(t, model.EventComplaintCreated, complaint),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeReputationRepo{}
+			s := NewReputation(repo, config.Default)
+
+			if err := s.Publish(context.Background(), tt.event); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(repo.applied) != len(tt.want) {
+				t.Fatalf("applied %+v, want %+v", repo.applied, tt.want)
+			}
+			for i := range tt.want {
+				if repo.applied[i] != tt.want[i] {
+					t.Errorf("applied %+v, want %+v", repo.applied[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package service
+
+import (
+	"context"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/demkowo/forum/config"
+	model "github.com/demkowo/forum/models"
+	"github.com/demkowo/forum/repositories/postgres"
+	"github.com/demkowo/forum/tracing"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	spamTokenMinLen = 2
+	spamTokenMaxLen = 64
+)
+
+type Spam interface {
+	CreateTableSpamSamples() string
+	CreateTableSpamTokens() string
+	CreateTableSpamStats() string
+
+	Load(ctx context.Context) error
+	Score(content string) float64
+	Train(ctx context.Context, commentId uuid.UUID, content string, spam bool) error
+	Retrain(ctx context.Context) (*model.SpamModel, error)
+	Stats() model.SpamModel
+}
+
+// spam is a naive Bayes classifier kept in memory and mirrored in Postgres.
+// Every moderator decision is applied incrementally, Retrain rebuilds the
+// model from all stored decisions.
+type spam struct {
+	repo   postgres.SpamRepo
+	config config.Getter
+	mu     sync.RWMutex
+	model  model.SpamModel
+}
+
+func NewSpam(repository postgres.SpamRepo, cfg config.Getter) Spam {
+	log.Trace()
+
+	return &spam{
+		repo:   repository,
+		config: cfg,
+		model:  model.SpamModel{Tokens: make(map[string]model.SpamToken)},
+	}
+}
+
+func (s *spam) CreateTableSpamSamples() string {
+	log.Trace()
+
+	return s.repo.CreateTableSpamSamples()
+}
+
+func (s *spam) CreateTableSpamTokens() string {
+	log.Trace()
+
+	return s.repo.CreateTableSpamTokens()
+}
+
+func (s *spam) CreateTableSpamStats() string {
+	log.Trace()
+
+	return s.repo.CreateTableSpamStats()
+}
+
+func (s *spam) Load(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "spam.Load")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	spamModel, err := s.repo.GetSpamModel(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.model = *spamModel
+	s.mu.Unlock()
+
+	log.Infof("spam model loaded: %d spam, %d ham, %d tokens", spamModel.SpamDocs, spamModel.HamDocs, len(spamModel.Tokens))
+	return nil
+}
+
+// Score returns the probability that content is spam. It returns 0 until
+// both classes have at least Spam.MinSamples training documents.
+func (s *spam) Score(content string) float64 {
+	log.Trace()
+
+	minSamples := s.config().Spam.MinSamples
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.model.SpamDocs < minSamples || s.model.HamDocs < minSamples {
+		return 0
+	}
+
+	spamDocs := float64(s.model.SpamDocs)
+	hamDocs := float64(s.model.HamDocs)
+
+	logOdds := math.Log(spamDocs / hamDocs)
+	for _, token := range tokenize(content) {
+		t, found := s.model.Tokens[token]
+		if !found {
+			continue
+		}
+		pSpam := (float64(t.Spam) + 1) / (spamDocs + 2)
+		pHam := (float64(t.Ham) + 1) / (hamDocs + 2)
+		logOdds += math.Log(pSpam) - math.Log(pHam)
+	}
+
+	return 1 / (1 + math.Exp(-logOdds))
+}
+
+// Train records a moderator decision. A decision that flips an earlier label
+// for the same comment first removes the old contribution from the model.
+func (s *spam) Train(ctx context.Context, commentId uuid.UUID, content string, isSpam bool) error {
+	ctx, span := tracing.Start(ctx, "spam.Train")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	previous, err := s.repo.AddSpamSample(ctx, model.SpamSample{
+		CommentId: commentId,
+		Spam:      isSpam,
+		Created:   time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if previous != nil && previous.Spam == isSpam {
+		return nil
+	}
+
+	tokens := tokenize(content)
+	delta := model.SpamModel{Tokens: make(map[string]model.SpamToken)}
+	addToModel(&delta, tokens, isSpam, 1)
+	if previous != nil {
+		addToModel(&delta, tokens, previous.Spam, -1)
+	}
+
+	if err := s.repo.UpdateSpamModel(ctx, delta); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.model.SpamDocs += delta.SpamDocs
+	s.model.HamDocs += delta.HamDocs
+	for key, t := range delta.Tokens {
+		current := s.model.Tokens[key]
+		current.Token = key
+		current.Spam = max(current.Spam+t.Spam, 0)
+		current.Ham = max(current.Ham+t.Ham, 0)
+		s.model.Tokens[key] = current
+	}
+
+	return nil
+}
+
+func (s *spam) Retrain(ctx context.Context) (*model.SpamModel, error) {
+	ctx, span := tracing.Start(ctx, "spam.Retrain")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	samples, err := s.repo.FindSpamSamples(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	spamModel := model.SpamModel{Tokens: make(map[string]model.SpamToken)}
+	for _, sample := range samples {
+		addToModel(&spamModel, tokenize(sample.Content), sample.Spam, 1)
+	}
+
+	if err := s.repo.ReplaceSpamModel(ctx, spamModel); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.model = spamModel
+	s.mu.Unlock()
+
+	log.Infof("spam model retrained: %d spam, %d ham, %d tokens", spamModel.SpamDocs, spamModel.HamDocs, len(spamModel.Tokens))
+	return &spamModel, nil
+}
+
+func (s *spam) Stats() model.SpamModel {
+	log.Trace()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return model.SpamModel{
+		SpamDocs: s.model.SpamDocs,
+		HamDocs:  s.model.HamDocs,
+	}
+}
+
+func addToModel(spamModel *model.SpamModel, tokens []string, isSpam bool, n int) {
+	if isSpam {
+		spamModel.SpamDocs += n
+	} else {
+		spamModel.HamDocs += n
+	}
+
+	for _, token := range tokens {
+		t := spamModel.Tokens[token]
+		t.Token = token
+		if isSpam {
+			t.Spam += n
+		} else {
+			t.Ham += n
+		}
+		spamModel.Tokens[token] = t
+	}
+}
+
+// containsWord reports whether content has one of words as a whole word,
+// ignoring case.
+func containsWord(content string, words []string) bool {
+	if len(words) == 0 {
+		return false
+	}
+
+	for _, word := range strings.FieldsFunc(content, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if slices.ContainsFunc(words, func(listed string) bool { return strings.EqualFold(listed, word) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenize returns the distinct lower-cased words of content.
+func tokenize(content string) []string {
+	words := strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	seen := make(map[string]struct{}, len(words))
+	tokens := make([]string, 0, len(words))
+	for _, word := range words {
+		length := utf8.RuneCountInString(word)
+		if length < spamTokenMinLen || length > spamTokenMaxLen {
+			continue
+		}
+		if _, found := seen[word]; found {
+			continue
+		}
+		seen[word] = struct{}{}
+		tokens = append(tokens, word)
+	}
+
+	return tokens
+}
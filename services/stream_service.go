@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	model "github.com/demkowo/forum/models"
+	"github.com/demkowo/forum/repositories/postgres"
+	"github.com/demkowo/forum/tracing"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	streamBufferSize  = 64
+	streamReplayLimit = 500
+)
+
+type Stream interface {
+	Subscribe(articleId uuid.UUID) (messages <-chan model.StreamMessage, unsubscribe func())
+	Replay(ctx context.Context, articleId uuid.UUID, after int64) ([]model.StreamMessage, error)
+
+	Start()
+	Stop()
+	Running() bool
+}
+
+// stream pushes the changes of an article to its readers. Events published
+// by the outbox relay of any replica reach the in-process bus through the
+// event feed, from which they are fanned out to the subscribers of the
+// article.
+type stream struct {
+	outbox      postgres.OutboxRepo
+	forum       postgres.ForumRepo
+	bus         Bus
+	mu          sync.Mutex
+	subscribers map[uuid.UUID]map[chan model.StreamMessage]struct{}
+	unsubscribe func()
+	done        chan struct{}
+	once        sync.Once
+	started     atomic.Bool
+}
+
+func NewStream(outbox postgres.OutboxRepo, forum postgres.ForumRepo, bus Bus) Stream {
+	log.Trace()
+
+	return &stream{
+		outbox:      outbox,
+		forum:       forum,
+		bus:         bus,
+		subscribers: make(map[uuid.UUID]map[chan model.StreamMessage]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Subscribe returns the live messages of the article. A subscriber that
+// falls more than streamBufferSize messages behind has its channel closed
+// and is expected to reconnect and resume with Replay.
+func (s *stream) Subscribe(articleId uuid.UUID) (<-chan model.StreamMessage, func()) {
+	log.Trace()
+
+	messages := make(chan model.StreamMessage, streamBufferSize)
+
+	s.mu.Lock()
+	if s.subscribers[articleId] == nil {
+		s.subscribers[articleId] = make(map[chan model.StreamMessage]struct{})
+	}
+	s.subscribers[articleId][messages] = struct{}{}
+	s.mu.Unlock()
+
+	return messages, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.remove(articleId, messages)
+	}
+}
+
+// Replay returns the messages of the article that follow the after sequence.
+func (s *stream) Replay(ctx context.Context, articleId uuid.UUID, after int64) ([]model.StreamMessage, error) {
+	ctx, span := tracing.Start(ctx, "stream.Replay")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	events, err := s.outbox.FindPublishedEventsByArticle(ctx, articleId, after, streamReplayLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]model.StreamMessage, 0, len(events))
+	for _, event := range events {
+		if message, ok := s.message(ctx, event); ok {
+			messages = append(messages, message)
+		}
+	}
+
+	return messages, nil
+}
+
+// Start feeds the subscribers from the bus until Stop is called.
+func (s *stream) Start() {
+	log.Trace()
+
+	s.started.Store(true)
+
+	s.unsubscribe = s.bus.Subscribe(s.broadcast)
+}
+
+// Stop closes every subscription.
+func (s *stream) Stop() {
+	log.Trace()
+
+	s.once.Do(func() {
+		if s.unsubscribe != nil {
+			s.unsubscribe()
+		}
+		close(s.done)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for articleId, subscribers := range s.subscribers {
+			for messages := range subscribers {
+				s.remove(articleId, messages)
+			}
+		}
+	})
+}
+
+// Running reports whether the worker was started and has not stopped.
+func (s *stream) Running() bool {
+	return running(&s.started, s.done)
+}
+
+func (s *stream) broadcast(event model.Event) {
+	s.mu.Lock()
+	listening := len(s.subscribers[event.ArticleId]) > 0
+	s.mu.Unlock()
+	if !listening {
+		return
+	}
+
+	message, ok := s.message(workerContext("stream"), event)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for messages := range s.subscribers[event.ArticleId] {
+		select {
+		case messages <- message:
+		default:
+			log.Warnf("dropping slow stream subscriber of article %s", event.ArticleId)
+			s.remove(event.ArticleId, messages)
+		}
+	}
+}
+
+// remove closes a subscription, s.mu must be held.
+func (s *stream) remove(articleId uuid.UUID, messages chan model.StreamMessage) {
+	subscribers, ok := s.subscribers[articleId]
+	if !ok {
+		return
+	}
+	if _, ok := subscribers[messages]; !ok {
+		return
+	}
+
+	delete(subscribers, messages)
+	close(messages)
+	if len(subscribers) == 0 {
+		delete(s.subscribers, articleId)
+	}
+}
+
+// message converts an event to what readers see: comments as published,
+// deletions and the current reaction counts. Complaints are not streamed.
+func (s *stream) message(ctx context.Context, event model.Event) (model.StreamMessage, bool) {
+	log := logger.FromContext(ctx)
+
+	message := model.StreamMessage{Id: event.Sequence, Event: event.Type, Data: event.Data}
+
+	switch event.Type {
+	case model.EventCommentCreated, model.EventCommentApproved, model.EventCommentDeleted:
+		return message, true
+
+	case model.EventLikeAdded, model.EventLikeRemoved, model.EventDislikeAdded, model.EventDislikeRemoved:
+		likes, err := s.forum.CountLikes(ctx, event.CommentId)
+		if err != nil {
+			log.Errorf("Failed to count likes: %v", err)
+			return message, false
+		}
+		dislikes, err := s.forum.CountDislikes(ctx, event.CommentId)
+		if err != nil {
+			log.Errorf("Failed to count dislikes: %v", err)
+			return message, false
+		}
+
+		message.Event = "reactions"
+		message.Data = model.Reactions{CommentId: event.CommentId, Likes: likes, Dislikes: dislikes}
+		return message, true
+	}
+
+	return message, false
+}
@@ -0,0 +1,432 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/demkowo/forum/config"
+	model "github.com/demkowo/forum/models"
+	"github.com/demkowo/forum/repositories/postgres"
+	"github.com/demkowo/forum/tracing"
+	logger "github.com/demkowo/forum/utils/logger"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	webhookBatchSize  = 20
+	webhookMaxBackoff = time.Hour
+)
+
+var (
+	ErrInvalidWebhook = errors.New("invalid webhook")
+
+	// sharedAddressSpace is the carrier-grade NAT range of RFC 6598, internal
+	// like the private ranges.
+	sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+)
+
+type Webhook interface {
+	CreateTableWebhooks() string
+	CreateTableWebhookDeliveries() string
+	CreateTableWebhookDeadLetters() string
+
+	AddWebhook(ctx context.Context, webhook *model.Webhook) error
+	DeleteWebhook(ctx context.Context, id uuid.UUID) error
+	FindWebhooks(ctx context.Context) ([]model.Webhook, error)
+	FindDeliveries(ctx context.Context, webhookId uuid.UUID) ([]model.WebhookDelivery, error)
+	FindDeadLetters(ctx context.Context) ([]model.WebhookDelivery, error)
+	ReplayDelivery(ctx context.Context, id uuid.UUID) (uuid.UUID, error)
+
+	Publish(ctx context.Context, event model.Event) error
+	Start()
+	Stop()
+	Running() bool
+}
+
+// webhook queues a delivery per matching subscription for every event and
+// sends them from a background worker, retrying with exponential backoff
+// until Webhook.MaxAttempts, after which deliveries go to the dead letters.
+type webhook struct {
+	repo    postgres.WebhookRepo
+	client  *http.Client
+	config  config.Getter
+	wake    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	started atomic.Bool
+}
+
+// NewWebhook returns the webhook service. Without client deliveries use
+// one that refuses to connect to internal addresses.
+func NewWebhook(repository postgres.WebhookRepo, client *http.Client, cfg config.Getter) Webhook {
+	log.Trace()
+
+	if client == nil {
+		client = newWebhookClient()
+	}
+
+	return &webhook{
+		repo:   repository,
+		client: client,
+		config: cfg,
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+func (s *webhook) CreateTableWebhooks() string {
+	log.Trace()
+
+	return s.repo.CreateTableWebhooks()
+}
+
+func (s *webhook) CreateTableWebhookDeliveries() string {
+	log.Trace()
+
+	return s.repo.CreateTableWebhookDeliveries()
+}
+
+func (s *webhook) CreateTableWebhookDeadLetters() string {
+	log.Trace()
+
+	return s.repo.CreateTableWebhookDeadLetters()
+}
+
+// AddWebhook validates the subscription and stores it. URLs whose host is
+// or resolves to an internal address are rejected, so webhooks cannot be
+// used to reach the network of the server. A random secret is generated
+// when none is given; it is only ever returned here.
+func (s *webhook) AddWebhook(ctx context.Context, w *model.Webhook) error {
+	ctx, span := tracing.Start(ctx, "webhook.AddWebhook")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url must be an absolute http(s) URL", ErrInvalidWebhook)
+	}
+	if err := checkWebhookHost(ctx, u.Hostname()); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+
+	if len(w.Events) == 0 {
+		return fmt.Errorf("%w: events must not be empty", ErrInvalidWebhook)
+	}
+	for _, event := range w.Events {
+		if event != "*" && !slices.Contains(model.EventTypes, event) {
+			return fmt.Errorf("%w: unknown event %s", ErrInvalidWebhook, event)
+		}
+	}
+
+	if w.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		w.Secret = hex.EncodeToString(secret)
+	}
+
+	w.Id = uuid.New()
+	w.Created = time.Now()
+
+	return s.repo.AddWebhook(ctx, *w)
+}
+
+func (s *webhook) DeleteWebhook(ctx context.Context, id uuid.UUID) error {
+	ctx, span := tracing.Start(ctx, "webhook.DeleteWebhook")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+	return s.repo.DeleteWebhook(ctx, id)
+}
+
+func (s *webhook) FindWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	ctx, span := tracing.Start(ctx, "webhook.FindWebhooks")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+	return s.repo.FindWebhooks(ctx)
+}
+
+func (s *webhook) FindDeliveries(ctx context.Context, webhookId uuid.UUID) ([]model.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, "webhook.FindDeliveries")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+	return s.repo.FindDeliveries(ctx, webhookId)
+}
+
+func (s *webhook) FindDeadLetters(ctx context.Context) ([]model.WebhookDelivery, error) {
+	ctx, span := tracing.Start(ctx, "webhook.FindDeadLetters")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+	return s.repo.FindDeadLetters(ctx)
+}
+
+func (s *webhook) ReplayDelivery(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	ctx, span := tracing.Start(ctx, "webhook.ReplayDelivery")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	newId, err := s.repo.ReplayDelivery(ctx, id)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	s.signal()
+	return newId, nil
+}
+
+// Publish queues the event for every subscription interested in it. Events
+// that were already queued are skipped.
+func (s *webhook) Publish(ctx context.Context, event model.Event) error {
+	ctx, span := tracing.Start(ctx, "webhook.Publish")
+	defer span.End()
+	log := logger.FromContext(ctx)
+	log.Trace()
+
+	webhooks, err := s.repo.FindWebhooksForEvent(ctx, event.Type)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	deliveries := make([]model.WebhookDelivery, 0, len(webhooks))
+	for _, w := range webhooks {
+		deliveries = append(deliveries, model.WebhookDelivery{
+			Id:        uuid.New(),
+			WebhookId: w.Id,
+			EventId:   event.Id,
+			EventType: event.Type,
+			Payload:   payload,
+			Created:   time.Now(),
+		})
+	}
+
+	if err := s.repo.AddDeliveries(ctx, deliveries); err != nil {
+		return err
+	}
+
+	s.signal()
+	return nil
+}
+
+// Start runs the delivery worker until Stop is called.
+func (s *webhook) Start() {
+	log.Trace()
+
+	s.started.Store(true)
+
+	go func() {
+		defer close(s.done)
+
+		ctx := workerContext("webhook")
+		interval := s.config().Webhook.PollInterval
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			s.deliverDue(ctx)
+
+			// A reloaded poll_interval applies from the next wait.
+			if next := s.config().Webhook.PollInterval; next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			case <-s.wake:
+			}
+		}
+	}()
+}
+
+// Stop waits for the deliveries in flight and stops the worker.
+func (s *webhook) Stop() {
+	log.Trace()
+
+	s.once.Do(func() {
+		close(s.stop)
+		<-s.done
+	})
+}
+
+// Running reports whether the worker was started and has not stopped.
+func (s *webhook) Running() bool {
+	return running(&s.started, s.done)
+}
+
+func (s *webhook) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *webhook) deliverDue(ctx context.Context) {
+	log := logger.FromContext(ctx)
+	cfg := s.config()
+
+	deliveries, err := s.repo.ClaimDueDeliveries(ctx, webhookBatchSize, 2*cfg.Webhook.Timeout)
+	if err != nil {
+		log.Errorf("Failed to claim webhook deliveries: %v", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, d := range deliveries {
+		wg.Add(1)
+		go func(d model.WebhookDelivery) {
+			defer wg.Done()
+			s.deliver(ctx, d, cfg.Webhook.Timeout, cfg.Webhook.Backoff, cfg.Webhook.MaxAttempts)
+		}(d)
+	}
+	wg.Wait()
+
+	if len(deliveries) == webhookBatchSize {
+		s.signal()
+	}
+}
+
+func (s *webhook) deliver(ctx context.Context, d model.WebhookDelivery, timeout, backoff time.Duration, maxAttempts int) {
+	log := logger.FromContext(ctx)
+	attempts := d.Attempts + 1
+
+	err := s.post(ctx, d, timeout)
+	switch {
+	case err == nil:
+		err = s.repo.MarkDelivered(ctx, d.Id, attempts)
+	case attempts >= maxAttempts:
+		log.Warnf("webhook delivery %s to %s dead-lettered after %d attempts: %v", d.Id, d.URL, attempts, err)
+		err = s.repo.DeadLetterDelivery(ctx, d.Id, attempts, err.Error())
+	default:
+		delay := min(backoff<<(attempts-1), webhookMaxBackoff)
+		log.Warnf("webhook delivery %s to %s failed, retry in %s: %v", d.Id, d.URL, delay, err)
+		err = s.repo.RetryDelivery(ctx, d.Id, attempts, time.Now().Add(delay), err.Error())
+	}
+
+	if err != nil {
+		log.Errorf("Failed to update webhook delivery %s: %v", d.Id, err)
+	}
+}
+
+func (s *webhook) post(ctx context.Context, d model.WebhookDelivery, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Forum-Event", d.EventType)
+	req.Header.Set("X-Forum-Delivery", d.Id.String())
+	timestamp := time.Now().Unix()
+	req.Header.Set("X-Forum-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Forum-Signature", SignWebhookPayload(d.Secret, timestamp, d.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// SignWebhookPayload returns the X-Forum-Signature header value for body
+// sent at timestamp, the X-Forum-Timestamp header in Unix seconds: "sha256="
+// followed by the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with
+// secret. Signing the timestamp lets receivers reject replayed deliveries.
+func SignWebhookPayload(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkWebhookHost rejects hosts that are or resolve to internal addresses.
+func checkWebhookHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("cannot resolve %s: %v", host, err)
+	}
+
+	for _, addr := range addrs {
+		if !publicAddress(addr) {
+			return fmt.Errorf("%s is the internal address %s", host, addr)
+		}
+	}
+	return nil
+}
+
+// publicAddress reports whether addr is a global unicast address outside
+// the private, loopback, link-local and shared address ranges.
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// newWebhookClient returns a client that checks every address it connects
+// to, including those of redirects and of hosts whose DNS changed after
+// AddWebhook, and refuses internal ones. It ignores proxy settings, which
+// would make it check the proxy instead of the target.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicAddress(addrPort.Addr()) {
+				return fmt.Errorf("refusing to connect to the internal address %s", addrPort.Addr())
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{Transport: transport}
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/demkowo/forum/config"
+	model "github.com/demkowo/forum/models"
+	"github.com/demkowo/forum/repositories/postgres"
+	"github.com/google/uuid"
+)
+
+// fakeWebhookRepo keeps deliveries in memory. Methods the tests do not use
+// are left to the embedded nil interface and panic.
+type fakeWebhookRepo struct {
+	postgres.WebhookRepo
+
+	mu        sync.Mutex
+	webhooks  []model.Webhook
+	pending   map[uuid.UUID]model.WebhookDelivery
+	delivered map[uuid.UUID]int
+	dead      map[uuid.UUID]model.WebhookDelivery
+	retries   []time.Duration
+}
+
+func newFakeWebhookRepo(deliveries ...model.WebhookDelivery) *fakeWebhookRepo {
+	r := &fakeWebhookRepo{
+		pending:   make(map[uuid.UUID]model.WebhookDelivery),
+		delivered: make(map[uuid.UUID]int),
+		dead:      make(map[uuid.UUID]model.WebhookDelivery),
+	}
+	for _, d := range deliveries {
+		r.pending[d.Id] = d
+	}
+	return r
+}
+
+func (r *fakeWebhookRepo) AddWebhook(ctx context.Context, webhook model.Webhook) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.webhooks = append(r.webhooks, webhook)
+	return nil
+}
+
+func (r *fakeWebhookRepo) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []model.WebhookDelivery
+	for _, d := range r.pending {
+		if !d.NextAttempt.After(time.Now()) && len(due) < limit {
+			due = append(due, d)
+		}
+	}
+	return due, nil
+}
+
+func (r *fakeWebhookRepo) MarkDelivered(ctx context.Context, id uuid.UUID, attempts int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, id)
+	r.delivered[id] = attempts
+	return nil
+}
+
+func (r *fakeWebhookRepo) RetryDelivery(ctx context.Context, id uuid.UUID, attempts int, nextAttempt time.Time, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := r.pending[id]
+	d.Attempts, d.NextAttempt, d.LastError = attempts, nextAttempt, lastError
+	r.pending[id] = d
+	r.retries = append(r.retries, time.Until(nextAttempt))
+	return nil
+}
+
+func (r *fakeWebhookRepo) DeadLetterDelivery(ctx context.Context, id uuid.UUID, attempts int, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	d := r.pending[id]
+	d.Attempts, d.LastError = attempts, lastError
+	delete(r.pending, id)
+	r.dead[id] = d
+	return nil
+}
+
+func testDelivery(url string) model.WebhookDelivery {
+	return model.WebhookDelivery{
+		Id:        uuid.New(),
+		WebhookId: uuid.New(),
+		EventId:   uuid.New(),
+		EventType: model.EventCommentCreated,
+		Payload:   []byte(`{"type":"comment.created"}`),
+		URL:       url,
+		Secret:    "s3cret",
+	}
+}
+
+// webhookConfig returns a configuration that makes the worker retry quickly.
+func webhookConfig(maxAttempts int, backoff time.Duration) config.Getter {
+	cfg := config.Default()
+	cfg.Webhook = config.Webhook{MaxAttempts: maxAttempts, Backoff: backoff, Timeout: time.Second, PollInterval: time.Second}
+	return func() *config.Config { return cfg }
+}
+
+// runWorker calls deliverDue until the repository has nothing pending.
+func runWorker(t *testing.T, s *webhook, repo *fakeWebhookRepo) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.deliverDue(context.Background())
+
+		repo.mu.Lock()
+		pending := len(repo.pending)
+		repo.mu.Unlock()
+		if pending == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d deliveries still pending", pending)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestWebhookDeliverySignsTimestampAndBody(t *testing.T) {
+	cfg := webhookConfig(3, 10*time.Millisecond)
+
+	var header http.Header
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer receiver.Close()
+
+	d := testDelivery(receiver.URL)
+	repo := newFakeWebhookRepo(d)
+	s := NewWebhook(repo, receiver.Client(), cfg).(*webhook)
+
+	runWorker(t, s, repo)
+
+	if attempts := repo.delivered[d.Id]; attempts != 1 {
+		t.Fatalf("delivered after %d attempts, want 1", attempts)
+	}
+	if got := header.Get("X-Forum-Event"); got != d.EventType {
+		t.Errorf("X-Forum-Event = %q, want %q", got, d.EventType)
+	}
+	if got := header.Get("X-Forum-Delivery"); got != d.Id.String() {
+		t.Errorf("X-Forum-Delivery = %q, want %q", got, d.Id)
+	}
+	if string(body) != string(d.Payload) {
+		t.Errorf("body = %s, want %s", body, d.Payload)
+	}
+
+	timestamp, err := strconv.ParseInt(header.Get("X-Forum-Timestamp"), 10, 64)
+	if err != nil {
+		t.Fatalf("X-Forum-Timestamp: %v", err)
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age < -time.Second || age > time.Minute {
+		t.Errorf("X-Forum-Timestamp is %s old", age)
+	}
+
+	mac := hmac.New(sha256.New, []byte(d.Secret))
+	mac.Write([]byte(header.Get("X-Forum-Timestamp") + "." + string(body)))
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); header.Get("X-Forum-Signature") != want {
+		t.Errorf("X-Forum-Signature = %q, want %q", header.Get("X-Forum-Signature"), want)
+	}
+}
+
+func TestWebhookDeliveryRetriesWithBackoff(t *testing.T) {
+	backoff := 20 * time.Millisecond
+	cfg := webhookConfig(5, backoff)
+
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	d := testDelivery(receiver.URL)
+	repo := newFakeWebhookRepo(d)
+	s := NewWebhook(repo, receiver.Client(), cfg).(*webhook)
+
+	runWorker(t, s, repo)
+
+	if attempts := repo.delivered[d.Id]; attempts != 3 {
+		t.Fatalf("delivered after %d attempts, want 3", attempts)
+	}
+	if len(repo.retries) != 2 {
+		t.Fatalf("%d retries, want 2", len(repo.retries))
+	}
+	for i, want := range []time.Duration{backoff, 2 * backoff} {
+		if got := repo.retries[i]; got > want || got < want-10*time.Millisecond {
+			t.Errorf("retry %d scheduled in %s, want %s", i+1, got, want)
+		}
+	}
+}
+
+func TestWebhookDeliveryBackoffIsCapped(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	d := testDelivery(receiver.URL)
+	d.Attempts = 20
+	repo := newFakeWebhookRepo(d)
+	s := NewWebhook(repo, receiver.Client(), config.Default).(*webhook)
+
+	s.deliver(context.Background(), d, time.Second, time.Minute, 50)
+
+	if len(repo.retries) != 1 || repo.retries[0] > webhookMaxBackoff {
+		t.Fatalf("retries = %v, want one within %s", repo.retries, webhookMaxBackoff)
+	}
+}
+
+func TestWebhookDeliveryDeadLettersAfterMaxAttempts(t *testing.T) {
+	cfg := webhookConfig(3, time.Millisecond)
+
+	var calls atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	d := testDelivery(receiver.URL)
+	repo := newFakeWebhookRepo(d)
+	s := NewWebhook(repo, receiver.Client(), cfg).(*webhook)
+
+	runWorker(t, s, repo)
+
+	dead, ok := repo.dead[d.Id]
+	if !ok {
+		t.Fatal("delivery was not dead-lettered")
+	}
+	if dead.Attempts != 3 || calls.Load() != 3 {
+		t.Errorf("dead-lettered after %d attempts and %d requests, want 3", dead.Attempts, calls.Load())
+	}
+	if !strings.Contains(dead.LastError, "500") {
+		t.Errorf("last error = %q, want the status", dead.LastError)
+	}
+	if len(repo.delivered) != 0 {
+		t.Errorf("delivered = %v, want none", repo.delivered)
+	}
+}
+
+func TestAddWebhookRejectsInternalTargets(t *testing.T) {
+	for _, url := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://[::1]/hook",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.1/hook",
+		"http://172.16.0.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://100.64.0.1/hook",
+		"http://0.0.0.0/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+		"http://[fd00::1]/hook",
+	} {
+		t.Run(url, func(t *testing.T) {
+			repo := newFakeWebhookRepo()
+			s := NewWebhook(repo, nil, config.Default)
+
+			err := s.AddWebhook(context.Background(), &model.Webhook{URL: url, Events: []string{"*"}})
+			if !errors.Is(err, ErrInvalidWebhook) {
+				t.Fatalf("AddWebhook(%s) = %v, want ErrInvalidWebhook", url, err)
+			}
+			if len(repo.webhooks) != 0 {
+				t.Fatalf("webhook to %s was stored", url)
+			}
+		})
+	}
+}
+
+func TestAddWebhookAcceptsPublicTargets(t *testing.T) {
+	repo := newFakeWebhookRepo()
+	s := NewWebhook(repo, nil, config.Default)
+
+	w := &model.Webhook{URL: "https://93.184.215.14/hook", Events: []string{model.EventCommentCreated}}
+	if err := s.AddWebhook(context.Background(), w); err != nil {
+		t.Fatalf("AddWebhook = %v", err)
+	}
+	if len(repo.webhooks) != 1 || w.Secret == "" {
+		t.Fatalf("webhook not stored with a generated secret: %+v", repo.webhooks)
+	}
+}
+
+func TestWebhookClientRefusesInternalAddresses(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+
+	_, err := newWebhookClient().Get(receiver.URL)
+	if err == nil || !strings.Contains(err.Error(), "internal address") {
+		t.Fatalf("GET %s = %v, want the internal address refused", receiver.URL, err)
+	}
+}
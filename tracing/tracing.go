@@ -0,0 +1,87 @@
+// Package tracing sets up OpenTelemetry and starts the spans of the
+// service. Spans started before Setup, or with the "none" exporter, are not
+// recorded but still carry the trace context of the incoming request.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/demkowo/forum/config"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentation = "github.com/demkowo/forum"
+
+func init() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Setup installs the tracer provider selected by cfg. The returned function
+// flushes the spans still buffered and must be called before exiting.
+func Setup(ctx context.Context, cfg config.Tracing) (shutdown func(context.Context) error, err error) {
+	log.Trace()
+
+	var exporter sdktrace.SpanExporter
+	switch cfg.Exporter {
+	case "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "otlp":
+		var options []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+	default:
+		err = fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := NewProvider(cfg, sdktrace.NewBatchSpanProcessor(exporter))
+	otel.SetTracerProvider(provider)
+	log.Infof("tracing with the %s exporter, sample ratio %g", cfg.Exporter, cfg.SampleRatio)
+
+	return provider.Shutdown, nil
+}
+
+// NewProvider returns a tracer provider that samples cfg.SampleRatio of the
+// new traces, follows the sampling decision of incoming ones and hands the
+// spans to processor. Tests can pass
+// sdktrace.NewSimpleSpanProcessor(tracetest.NewInMemoryExporter()) and
+// install the provider with otel.SetTracerProvider.
+func NewProvider(cfg config.Tracing, processor sdktrace.SpanProcessor) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))),
+	)
+}
+
+// Start starts a span of the service as a child of the span in ctx.
+func Start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentation).Start(ctx, name, options...)
+}
+
+// TraceId returns the trace id of the span in ctx, or "" if there is none.
+func TraceId(ctx context.Context) string {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
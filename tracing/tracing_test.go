@@ -0,0 +1,235 @@
+package tracing_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/demkowo/forum/config"
+	handler "github.com/demkowo/forum/handlers"
+	"github.com/demkowo/forum/middleware"
+	"github.com/demkowo/forum/repositories/postgres"
+	service "github.com/demkowo/forum/services"
+	"github.com/demkowo/forum/tracing"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var errDatabaseDown = errors.New("database down")
+
+// commentsDB answers the comment lookup with one row, or with
+// errDatabaseDown for the comment id failing.
+type commentsDB struct {
+	failing uuid.UUID
+}
+
+func (db *commentsDB) Connect(ctx context.Context) (driver.Conn, error) { return db, nil }
+func (db *commentsDB) Driver() driver.Driver                            { return nil }
+func (db *commentsDB) Prepare(query string) (driver.Stmt, error)        { return nil, errors.ErrUnsupported }
+func (db *commentsDB) Close() error                                     { return nil }
+func (db *commentsDB) Begin() (driver.Tx, error)                        { return nil, errors.ErrUnsupported }
+
+func (db *commentsDB) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if !strings.Contains(query, "FROM comments") {
+		return nil, errors.New("unexpected query")
+	}
+	if args[0].Value == db.failing.String() {
+		return nil, errDatabaseDown
+	}
+	return &commentRows{values: []driver.Value{
+		args[0].Value, uuid.NewString(), uuid.NewString(), uuid.NewString(), "alice", "**hi**", time.Now(), false, false, 0.1, []byte("{}"),
+	}}, nil
+}
+
+type commentRows struct {
+	values []driver.Value
+	done   bool
+}
+
+func (r *commentRows) Columns() []string {
+	return []string{"id", "article_id", "thread_id", "parent_id", "author", "content", "created", "deleted", "held", "spam_score", "mentions"}
+}
+func (r *commentRows) Close() error { return nil }
+func (r *commentRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	copy(dest, r.values)
+	r.done = true
+	return nil
+}
+
+// recordSpans installs a tracer provider that keeps the spans in memory
+// for the rest of the test.
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := tracing.NewProvider(config.Tracing{SampleRatio: 1, ServiceName: "forum-test"}, sdktrace.NewSimpleSpanProcessor(exporter))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+		otel.SetTracerProvider(previous)
+	})
+	return exporter
+}
+
+func newRouter(db *commentsDB) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	conn := sql.OpenDB(db)
+	h := handler.NewForum(service.NewForum(postgres.NewForum(conn, nil, "english"), nil, nil, nil, nil, config.Default))
+
+	router := gin.New()
+	router.Use(middleware.Tracing())
+	router.GET("/api/v1/comments/get/:comment_id", h.GetComment)
+	return router
+}
+
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no span %q in %d spans", name, len(spans))
+	return tracetest.SpanStub{}
+}
+
+func attributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	values := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes {
+		values[kv.Key] = kv.Value
+	}
+	return values
+}
+
+func checkAttributes(t *testing.T, span tracetest.SpanStub, want map[attribute.Key]any) {
+	t.Helper()
+	got := attributes(span)
+	for key, value := range want {
+		if got[key].AsInterface() != value {
+			t.Errorf("span %s: %s = %v, want %v", span.Name, key, got[key].AsInterface(), value)
+		}
+	}
+}
+
+// spanTree returns the request, service and repository spans and checks
+// that each is the child of the one before in the same trace.
+func spanTree(t *testing.T, exporter *tracetest.InMemoryExporter) (request, forum, repo tracetest.SpanStub) {
+	t.Helper()
+	spans := exporter.GetSpans()
+
+	request = findSpan(t, spans, "GET /api/v1/comments/get/:comment_id")
+	forum = findSpan(t, spans, "forum.GetComment")
+	repo = findSpan(t, spans, "postgres.forum.GetComment")
+
+	for _, pair := range [][2]tracetest.SpanStub{{request, forum}, {forum, repo}} {
+		parent, child := pair[0], pair[1]
+		if child.Parent.SpanID() != parent.SpanContext.SpanID() || child.SpanContext.TraceID() != parent.SpanContext.TraceID() {
+			t.Errorf("span %s is not a child of %s", child.Name, parent.Name)
+		}
+	}
+	if request.Parent.IsValid() {
+		t.Errorf("request span has parent %s, want a root span", request.Parent.SpanID())
+	}
+	return request, forum, repo
+}
+
+func TestSpanTree(t *testing.T) {
+	exporter := recordSpans(t)
+	router := newRouter(&commentsDB{})
+
+	id := uuid.NewString()
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/v1/comments/get/"+id, nil))
+	if response.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", response.Code, response.Body)
+	}
+
+	request, forum, repo := spanTree(t, exporter)
+
+	if request.SpanKind != trace.SpanKindServer || repo.SpanKind != trace.SpanKindClient || forum.SpanKind != trace.SpanKindInternal {
+		t.Errorf("span kinds %s, %s, %s, want server, internal, client", request.SpanKind, forum.SpanKind, repo.SpanKind)
+	}
+	checkAttributes(t, request, map[attribute.Key]any{
+		"http.request.method":       http.MethodGet,
+		"http.route":                "/api/v1/comments/get/:comment_id",
+		"url.path":                  "/api/v1/comments/get/" + id,
+		"http.response.status_code": int64(http.StatusOK),
+	})
+	checkAttributes(t, repo, map[attribute.Key]any{
+		"db.system.name":    "postgresql",
+		"db.operation.name": "GetComment",
+		"db.statement.name": "forum.GetComment",
+	})
+	for _, span := range []tracetest.SpanStub{request, forum, repo} {
+		if span.Status.Code == codes.Error {
+			t.Errorf("span %s failed: %s", span.Name, span.Status.Description)
+		}
+	}
+	if value, _ := request.Resource.Set().Value("service.name"); value.AsString() != "forum-test" {
+		t.Errorf("service.name = %q, want forum-test", value.AsString())
+	}
+}
+
+func TestSpanTreeRecordsErrors(t *testing.T) {
+	exporter := recordSpans(t)
+	db := &commentsDB{failing: uuid.New()}
+	router := newRouter(db)
+
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/v1/comments/get/"+db.failing.String(), nil))
+	if response.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", response.Code)
+	}
+
+	request, _, repo := spanTree(t, exporter)
+
+	if repo.Status.Code != codes.Error || repo.Status.Description != errDatabaseDown.Error() {
+		t.Errorf("repository span status %v, want the database error", repo.Status)
+	}
+	if len(repo.Events) == 0 || repo.Events[0].Name != "exception" {
+		t.Errorf("repository span events %v, want the recorded error", repo.Events)
+	}
+	if request.Status.Code != codes.Error {
+		t.Errorf("request span status %v, want error", request.Status)
+	}
+	checkAttributes(t, request, map[attribute.Key]any{"http.response.status_code": int64(http.StatusInternalServerError)})
+}
+
+func TestSpanTreeContinuesIncomingTrace(t *testing.T) {
+	exporter := recordSpans(t)
+	router := newRouter(&commentsDB{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/comments/get/"+uuid.NewString(), nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	request := findSpan(t, spans, "GET /api/v1/comments/get/:comment_id")
+	if got := request.SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace id %s, want the incoming one", got)
+	}
+	if got := request.Parent.SpanID().String(); got != "00f067aa0ba902b7" || !request.Parent.IsRemote() {
+		t.Errorf("parent %s, want the remote span 00f067aa0ba902b7", got)
+	}
+	repo := findSpan(t, spans, "postgres.forum.GetComment")
+	if repo.SpanContext.TraceID() != request.SpanContext.TraceID() {
+		t.Error("repository span is not in the incoming trace")
+	}
+}
@@ -0,0 +1,29 @@
+package logger
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type entryKey struct{}
+
+// WithEntry returns a copy of ctx that carries entry, so everything handling
+// the request logs with its fields.
+func WithEntry(ctx context.Context, entry *log.Entry) context.Context {
+	return context.WithValue(ctx, entryKey{}, entry)
+}
+
+// FromContext returns the entry stored in ctx by WithEntry, or an entry of
+// the standard logger without fields.
+func FromContext(ctx context.Context) *log.Entry {
+	if entry, ok := ctx.Value(entryKey{}).(*log.Entry); ok {
+		return entry
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// WithFields adds fields to the entry stored in ctx.
+func WithFields(ctx context.Context, fields log.Fields) context.Context {
+	return WithEntry(ctx, FromContext(ctx).WithFields(fields))
+}
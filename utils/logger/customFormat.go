@@ -1,33 +1,58 @@
-package logger
-
-import (
-	"fmt"
-	"path/filepath"
-	"strings"
-
-	log "github.com/sirupsen/logrus"
-)
-
-type CustomFormatter struct{}
-
-func (f *CustomFormatter) Format(entry *log.Entry) ([]byte, error) {
-
-	time := entry.Time.Format("MST 2006-01-02 15:04:05.9999999")
-	lvl := strings.ToUpper(fmt.Sprint(entry.Level))
-	function := filepath.Base(entry.Caller.Function)
-	file := entry.Caller.File
-	line := entry.Caller.Line
-	msg := entry.Message
-
-	parts := strings.Split(file, "/")
-	if len(parts) >= 4 {
-		file = strings.Join(parts[len(parts)-3:], "/")
-	}
-
-	str := fmt.Sprintf("%s:%d", file, line)
-
-	if msg != "" {
-		return []byte(fmt.Sprintf("%-31s   [%-7s]   %-55s   %-50s\n    === %s\n\n", time, lvl, function, str, msg)), nil
-	}
-	return []byte(fmt.Sprintf("%-31s   [%-7s]   %-55s   %-50s\n", time, lvl, function, str)), nil
-}
+package logger
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type CustomFormatter struct{}
+
+func (f *CustomFormatter) Format(entry *log.Entry) ([]byte, error) {
+
+	time := entry.Time.Format("MST 2006-01-02 15:04:05.9999999")
+	lvl := strings.ToUpper(fmt.Sprint(entry.Level))
+	msg := entry.Message
+
+	// The caller is only known while the reporter is on.
+	var function, str string
+	if entry.HasCaller() {
+		function = filepath.Base(entry.Caller.Function)
+		file := entry.Caller.File
+		parts := strings.Split(file, "/")
+		if len(parts) >= 4 {
+			file = strings.Join(parts[len(parts)-3:], "/")
+		}
+		str = fmt.Sprintf("%s:%d", file, entry.Caller.Line)
+	}
+
+	fields := formatFields(entry.Data)
+
+	if msg != "" {
+		return []byte(fmt.Sprintf("%-31s   [%-7s]   %-55s   %-50s%s\n    === %s\n\n", time, lvl, function, str, fields, msg)), nil
+	}
+	return []byte(fmt.Sprintf("%-31s   [%-7s]   %-55s   %-50s%s\n", time, lvl, function, str, fields)), nil
+}
+
+// formatFields renders the entry fields as sorted key=value pairs, so the
+// lines of one request can be found by its request_id.
+func formatFields(data log.Fields) string {
+	if len(data) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "   %s=%v", key, data[key])
+	}
+	return b.String()
+}
@@ -0,0 +1,264 @@
+package logger
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	model "github.com/demkowo/forum/models"
+)
+
+const (
+	backupTimeFormat = "2006-01-02T15-04-05.000"
+	megabyte         = 1 << 20
+)
+
+// rotatingFile appends to a log file and moves it aside to
+// <name>-<time><ext> when it grows past maxSize or a new rotateEvery period
+// starts. Rotated files are gzipped and pruned in the background.
+type rotatingFile struct {
+	mu          sync.Mutex
+	path        string
+	maxSize     int64
+	rotateEvery time.Duration
+	maxAge      time.Duration
+	maxFiles    int
+	compress    bool
+	file        *os.File
+	size        int64
+	period      time.Time
+	cleanupMu   sync.Mutex
+}
+
+func openRotatingFile(cfg model.LogrusConfig) (*rotatingFile, error) {
+	r := &rotatingFile{
+		path:        cfg.Path,
+		maxSize:     int64(cfg.MaxSize) * megabyte,
+		rotateEvery: cfg.RotateEvery,
+		maxAge:      cfg.MaxAge,
+		maxFiles:    cfg.MaxFiles,
+		compress:    cfg.Compress,
+	}
+
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	go r.cleanup()
+	return r, nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if r.due(len(p), time.Now()) {
+		if err := r.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "log rotation failed: %v\n", err)
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// Reopen closes the file and opens path again, for when an external tool
+// such as logrotate has moved it.
+func (r *rotatingFile) Reopen() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.close()
+	return r.open()
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.close()
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	r.file = f
+	r.size = info.Size()
+	r.period = r.periodOf(info.ModTime())
+	if info.Size() == 0 {
+		r.period = r.periodOf(time.Now())
+	}
+
+	return nil
+}
+
+func (r *rotatingFile) close() error {
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// due reports whether writing n more bytes at now must go to a new file.
+func (r *rotatingFile) due(n int, now time.Time) bool {
+	if r.size == 0 {
+		return false
+	}
+	if r.maxSize > 0 && r.size+int64(n) > r.maxSize {
+		return true
+	}
+	return r.rotateEvery > 0 && r.periodOf(now).After(r.period)
+}
+
+func (r *rotatingFile) periodOf(t time.Time) time.Time {
+	if r.rotateEvery <= 0 {
+		return time.Time{}
+	}
+	return t.UTC().Truncate(r.rotateEvery)
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(r.path, r.backupName(time.Now())); err != nil && !os.IsNotExist(err) {
+		r.open()
+		return err
+	}
+
+	if err := r.open(); err != nil {
+		return err
+	}
+
+	go r.cleanup()
+	return nil
+}
+
+func (r *rotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(r.path)
+	return strings.TrimSuffix(r.path, ext) + "-" + t.UTC().Format(backupTimeFormat) + ext
+}
+
+type backup struct {
+	path string
+	time time.Time
+}
+
+// backups returns the rotated files of path, newest first.
+func (r *rotatingFile) backups() ([]backup, error) {
+	ext := filepath.Ext(r.path)
+	prefix := filepath.Base(strings.TrimSuffix(r.path, ext)) + "-"
+
+	entries, err := os.ReadDir(filepath.Dir(r.path))
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []backup
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		stamp := strings.TrimPrefix(name, prefix)
+		stamp = strings.TrimSuffix(stamp, ".gz")
+		stamp = strings.TrimSuffix(stamp, ext)
+		t, err := time.Parse(backupTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+
+		backups = append(backups, backup{path: filepath.Join(filepath.Dir(r.path), name), time: t})
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].time.After(backups[j].time) })
+	return backups, nil
+}
+
+// cleanup compresses rotated files and removes those beyond maxFiles or
+// older than maxAge.
+func (r *rotatingFile) cleanup() {
+	r.cleanupMu.Lock()
+	defer r.cleanupMu.Unlock()
+
+	backups, err := r.backups()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "log cleanup failed: %v\n", err)
+		return
+	}
+
+	for i, b := range backups {
+		expired := r.maxAge > 0 && time.Since(b.time) > r.maxAge
+		if (r.maxFiles > 0 && i >= r.maxFiles) || expired {
+			if err := os.Remove(b.path); err != nil {
+				fmt.Fprintf(os.Stderr, "removing %s failed: %v\n", b.path, err)
+			}
+			continue
+		}
+
+		if r.compress && !strings.HasSuffix(b.path, ".gz") {
+			if err := compressFile(b.path); err != nil {
+				fmt.Fprintf(os.Stderr, "compressing %s failed: %v\n", b.path, err)
+			}
+		}
+	}
+}
+
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	in.Close()
+	return os.Remove(path)
+}
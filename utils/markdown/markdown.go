@@ -0,0 +1,178 @@
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Render converts the supported Markdown subset to HTML: paragraphs, **bold**,
+// *italics* / _italics_, `code`, fenced code blocks, > quotes, - and 1. lists
+// and [links](https://...). All input is HTML-escaped before formatting, so the
+// output only ever contains the tags produced here. Links are limited to
+// http, https and mailto and get rel="nofollow noopener".
+func Render(src string) string {
+	src = strings.ReplaceAll(src, "\x00", "")
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+
+	var b strings.Builder
+	renderBlocks(&b, strings.Split(src, "\n"))
+	return b.String()
+}
+
+var (
+	orderedItem   = regexp.MustCompile(`^\d{1,9}[.)]\s+`)
+	unorderedItem = regexp.MustCompile(`^[-*+]\s+`)
+	linkPattern   = regexp.MustCompile(`\[([^\[\]]+)\]\(([^()\s]+)\)`)
+	boldPattern   = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*`)
+	italicStar    = regexp.MustCompile(`\*(\S(?:.*?\S)?)\*`)
+	italicUnder   = regexp.MustCompile(`(^|[^\p{L}\p{N}_])_(\S(?:[^_]*?\S)?)_($|[^\p{L}\p{N}_])`)
+	placeholder   = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+func renderBlocks(b *strings.Builder, lines []string) {
+	var paragraph []string
+
+	flush := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		b.WriteString("<p>")
+		for i, line := range paragraph {
+			if i > 0 {
+				b.WriteString("<br>\n")
+			}
+			b.WriteString(renderInline(line))
+		}
+		b.WriteString("</p>\n")
+		paragraph = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			flush()
+
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			b.WriteString("<pre><code>")
+			b.WriteString(html.EscapeString(strings.Join(code, "\n")))
+			b.WriteString("</code></pre>\n")
+
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				q := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quote = append(quote, strings.TrimPrefix(q, " "))
+			}
+			i--
+			b.WriteString("<blockquote>\n")
+			renderBlocks(b, quote)
+			b.WriteString("</blockquote>\n")
+
+		case unorderedItem.MatchString(trimmed), orderedItem.MatchString(trimmed):
+			flush()
+			item, tag := unorderedItem, "ul"
+			if orderedItem.MatchString(trimmed) {
+				item, tag = orderedItem, "ol"
+			}
+			fmt.Fprintf(b, "<%s>\n", tag)
+			for ; i < len(lines) && item.MatchString(strings.TrimSpace(lines[i])); i++ {
+				b.WriteString("<li>")
+				b.WriteString(renderInline(item.ReplaceAllString(strings.TrimSpace(lines[i]), "")))
+				b.WriteString("</li>\n")
+			}
+			i--
+			fmt.Fprintf(b, "</%s>\n", tag)
+
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+
+	flush()
+}
+
+// renderInline formats a single line. Code spans and links are swapped for
+// placeholders first so their contents are not formatted again.
+func renderInline(line string) string {
+	var saved []string
+	save := func(s string) string {
+		saved = append(saved, s)
+		return fmt.Sprintf("\x00%d\x00", len(saved)-1)
+	}
+
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(line, '`')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(line[start+1:], '`')
+		if end < 0 {
+			break
+		}
+		b.WriteString(line[:start])
+		b.WriteString(save("<code>" + html.EscapeString(line[start+1:start+1+end]) + "</code>"))
+		line = line[start+end+2:]
+	}
+	b.WriteString(line)
+
+	text := linkPattern.ReplaceAllStringFunc(b.String(), func(m string) string {
+		parts := linkPattern.FindStringSubmatch(m)
+		href, ok := safeURL(parts[2])
+		if !ok {
+			return m
+		}
+		return save(fmt.Sprintf(`<a href="%s" rel="nofollow noopener">%s</a>`, html.EscapeString(href), formatText(html.EscapeString(parts[1]))))
+	})
+
+	text = formatText(html.EscapeString(text))
+
+	for placeholder.MatchString(text) {
+		text = placeholder.ReplaceAllStringFunc(text, func(m string) string {
+			var n int
+			fmt.Sscanf(strings.Trim(m, "\x00"), "%d", &n)
+			return saved[n]
+		})
+	}
+
+	return text
+}
+
+// formatText applies emphasis to already escaped text.
+func formatText(text string) string {
+	text = boldPattern.ReplaceAllString(text, "<strong>$1</strong>")
+	text = italicStar.ReplaceAllString(text, "<em>$1</em>")
+	text = italicUnder.ReplaceAllString(text, "$1<em>$2</em>$3")
+	return text
+}
+
+func safeURL(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		if u.Host == "" {
+			return "", false
+		}
+	case "mailto":
+	default:
+		return "", false
+	}
+
+	return u.String(), true
+}
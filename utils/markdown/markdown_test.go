@@ -0,0 +1,101 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"paragraph", "hello", "<p>hello</p>\n"},
+		{"line break", "one\ntwo", "<p>one<br>\ntwo</p>\n"},
+		{"emphasis", "**bold** *it* _it_", "<p><strong>bold</strong> <em>it</em> <em>it</em></p>\n"},
+		{"underscore inside words", "snake_case_name", "<p>snake_case_name</p>\n"},
+		{"code span", "use `<b>` here", "<p>use <code>&lt;b&gt;</code> here</p>\n"},
+		{"code span is not formatted", "`**x**`", "<p><code>**x**</code></p>\n"},
+		{"fenced code", "```\n<script>\n**x**\n```", "<pre><code>&lt;script&gt;\n**x**</code></pre>\n"},
+		{"quote", "> quoted\n> **text**", "<blockquote>\n<p>quoted<br>\n<strong>text</strong></p>\n</blockquote>\n"},
+		{"unordered list", "- a\n- b", "<ul>\n<li>a</li>\n<li>b</li>\n</ul>\n"},
+		{"ordered list", "1. a\n2. b", "<ol>\n<li>a</li>\n<li>b</li>\n</ol>\n"},
+		{"link", "[site](https://example.com/a?b=1&c=2)", `<p><a href="https://example.com/a?b=1&amp;c=2" rel="nofollow noopener">site</a></p>` + "\n"},
+		{"mailto link", "[mail](mailto:a@example.com)", `<p><a href="mailto:a@example.com" rel="nofollow noopener">mail</a></p>` + "\n"},
+		{"formatted link text", "[**go**](https://go.dev)", `<p><a href="https://go.dev" rel="nofollow noopener"><strong>go</strong></a></p>` + "\n"},
+		{"crlf and nul", "a\r\nb\x00c", "<p>a<br>\nbc</p>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.src); got != tt.want {
+				t.Errorf("Render(%q) =\n%q\nwant\n%q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+// tagPattern matches opening tags, so escaped markup (&lt;script&gt;) is
+// not counted.
+var tagPattern = regexp.MustCompile(`<([a-zA-Z][a-zA-Z0-9]*)([^>]*)>`)
+
+// eventHandler matches on* attributes such as onerror=.
+var eventHandler = regexp.MustCompile(`(?i)\bon\w+=`)
+
+// allowedTags are the tags Render produces.
+var allowedTags = map[string]bool{
+	"p": true, "br": true, "strong": true, "em": true, "code": true, "pre": true,
+	"blockquote": true, "ul": true, "ol": true, "li": true, "a": true,
+}
+
+func TestRenderSanitizes(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"script tag", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"script in emphasis", "**<script>alert(1)</script>**", "<p><strong>&lt;script&gt;alert(1)&lt;/script&gt;</strong></p>\n"},
+		{"script in list", "- <script>x</script>", "<ul>\n<li>&lt;script&gt;x&lt;/script&gt;</li>\n</ul>\n"},
+		{"script in quote", "> <script>x</script>", "<blockquote>\n<p>&lt;script&gt;x&lt;/script&gt;</p>\n</blockquote>\n"},
+		{"unclosed fence", "```\n</code></pre><script>x</script>", "<pre><code>&lt;/code&gt;&lt;/pre&gt;&lt;script&gt;x&lt;/script&gt;</code></pre>\n"},
+		{"javascript link", "[click](javascript:alert(1))", "<p>[click](javascript:alert(1))</p>\n"},
+		{"javascript link without parens", "[click](javascript:alert`1`)", "<p>[click](javascript:alert<code>1</code>)</p>\n"},
+		{"upper case javascript link", "[click](JaVaScRiPt:alert)", "<p>[click](JaVaScRiPt:alert)</p>\n"},
+		{"data link", "[click](data:text/html;base64,PHNjcmlwdD4=)", "<p>[click](data:text/html;base64,PHNjcmlwdD4=)</p>\n"},
+		{"vbscript link", "[click](vbscript:msgbox)", "<p>[click](vbscript:msgbox)</p>\n"},
+		{"relative link", "[click](/admin)", "<p>[click](/admin)</p>\n"},
+		{"protocol relative link", "[click](//evil.example)", "<p>[click](//evil.example)</p>\n"},
+		{"quote in href", `[x](https://a.example/"onmouseover="alert(1))`, `<p>[x](https://a.example/&#34;onmouseover=&#34;alert(1))</p>` + "\n"},
+		{"markup in link text", "[<img src=x onerror=alert(1)>](https://a.example)", `<p><a href="https://a.example" rel="nofollow noopener">&lt;img src=x onerror=alert(1)&gt;</a></p>` + "\n"},
+		{"event handler attribute", `<img src=x onerror="alert(1)">`, "<p>&lt;img src=x onerror=&#34;alert(1)&#34;&gt;</p>\n"},
+		{"event handler in div", `<div onclick='steal()'>hi</div>`, "<p>&lt;div onclick=&#39;steal()&#39;&gt;hi&lt;/div&gt;</p>\n"},
+		{"svg onload", `<svg onload=alert(1)>`, "<p>&lt;svg onload=alert(1)&gt;</p>\n"},
+		{"raw html passthrough", `<b>bold</b> <a href="https://a.example">a</a> <iframe src="https://a.example"></iframe>`,
+			`<p>&lt;b&gt;bold&lt;/b&gt; &lt;a href=&#34;https://a.example&#34;&gt;a&lt;/a&gt; &lt;iframe src=&#34;https://a.example&#34;&gt;&lt;/iframe&gt;</p>` + "\n"},
+		{"html comment", "<!-- x --><p>", "<p>&lt;!-- x --&gt;&lt;p&gt;</p>\n"},
+		{"entities stay escaped", "&lt;script&gt; &amp;", "<p>&amp;lt;script&amp;gt; &amp;amp;</p>\n"},
+		{"placeholder injection", "\x000\x00 `x`", "<p>0 <code>x</code></p>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Render(tt.src)
+			if got != tt.want {
+				t.Errorf("Render(%q) =\n%q\nwant\n%q", tt.src, got, tt.want)
+			}
+
+			for _, tag := range tagPattern.FindAllStringSubmatch(got, -1) {
+				if !allowedTags[strings.ToLower(tag[1])] {
+					t.Errorf("Render(%q) produced tag <%s>", tt.src, tag[1])
+				}
+				if tag[1] != "a" && tag[2] != "" {
+					t.Errorf("Render(%q) produced attributes %q on <%s>", tt.src, tag[2], tag[1])
+				}
+				if strings.Contains(strings.ToLower(tag[2]), "javascript:") || eventHandler.MatchString(tag[2]) {
+					t.Errorf("Render(%q) produced unsafe attributes %q", tt.src, tag[2])
+				}
+			}
+		})
+	}
+}